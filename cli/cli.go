@@ -34,9 +34,10 @@ var (
 		},
 	}
 
-	logDebug   bool
-	logVerbose bool
-	logLevel   = capnslog.NOTICE
+	logDebug     bool
+	logVerbose   bool
+	logLevel     = capnslog.NOTICE
+	logFormatter capnslog.Formatter
 
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "cli")
 )
@@ -60,7 +61,7 @@ func Execute(main *cobra.Command) {
 		"Alias for --log-level=DEBUG")
 
 	WrapPreRun(main, func(cmd *cobra.Command, args []string) error {
-		startLogging(cmd)
+		StartLogging(cmd)
 		return nil
 	})
 
@@ -70,6 +71,13 @@ func Execute(main *cobra.Command) {
 	os.Exit(0)
 }
 
+// LogFormatter returns the formatter set up by StartLogging so code that
+// temporarily redirects logging can restore it, or nil if logging has
+// not been started.
+func LogFormatter() capnslog.Formatter {
+	return logFormatter
+}
+
 func setRepoLogLevel(repo string, l capnslog.LogLevel) {
 	r, err := capnslog.GetRepoLogger(repo)
 	if err != nil {
@@ -78,7 +86,9 @@ func setRepoLogLevel(repo string, l capnslog.LogLevel) {
 	r.SetRepoLogLevel(l)
 }
 
-func startLogging(cmd *cobra.Command) {
+// StartLogging applies the common logging flags. Execute does this for
+// every command, unless a subcommand replaces the root's pre-run hook.
+func StartLogging(cmd *cobra.Command) {
 	switch {
 	case logDebug:
 		logLevel = capnslog.DEBUG
@@ -86,7 +96,8 @@ func startLogging(cmd *cobra.Command) {
 		logLevel = capnslog.INFO
 	}
 
-	capnslog.SetFormatter(capnslog.NewStringFormatter(cmd.Out()))
+	logFormatter = capnslog.NewStringFormatter(cmd.Out())
+	capnslog.SetFormatter(logFormatter)
 	capnslog.SetGlobalLogLevel(logLevel)
 
 	// In the context of the internally linked etcd, the NOTICE messages
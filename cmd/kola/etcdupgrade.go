@@ -90,14 +90,8 @@ coreos:
 	kola.RegisterTestOption("EtcdUpgradeBin", etcdUpgradeBin)
 	kola.RegisterTestOption("EtcdUpgradeBin2", etcdUpgradeBin2)
 
-	outputDir, err := kola.CleanOutputDir(outputDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Setup failed: %v\n", err)
-		os.Exit(1)
-	}
-
 	if err := kola.RunTest(t, "gce", outputDir); err != nil {
-		fmt.Fprintf(os.Stderr, "--- FAIL: %v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 }
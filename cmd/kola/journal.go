@@ -0,0 +1,164 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/network/journal"
+)
+
+const journalRawFile = "journal-raw.txt"
+
+var (
+	cmdJournalMerge = &cobra.Command{
+		Use:   "journal-merge <output directory>",
+		Short: "Merge machine journals into a single timeline",
+		Long: `
+Merge the journals recorded from every machine under a kola output
+directory into a single stream ordered by time. Each line is prefixed
+with the path of the machine's output directory.
+
+Times for --since and --until are either RFC 3339 or in the form
+"2006-01-02 15:04:05" in the local or --utc time zone.
+`,
+		Run: runJournalMerge,
+	}
+
+	journalUnits []string
+	journalSince string
+	journalUntil string
+	journalUTC   bool
+)
+
+func init() {
+	root.AddCommand(cmdJournalMerge)
+	cmdJournalMerge.Flags().StringSliceVarP(&journalUnits, "unit", "u", nil, "only show entries from these units")
+	cmdJournalMerge.Flags().StringVar(&journalSince, "since", "", "only show entries at or after this time")
+	cmdJournalMerge.Flags().StringVar(&journalUntil, "until", "", "only show entries at or before this time")
+	cmdJournalMerge.Flags().BoolVar(&journalUTC, "utc", false, "use UTC rather than local time")
+}
+
+func runJournalMerge(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Expected one output directory\n")
+		os.Exit(2)
+	}
+
+	tz := time.Local
+	if journalUTC {
+		tz = time.UTC
+	}
+
+	var (
+		timeline journal.Timeline
+		err      error
+	)
+	if timeline.Since, err = parseJournalTime(journalSince, tz); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --since: %v\n", err)
+		os.Exit(2)
+	}
+	if timeline.Until, err = parseJournalTime(journalUntil, tz); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --until: %v\n", err)
+		os.Exit(2)
+	}
+	for _, unit := range journalUnits {
+		timeline.Filters = append(timeline.Filters, journal.Filter{Unit: unit})
+	}
+
+	files, err := addJournals(&timeline, args[0])
+	for _, f := range files {
+		defer f.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reading journals failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No %s files found in %s\n", journalRawFile, args[0])
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	w := journal.NewTimelineWriter(out)
+	w.SetTimezone(tz)
+	for {
+		entry, err := timeline.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "Reading journals failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := w.WriteEntry(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Writing journal failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// addJournals adds every raw journal recording found under dir to the
+// timeline, named by the path of its directory relative to dir.
+func addJournals(timeline *journal.Timeline, dir string) ([]*os.File, error) {
+	var files []*os.File
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != journalRawFile {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			name = filepath.Base(abs)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		timeline.Add(name, f)
+		return nil
+	})
+	return files, err
+}
+
+func parseJournalTime(s string, tz *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", s, tz)
+}
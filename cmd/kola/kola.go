@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/coreos/go-semver/semver"
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
@@ -41,7 +43,7 @@ var (
 	}
 
 	cmdRun = &cobra.Command{
-		Use:    "run [glob pattern]",
+		Use:    "run [glob pattern...]",
 		Short:  "Run run kola tests by category",
 		Long:   "run all kola tests (default) or related groups",
 		Run:    runRun,
@@ -49,15 +51,21 @@ var (
 	}
 
 	cmdList = &cobra.Command{
-		Use:   "list",
+		Use:   "list [glob pattern...]",
 		Short: "List kola test names",
 		Run:   runList,
 	}
+
+	tagExpr string
 )
 
 func init() {
 	root.AddCommand(cmdRun)
 	root.AddCommand(cmdList)
+
+	for _, cmd := range []*cobra.Command{cmdRun, cmdList} {
+		cmd.Flags().StringVar(&tagExpr, "tags", "", "only select tests matching a tag expression, e.g. 'network && !slow'")
+	}
 }
 
 func main() {
@@ -70,21 +78,16 @@ func preRun(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(3)
 	}
+	kola.LogFormatter = cli.LogFormatter()
 }
 
 func runRun(cmd *cobra.Command, args []string) {
-	if len(args) > 1 {
-		fmt.Fprintf(os.Stderr, "Extra arguements specified. Usage: 'kola run [glob pattern]'\n")
-		os.Exit(2)
-	}
-	var pattern string
-	if len(args) == 1 {
-		pattern = args[0]
-	} else {
-		pattern = "*" // run all tests by default
+	patterns := args
+	if len(patterns) == 0 {
+		patterns = []string{"*"} // run all tests by default
 	}
 
-	err := kola.RunTests(pattern, kolaPlatform, outputDir)
+	err := kola.RunTests(patterns, tagExpr, kolaPlatform, outputDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -92,16 +95,14 @@ func runRun(cmd *cobra.Command, args []string) {
 }
 
 func runList(cmd *cobra.Command, args []string) {
-	var w = tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
-	var testlist list
-
-	for name, test := range register.Tests {
-		testlist = append(testlist, item{name, test.Platforms})
+	testlist, err := listTests(args, tagExpr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
 	}
 
-	sort.Sort(testlist)
-
-	fmt.Fprintln(w, "Test Name\tPlatforms Available")
+	var w = tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "Test Name\tPlatforms Available\tTags\tCluster Size\tVersions")
 	fmt.Fprintln(w, "\t")
 	for _, item := range testlist {
 		fmt.Fprintf(w, "%v\n", item)
@@ -109,16 +110,66 @@ func runList(cmd *cobra.Command, args []string) {
 	w.Flush()
 }
 
+// listTests returns the registered tests matching any of patterns, or
+// all tests if there are none, and the tag expression if set.
+func listTests(patterns []string, tagExpr string) (list, error) {
+	var tags register.TagExpr
+	if tagExpr != "" {
+		var err error
+		if tags, err = register.ParseTagExpr(tagExpr); err != nil {
+			return nil, err
+		}
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	var testlist list
+	for name, test := range register.Tests {
+		match, _, err := kola.MatchPatterns(patterns, name)
+		if err != nil {
+			return nil, err
+		}
+		if !match || (tags != nil && !tags.Match(test.Tags)) {
+			continue
+		}
+		testlist = append(testlist, item{name, test})
+	}
+
+	sort.Sort(testlist)
+	return testlist, nil
+}
+
 type item struct {
-	Name      string
-	Platforms []string
+	Name string
+	Test *register.Test
 }
 
 func (i item) String() string {
-	if len(i.Platforms) == 0 {
-		i.Platforms = []string{"all"}
+	platforms := i.Test.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{"all"}
+	}
+	tags := strings.Join(i.Test.Tags, ",")
+	if tags == "" {
+		tags = "-"
+	}
+	return fmt.Sprintf("%v\t%v\t%v\t%v\t%v", i.Name, platforms, tags, i.Test.ClusterSize, versionRange(i.Test))
+}
+
+// versionRange formats a test's [MinVersion, EndVersion) range.
+func versionRange(t *register.Test) string {
+	var zero semver.Version
+	switch {
+	case t.MinVersion == zero && t.EndVersion == zero:
+		return "all"
+	case t.EndVersion == zero:
+		return fmt.Sprintf(">=%v", t.MinVersion)
+	case t.MinVersion == zero:
+		return fmt.Sprintf("<%v", t.EndVersion)
+	default:
+		return fmt.Sprintf(">=%v <%v", t.MinVersion, t.EndVersion)
 	}
-	return fmt.Sprintf("%v\t%v", i.Name, i.Platforms)
 }
 
 type list []item
@@ -45,8 +45,15 @@ func init() {
 	sv(&kolaPlatform, "platform", "qemu", "VM platform: qemu, gce, aws")
 	root.PersistentFlags().IntVar(&kola.TestParallelism, "parallel", 1, "number of tests to run in parallel")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	bv(&kola.ShowProgress, "progress", false, "show a live view of running tests when output is a terminal")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
 
+	// ssh options
+	sv(&kola.Options.SSH.User, "ssh-user", "core", "user to connect to machines as, created if not core")
+	sv(&kola.Options.SSH.KeyType, "ssh-key-type", "rsa", "type of generated ssh key: rsa, ecdsa, ed25519")
+	root.PersistentFlags().StringSliceVar(&kola.Options.SSH.KeyFiles, "ssh-key", nil, "use the given private key instead of generating one (may be repeated)")
+	bv(&kola.Options.SSH.ForwardAgent, "ssh-forward-agent", false, "also authorize and use the keys in the ssh-agent at SSH_AUTH_SOCK")
+
 	// QEMU-specific options
 	sv(&kola.QEMUOptions.Board, "board", defaultTargetBoard, "target board")
 	sv(&kola.QEMUOptions.DiskImage, "qemu-image", "", "path to CoreOS disk image")
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
@@ -121,6 +122,8 @@ func runSpawn(cmd *cobra.Command, args []string) {
 
 		if spawnVerbose {
 			fmt.Printf("Machine spawned at %v\n", mach.IP())
+			fmt.Printf("Connect with: ssh -o UserKnownHostsFile=%s %s@%s\n",
+				filepath.Join(outputDir, "known_hosts"), kola.Options.SSH.User, mach.IP())
 		}
 
 		if spawnRemove {
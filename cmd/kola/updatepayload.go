@@ -29,6 +29,7 @@ import (
 	"golang.org/x/crypto/ssh/agent"
 
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/network/omaha"
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/machine/qemu"
 	"github.com/coreos/mantle/sdk"
@@ -38,6 +39,8 @@ import (
 var (
 	updateTimeout    time.Duration
 	updatePayload    string
+	updateAdmin      bool
+	updateFaults     []string
 	cmdUpdatePayload = &cobra.Command{
 		Run:    runUpdatePayload,
 		PreRun: preRun,
@@ -109,6 +112,12 @@ func init() {
 	cmdUpdatePayload.Flags().StringVar(
 		&updatePayload, "payload", "",
 		"update payload")
+	cmdUpdatePayload.Flags().BoolVar(
+		&updateAdmin, "omaha-admin", false,
+		"serve the Omaha admin API and status page")
+	cmdUpdatePayload.Flags().StringSliceVar(
+		&updateFaults, "payload-fault", nil,
+		"inject a fault into payload downloads, applied in order, e.g. status=503:times=1 or drop=1048576:times=2 (may be repeated)")
 	root.AddCommand(cmdUpdatePayload)
 }
 
@@ -130,6 +139,15 @@ func runUpdatePayload(cmd *cobra.Command, args []string) {
 }
 
 func runUpdateTest() error {
+	var faults []omaha.Fault
+	for _, spec := range updateFaults {
+		f, err := omaha.ParseFault(spec)
+		if err != nil {
+			return fmt.Errorf("bad payload fault: %v", err)
+		}
+		faults = append(faults, f)
+	}
+
 	outputDir, err := kola.CleanOutputDir(outputDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Setup failed: %v\n", err)
@@ -146,6 +164,12 @@ func runUpdateTest() error {
 	if err := qc.OmahaServer.SetPackage(updatePayload); err != nil {
 		return fmt.Errorf("bad payload: %v", err)
 	}
+	qc.OmahaServer.Payload.SetFaults(faults...)
+
+	if updateAdmin {
+		qc.OmahaServer.EnableAdmin()
+		plog.Noticef("Omaha status at http://%s%s", qc.OmahaServer.Addr(), omaha.AdminPath)
+	}
 
 	cfg, err := newUserdata(qc)
 	if err != nil {
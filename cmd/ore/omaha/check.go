@@ -0,0 +1,133 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/network/omaha"
+	"github.com/coreos/mantle/sdk"
+)
+
+var (
+	cmdCheck = &cobra.Command{
+		Use:   "check --version VERSION",
+		Short: "Check an Omaha server for updates",
+		Long: `Check an Omaha server for updates as update_engine would.
+
+If an update is offered its packages may be downloaded and verified.
+Progress events are only reported to the server with --send-events.
+`,
+		Run: runCheck,
+	}
+
+	checkServer     string
+	checkAppId      string
+	checkVersion    string
+	checkTrack      string
+	checkBoard      string
+	checkMachineID  string
+	checkDeltaOK    bool
+	checkDownload   string
+	checkSendEvents bool
+)
+
+func init() {
+	sv := cmdCheck.Flags().StringVar
+	sv(&checkServer, "server", "https://public.update.core-os.net/v1/update/", "Omaha server URL")
+	sv(&checkAppId, "app-id", sdk.GetDefaultAppId(), "application id")
+	sv(&checkVersion, "version", "", "current version")
+	sv(&checkTrack, "track", "stable", "update group or channel")
+	sv(&checkBoard, "board", "amd64-usr", "board")
+	sv(&checkMachineID, "machine-id", "", "machine id")
+	sv(&checkDownload, "download", "", "download packages to this directory")
+	cmdCheck.Flags().BoolVar(&checkDeltaOK, "delta-ok", false, "accept delta updates")
+	cmdCheck.Flags().BoolVar(&checkSendEvents, "send-events", false, "report download events to the server")
+	Omaha.AddCommand(cmdCheck)
+}
+
+func runCheck(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args: %v\n", args)
+		os.Exit(2)
+	}
+	if checkVersion == "" {
+		fmt.Fprintf(os.Stderr, "--version is required\n")
+		os.Exit(2)
+	}
+
+	c := omaha.NewClient(checkServer, checkAppId, checkVersion)
+	c.App.Track = checkTrack
+	c.App.Board = checkBoard
+	c.App.MachineID = checkMachineID
+	c.App.DeltaOK = checkDeltaOK
+
+	u, err := c.CheckUpdate()
+	if err == omaha.NoUpdate {
+		fmt.Println("No update available")
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Update check failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Update available: %s\n", u.Manifest.Version)
+	for _, url := range u.URLs {
+		fmt.Printf("URL: %s\n", url.CodeBase)
+	}
+	for _, pkg := range u.Manifest.Packages {
+		fmt.Printf("Package: %s size=%d sha1=%s sha256=%s\n",
+			pkg.Name, pkg.Size, pkg.Sha1, pkg.Sha256)
+	}
+	for _, act := range u.Manifest.Actions {
+		if act.IsDeltaPayload {
+			fmt.Printf("Delta payload: %s\n", act.Event)
+		}
+	}
+
+	if checkDownload == "" {
+		return
+	}
+
+	event := func(t omaha.EventType, r omaha.EventResult) {
+		if !checkSendEvents {
+			return
+		}
+		if err := c.Event(t, r); err != nil {
+			plog.Warningf("Reporting %s failed: %v", t, err)
+		}
+	}
+
+	if err := os.MkdirAll(checkDownload, 0777); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	event(omaha.EventTypeUpdateDownloadStarted, omaha.EventResultSuccess)
+	paths, err := c.Download(u, checkDownload)
+	if err != nil {
+		event(omaha.EventTypeUpdateComplete, omaha.EventResultError)
+		fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
+		os.Exit(1)
+	}
+	event(omaha.EventTypeUpdateDownloadFinished, omaha.EventResultSuccess)
+
+	for _, path := range paths {
+		fmt.Printf("Downloaded: %s\n", path)
+	}
+}
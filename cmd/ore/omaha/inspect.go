@@ -0,0 +1,127 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/network/omaha"
+)
+
+var (
+	cmdInspect = &cobra.Command{
+		Use:   "inspect --db PATH [releases|rollouts|clients|log]",
+		Short: "Print the state saved by an Omaha server",
+		Long: `Print the releases, rollout state or client history saved in an
+Omaha server's database as JSON. Without an argument everything is
+printed. The database cannot be read while a server is using it.
+`,
+		Run: runInspect,
+	}
+
+	inspectDB string
+)
+
+func init() {
+	cmdInspect.Flags().StringVar(&inspectDB, "db", "", "server database")
+	Omaha.AddCommand(cmdInspect)
+}
+
+func runInspect(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args: %v\n", args[1:])
+		os.Exit(2)
+	}
+	if inspectDB == "" {
+		fmt.Fprintf(os.Stderr, "--db is required\n")
+		os.Exit(2)
+	}
+
+	store, err := omaha.OpenBoltStoreReadOnly(inspectDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	what := "all"
+	if len(args) == 1 {
+		what = args[0]
+	}
+
+	var v interface{}
+	switch what {
+	case "releases":
+		v, err = store.Releases()
+	case "rollouts":
+		v, err = store.Rollouts()
+	case "clients":
+		v, err = inspectClients(store)
+	case "log":
+		v, err = store.Records(0)
+	case "all":
+		v, err = inspectAll(store)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown state %q\n", what)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reading %s failed: %v\n", inspectDB, err)
+		os.Exit(1)
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(b))
+}
+
+func inspectClients(store omaha.Store) ([]*omaha.ClientStatus, error) {
+	records, err := store.Records(0)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]omaha.Record, len(records))
+	for i, rec := range records {
+		values[i] = *rec
+	}
+	return omaha.ClientStatuses(values), nil
+}
+
+func inspectAll(store omaha.Store) (interface{}, error) {
+	releases, err := store.Releases()
+	if err != nil {
+		return nil, err
+	}
+	rollouts, err := store.Rollouts()
+	if err != nil {
+		return nil, err
+	}
+	clients, err := inspectClients(store)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Releases []*omaha.Release               `json:"releases"`
+		Rollouts map[string]*omaha.RolloutState `json:"rollouts"`
+		Clients  []*omaha.ClientStatus          `json:"clients"`
+	}{releases, rollouts, clients}, nil
+}
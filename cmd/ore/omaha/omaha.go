@@ -0,0 +1,40 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/cli"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "ore/omaha")
+
+	Omaha = &cobra.Command{
+		Use:   "omaha [command]",
+		Short: "omaha update protocol utilities",
+	}
+)
+
+func init() {
+	// Replace ore's pre-run hook, no cloud credentials are needed, and
+	// set up the logging it would have started.
+	cli.WrapPreRun(Omaha, func(cmd *cobra.Command, args []string) error {
+		cli.StartLogging(cmd)
+		return nil
+	})
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/mantle/network/omaha"
+	"github.com/coreos/mantle/sdk"
+	sdkomaha "github.com/coreos/mantle/sdk/omaha"
+)
+
+var (
+	cmdServe = &cobra.Command{
+		Use:   "serve [options] IMAGE_DIR...",
+		Short: "Serve update payloads to update_engine",
+		Long: `Serve the update payloads in one or more image directories, such as
+those under src/build/images in the SDK, to machines running
+update_engine. Each directory must hold coreos_production_update.xml and
+its payload, as written by image_to_vm.sh or kola updatepayload.
+
+Machines are offered the newest version above their own. Point them at
+the server by setting SERVER=http://HOST:PORT/v1/update/ in
+/etc/coreos/update.conf and running update_engine_client -check_for_update.
+`,
+		Run: runServe,
+	}
+
+	serveAddress     string
+	serveAppId       string
+	serveTracks      []string
+	serveBoard       string
+	serveTLSCert     string
+	serveTLSKey      string
+	serveTLSClientCA string
+	serveStrict      bool
+	serveAdmin       bool
+	serveDB          string
+	serveMirrors     mirrorList
+	serveRegionHdr   string
+)
+
+func init() {
+	sv := cmdServe.Flags().StringVar
+	sv(&serveAddress, "address", ":34567", "address to listen on")
+	sv(&serveAppId, "app-id", sdk.GetDefaultAppId(), "application id for manifests without one")
+	sv(&serveBoard, "board", "", "only offer updates to this board")
+	sv(&serveTLSCert, "tls-cert", "", "serve HTTPS using this PEM certificate")
+	sv(&serveTLSKey, "tls-key", "", "PEM private key for --tls-cert")
+	sv(&serveTLSClientCA, "tls-client-ca", "", "require client certificates signed by this PEM CA")
+	sv(&serveDB, "db", "", "save releases, rollouts and client history in this database")
+	sv(&serveRegionHdr, "region-header", "", "request header holding the client's region")
+	cmdServe.Flags().StringSliceVar(&serveTracks, "track", nil, "only offer updates on these tracks")
+	cmdServe.Flags().Var(&serveMirrors, "mirror", "also offer payloads from [REGION=]URL_PREFIX[,WEIGHT] (may be repeated)")
+	cmdServe.Flags().BoolVar(&serveStrict, "strict", false, "reject malformed requests")
+	cmdServe.Flags().BoolVar(&serveAdmin, "admin", false, "enable the unauthenticated admin API under /admin/")
+	Omaha.AddCommand(cmdServe)
+}
+
+// mirrorList collects repeated --mirror flags. Mirrors with a region
+// are only offered to clients whose --region-header matches it.
+type mirrorList []omaha.Mirror
+
+func (l *mirrorList) String() string {
+	var s []string
+	for _, m := range *l {
+		s = append(s, m.URL)
+	}
+	return strings.Join(s, " ")
+}
+
+func (l *mirrorList) Type() string {
+	return "mirror"
+}
+
+func (l *mirrorList) Set(value string) error {
+	m, err := omaha.ParseMirror(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, m)
+	return nil
+}
+
+func serveTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(serveTLSCert, serveTLSKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if serveTLSClientCA != "" {
+		pem, err := ioutil.ReadFile(serveTLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", serveTLSClientCA)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && serveDB == "" {
+		fmt.Fprintf(os.Stderr, "At least one image directory or --db is required\n")
+		os.Exit(2)
+	}
+	if (serveTLSCert == "") != (serveTLSKey == "") {
+		fmt.Fprintf(os.Stderr, "--tls-cert and --tls-key must be used together\n")
+		os.Exit(2)
+	}
+	if serveTLSClientCA != "" && serveTLSCert == "" {
+		fmt.Fprintf(os.Stderr, "--tls-client-ca requires --tls-cert\n")
+		os.Exit(2)
+	}
+	if serveRegionHdr != "" && len(serveMirrors) == 0 {
+		fmt.Fprintf(os.Stderr, "--region-header requires --mirror\n")
+		os.Exit(2)
+	}
+
+	// exit only once the server and database are closed
+	if err := serve(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func serve(dirs []string) error {
+	var tlsConfig *tls.Config
+	if serveTLSCert != "" {
+		var err error
+		if tlsConfig, err = serveTLSConfig(); err != nil {
+			return fmt.Errorf("Loading TLS configuration failed: %v", err)
+		}
+	}
+
+	catalog := &omaha.Catalog{}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		release := &omaha.Release{
+			AppId:   serveAppId,
+			Tracks:  serveTracks,
+			Board:   serveBoard,
+			Updates: []string{sdkomaha.UpdateManifestPath(abs)},
+		}
+		if err := catalog.AddRelease(release); err != nil {
+			return fmt.Errorf("Loading %s failed: %v", dir, err)
+		}
+	}
+
+	var updater omaha.Updater = catalog
+	if serveDB != "" {
+		updater = omaha.NewRolloutUpdater(updater)
+	}
+	if len(serveMirrors) != 0 {
+		mu := omaha.NewMirrorUpdater(updater, serveMirrors...)
+		mu.RegionHeader = serveRegionHdr
+		mu.Fallback = true
+		updater = mu
+	}
+
+	s, err := omaha.NewServer(serveAddress, updater)
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	s.Mux.Handle(omaha.CatalogPath, catalog)
+	s.SetStrict(serveStrict)
+	if serveAdmin {
+		s.EnableAdmin()
+	} else if serveDB != "" {
+		s.Updater = omaha.NewRecordingUpdater(s.Updater)
+	}
+
+	if serveDB != "" {
+		store, err := omaha.OpenBoltStore(serveDB)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if err := omaha.UseStore(s, store); err != nil {
+			return fmt.Errorf("Loading %s failed: %v", serveDB, err)
+		}
+	}
+
+	for _, u := range catalog.Updates() {
+		plog.Noticef("Offering %s version %s", u.Id, u.Version)
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	plog.Noticef("Serving %s://%s/v1/update/", scheme, s.Addr())
+
+	errc := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			errc <- s.ServeTLS(tlsConfig)
+		} else {
+			errc <- s.Serve()
+		}
+	}()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-sigc:
+		plog.Noticef("Received %v, shutting down", sig)
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("Server failed: %v", err)
+		}
+	}
+	return nil
+}
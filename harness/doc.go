@@ -112,4 +112,25 @@
 //		fmt.Println("PASS")
 //	}
 //
+// Fixtures
+//
+// Expensive resources can be shared between top-level tests by registering
+// a Fixture with the Suite along with the names of the tests that use it.
+// The fixture is constructed by the first test to call the Fixture method
+// of H and torn down after the last of the declared tests finishes:
+//
+//	suite.AddFixture("server", harness.Fixture{
+//		Setup: func() (interface{}, error) {
+//			return startServer()
+//		},
+//		Teardown: func(v interface{}) error {
+//			return v.(*Server).Close()
+//		},
+//	}, "SomeTest", "OtherTest")
+//
+//	func SomeTest(h *harness.H) {
+//		server := h.Fixture("server").(*Server)
+//		...
+//	}
+//
 package harness
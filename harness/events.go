@@ -0,0 +1,87 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"time"
+)
+
+// EventType describes a change in the state of a test.
+type EventType int
+
+const (
+	// EventQueued is sent when a parallel test is waiting for its
+	// turn to run.
+	EventQueued EventType = iota
+
+	// EventRunning is sent when a test starts or resumes executing.
+	EventRunning
+
+	// EventFinished is sent once a test and all of its subtests
+	// have completed.
+	EventFinished
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventQueued:
+		return "QUEUED"
+	case EventRunning:
+		return "RUNNING"
+	case EventFinished:
+		return "FINISHED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Event is sent to listeners whenever a test changes state.
+type Event struct {
+	Type EventType
+	Name string
+	Time time.Time
+
+	// Result is one of PASS, FAIL, or SKIP for EventFinished.
+	Result string
+}
+
+// Listener receives test events. Listeners are called synchronously from
+// the goroutines running tests so they must not block.
+type Listener func(Event)
+
+// AddListener registers a function to receive test events. It must be
+// called before Run.
+func (s *Suite) AddListener(l Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *Suite) emit(typ EventType, h *H) {
+	if len(s.listeners) == 0 {
+		return
+	}
+
+	e := Event{
+		Type: typ,
+		Name: h.name,
+		Time: time.Now(),
+	}
+	if typ == EventFinished {
+		e.Result = h.result()
+	}
+
+	for _, l := range s.listeners {
+		l(e)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	var mu sync.Mutex
+	events := make(map[string][]string)
+	listener := func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		s := e.Type.String()
+		if e.Result != "" {
+			s += " " + e.Result
+		}
+		events[e.Name] = append(events[e.Name], s)
+	}
+
+	suite := NewSuite(Options{Parallel: 1}, Tests{
+		"Serial": func(h *H) {},
+		"Parallel": func(h *H) {
+			h.Parallel()
+			h.Fail()
+		},
+		"Skipped": func(h *H) {
+			h.Run("Sub", func(h *H) {})
+			h.Skip("skip")
+		},
+	})
+	suite.AddListener(listener)
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Log("\n" + buf.String())
+		t.Errorf("expected %v, got %v", SuiteFailed, err)
+	}
+
+	expect := map[string][]string{
+		"Serial":      {"RUNNING", "FINISHED PASS"},
+		"Parallel":    {"RUNNING", "QUEUED", "RUNNING", "FINISHED FAIL"},
+		"Skipped":     {"RUNNING", "FINISHED SKIP"},
+		"Skipped/Sub": {"RUNNING", "FINISHED PASS"},
+	}
+	if !reflect.DeepEqual(events, expect) {
+		t.Errorf("got %v wanted %v", events, expect)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Fixture is an expensive resource shared by a set of tests. It is
+// constructed lazily by the first test that requests it with H.Fixture
+// and torn down once every test declared to use it has finished.
+type Fixture struct {
+	// Setup constructs the fixture's value.
+	Setup func() (interface{}, error)
+
+	// Teardown, if not nil, releases the value returned by Setup.
+	Teardown func(value interface{}) error
+}
+
+// fixtureState tracks a Fixture's lifetime within a Suite.
+type fixtureState struct {
+	Fixture
+	name  string
+	users map[string]bool
+
+	mu      sync.Mutex
+	pending int  // Number of users that have not finished.
+	setup   bool // Setup has been called.
+	value   interface{}
+	err     error
+}
+
+// AddFixture registers a fixture with the Suite along with the names of
+// the top level tests that use it. Subtests may use the fixtures of
+// their parent tests. AddFixture must be called before Run and panics
+// if a fixture with the given name already exists.
+func (s *Suite) AddFixture(name string, fixture Fixture, tests ...string) {
+	if _, ok := s.fixtures[name]; ok {
+		panic(fmt.Errorf("harness: duplicate fixture %q", name))
+	}
+	if fixture.Setup == nil {
+		panic(fmt.Errorf("harness: fixture %q has no Setup", name))
+	}
+
+	f := &fixtureState{
+		Fixture: fixture,
+		name:    name,
+		users:   make(map[string]bool),
+	}
+	for _, test := range tests {
+		f.users[test] = true
+	}
+	s.fixtures[name] = f
+}
+
+// Fixture returns the value of the named fixture, constructing it if this
+// is the first use. The test fails immediately if the fixture does not
+// exist, was not declared for this test, or could not be constructed.
+func (h *H) Fixture(name string) interface{} {
+	f, ok := h.suite.fixtures[name]
+	if !ok {
+		h.Fatalf("harness: unknown fixture %q", name)
+	}
+
+	if !f.users[h.topLevel().name] {
+		h.Fatalf("harness: fixture %q not declared for test", name)
+	}
+
+	f.mu.Lock()
+	if !f.setup {
+		f.setup = true
+		f.value, f.err = f.Setup()
+	}
+	value, err := f.value, f.err
+	f.mu.Unlock()
+
+	if err != nil {
+		h.Fatalf("harness: fixture %q setup failed: %v", name, err)
+	}
+	return value
+}
+
+// topLevel returns the test's ancestor directly under the suite root.
+func (h *H) topLevel() *H {
+	for h.parent != nil && h.parent.parent != nil {
+		h = h.parent
+	}
+	return h
+}
+
+// initFixtures counts the tests that will run for each fixture.
+func (s *Suite) initFixtures(tests []string) {
+	for _, f := range s.fixtures {
+		for _, name := range tests {
+			if f.users[name] {
+				f.pending++
+			}
+		}
+	}
+}
+
+// releaseFixtures is called when a top level test has finished, tearing
+// down any fixtures for which it was the last user.
+func (s *Suite) releaseFixtures(h *H) {
+	for _, f := range s.fixtures {
+		if !f.users[h.name] {
+			continue
+		}
+
+		f.mu.Lock()
+		f.pending--
+		last := f.pending == 0
+		f.mu.Unlock()
+
+		if last {
+			if err := f.teardown(); err != nil {
+				h.Errorf("harness: fixture %q teardown failed: %v", f.name, err)
+			}
+		}
+	}
+}
+
+// teardownFixtures releases any fixtures left over when the suite ends,
+// such as when their last user never finished. Failures are written to
+// out and reported as false.
+func (s *Suite) teardownFixtures(out io.Writer) bool {
+	ok := true
+	for _, f := range s.fixtures {
+		if err := f.teardown(); err != nil {
+			fmt.Fprintf(out, "harness: fixture %q teardown failed: %v\n", f.name, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (f *fixtureState) teardown() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.setup || f.err != nil {
+		return nil
+	}
+
+	value := f.value
+	f.setup = false
+	f.value = nil
+	if f.Teardown == nil {
+		return nil
+	}
+	return f.Teardown(value)
+}
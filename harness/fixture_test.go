@@ -0,0 +1,140 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFixture(t *testing.T) {
+	var setups, teardowns, uses int32
+	fixture := Fixture{
+		Setup: func() (interface{}, error) {
+			atomic.AddInt32(&setups, 1)
+			return "value", nil
+		},
+		Teardown: func(value interface{}) error {
+			if value != "value" {
+				t.Errorf("teardown got %v", value)
+			}
+			if n := atomic.LoadInt32(&uses); n != 3 {
+				t.Errorf("teardown after %d uses, expected 3", n)
+			}
+			atomic.AddInt32(&teardowns, 1)
+			return nil
+		},
+	}
+
+	use := func(h *H) {
+		h.Parallel()
+		if v := h.Fixture("fixture"); v != "value" {
+			h.Errorf("got %v", v)
+		}
+		atomic.AddInt32(&uses, 1)
+	}
+	suite := NewSuite(Options{Parallel: 2}, Tests{
+		"First":  use,
+		"Second": use,
+		"Sub": func(h *H) {
+			h.Run("Child", use)
+		},
+		"Unused": func(h *H) {},
+	})
+	suite.AddFixture("fixture", fixture, "First", "Second", "Sub")
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	if setups != 1 || teardowns != 1 {
+		t.Errorf("%d setups and %d teardowns, expected 1 each", setups, teardowns)
+	}
+}
+
+func TestFixtureErrors(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{
+		"Undeclared": func(h *H) {
+			h.Fixture("fixture")
+		},
+		"Unknown": func(h *H) {
+			h.Fixture("missing")
+		},
+		"SetupFails": func(h *H) {
+			h.Fixture("fixture")
+		},
+	})
+	suite.AddFixture("fixture", Fixture{
+		Setup: func() (interface{}, error) {
+			return nil, errors.New("broken")
+		},
+		Teardown: func(value interface{}) error {
+			t.Errorf("teardown called after setup failure")
+			return nil
+		},
+	}, "SetupFails")
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Errorf("expected %v, got %v", SuiteFailed, err)
+	}
+
+	out := buf.String()
+	for _, expect := range []string{
+		"--- FAIL: Undeclared",
+		`fixture "fixture" not declared for test`,
+		"--- FAIL: Unknown",
+		`unknown fixture "missing"`,
+		"--- FAIL: SetupFails",
+		`fixture "fixture" setup failed: broken`,
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("output missing %q:\n%s", expect, out)
+		}
+	}
+}
+
+func TestFixtureLeftoverTeardown(t *testing.T) {
+	suite := NewSuite(Options{}, Tests{})
+	suite.AddFixture("fixture", Fixture{
+		Setup: func() (interface{}, error) {
+			return "value", nil
+		},
+		Teardown: func(value interface{}) error {
+			return errors.New("broken")
+		},
+	}, "Abandoned")
+
+	// a user that never finished leaves the fixture set up
+	f := suite.fixtures["fixture"]
+	f.setup = true
+	f.value = "value"
+
+	buf := &bytes.Buffer{}
+	if suite.teardownFixtures(buf) {
+		t.Errorf("teardown failure not reported")
+	}
+	if expect := `fixture "fixture" teardown failed: broken`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("output missing %q:\n%s", expect, buf.String())
+	}
+	if f.setup {
+		t.Errorf("fixture still set up")
+	}
+}
@@ -64,6 +64,8 @@ type H struct {
 	signal   chan bool // To signal a test is done.
 	sub      []*H      // Queue of subtests to be run in parallel.
 
+	artifacts []string // Files recorded by AddArtifact.
+
 	isParallel bool
 }
 
@@ -356,9 +358,11 @@ func (t *H) Parallel() {
 	// Add to the list of tests to be released by the parent.
 	t.parent.sub = append(t.parent.sub, t)
 
+	t.suite.emit(EventQueued, t)
 	t.signal <- true   // Release calling test.
 	<-t.parent.barrier // Wait for the parent test to complete.
 	t.suite.waitParallel()
+	t.suite.emit(EventRunning, t)
 	t.start = time.Now()
 }
 
@@ -402,7 +406,13 @@ func tRunner(t *H, fn func(t *H)) {
 			// test. See comment in Run method.
 			t.suite.release()
 		}
+		if t.parent != nil && t.parent.parent == nil {
+			t.suite.releaseFixtures(t)
+		}
 		t.report() // Report after all subtests have finished.
+		if t.parent != nil {
+			t.suite.emit(EventFinished, t)
+		}
 
 		// Do not lock t.done to allow race detector to detect race in case
 		// the user does not appropriately synchronizes a goroutine.
@@ -414,6 +424,9 @@ func tRunner(t *H, fn func(t *H)) {
 	}()
 
 	t.start = time.Now()
+	if t.parent != nil {
+		t.suite.emit(EventRunning, t)
+	}
 	fn(t)
 	t.finished = true
 }
@@ -460,6 +473,7 @@ func (t *H) report() {
 	if t.parent == nil {
 		return
 	}
+	t.suite.addResult(t)
 	dstr := fmtDuration(t.duration)
 	format := "--- %s: %s (%s)\n"
 	if t.Failed() {
@@ -487,3 +487,57 @@ func TestTempFile(t *testing.T) {
 		t.Errorf("%q missing %q prefix", second, "second")
 	}
 }
+
+func TestArtifacts(t *testing.T) {
+	var suitedir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+	}
+
+	opts := Options{
+		OutputDir: suitedir,
+		Verbose:   true,
+	}
+	suite := NewSuite(opts, Tests{
+		"Artifacts": func(h *H) {
+			f := h.TempFile("artifact")
+			f.Close()
+			h.AddArtifact(f.Name())
+			h.AddArtifact("/outside/file")
+		},
+		"Skipped": func(h *H) {
+			h.Skip("skip")
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	results := suite.Results()
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results: %v", results)
+	}
+	if results[0].Name != "Artifacts" || results[0].Result != "PASS" {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+	if results[1].Name != "Skipped" || results[1].Result != "SKIP" {
+		t.Errorf("unexpected result: %+v", results[1])
+	}
+
+	artifacts := results[0].Artifacts
+	if len(artifacts) != 2 {
+		t.Fatalf("expected 2 artifacts: %v", artifacts)
+	}
+	if dir := filepath.Dir(artifacts[0]); dir != "Artifacts" {
+		t.Errorf("%q not relative to the output dir", artifacts[0])
+	}
+	if artifacts[1] != "/outside/file" {
+		t.Errorf("%q != %q", artifacts[1], "/outside/file")
+	}
+}
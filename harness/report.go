@@ -0,0 +1,111 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of a single test or subtest as recorded in the
+// suite's report.json file.
+type Result struct {
+	Name     string        `json:"name"`
+	Result   string        `json:"result"` // PASS, FAIL, or SKIP
+	Duration time.Duration `json:"duration"`
+
+	// Artifacts lists files saved by the test, relative to the
+	// suite's output directory.
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// AddArtifact records a file saved by the test so it is listed in the
+// suite report. Paths under the suite's output directory are recorded
+// relative to it. AddArtifact may be called from multiple goroutines.
+func (h *H) AddArtifact(path string) {
+	rel, err := filepath.Rel(h.suite.opts.OutputDir, path)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		path = rel
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.artifacts = append(h.artifacts, path)
+}
+
+// Artifacts returns the list of files recorded by AddArtifact.
+func (h *H) Artifacts() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]string(nil), h.artifacts...)
+}
+
+// result summarizes the test's state as PASS, FAIL, or SKIP.
+func (h *H) result() string {
+	if h.Failed() {
+		return "FAIL"
+	} else if h.Skipped() {
+		return "SKIP"
+	}
+	return "PASS"
+}
+
+// addResult records the final state of a test.
+func (s *Suite) addResult(h *H) {
+	r := Result{
+		Name:      h.name,
+		Result:    h.result(),
+		Duration:  h.duration,
+		Artifacts: h.Artifacts(),
+	}
+
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.results = append(s.results, r)
+}
+
+// Results returns the results of all tests that have completed, sorted
+// by name.
+func (s *Suite) Results() []Result {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	results := append(resultList(nil), s.results...)
+	sort.Sort(results)
+	return results
+}
+
+type resultList []Result
+
+func (r resultList) Len() int           { return len(r) }
+func (r resultList) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r resultList) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+// writeReport saves the test results to report.json.
+func (s *Suite) writeReport() error {
+	f, err := os.Create(s.outputPath("report.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Tests []Result `json:"tests"`
+	}{s.Results()})
+}
@@ -70,6 +70,9 @@ type Options struct {
 
 	// Limit number of tests to run in parallel (0 means GOMAXPROCS).
 	Parallel int
+
+	// Write test output to the given writer (nil means os.Stdout).
+	Output io.Writer
 }
 
 // FlagSet can be used to setup options via command line flags.
@@ -118,14 +121,18 @@ func (o *Options) init() {
 	if o.Parallel < 1 {
 		o.Parallel = runtime.GOMAXPROCS(0)
 	}
+	if o.Output == nil {
+		o.Output = os.Stdout
+	}
 }
 
 // Suite is a type passed to a TestMain function to run the actual tests.
 // Suite manages the execution of a set of test functions.
 type Suite struct {
-	opts  Options
-	tests Tests
-	match *matcher
+	opts     Options
+	tests    Tests
+	fixtures map[string]*fixtureState
+	match    *matcher
 
 	// mu protects the following fields which are used to manage
 	// parallel test execution.
@@ -140,6 +147,13 @@ type Suite struct {
 
 	// waiting is the number tests waiting to be run in parallel.
 	waiting int
+
+	// listeners receive test events, see AddListener.
+	listeners []Listener
+
+	// resultsMu protects results, the outcome of each finished test.
+	resultsMu sync.Mutex
+	results   []Result
 }
 
 func (c *Suite) waitParallel() {
@@ -173,6 +187,7 @@ func NewSuite(opts Options, tests Tests) *Suite {
 	return &Suite{
 		opts:          opts,
 		tests:         tests,
+		fixtures:      make(map[string]*fixtureState),
 		match:         newMatcher(opts.Match, "Match"),
 		startParallel: make(chan bool),
 	}
@@ -253,10 +268,14 @@ func (s *Suite) Run() (err error) {
 		defer timer.Stop()
 	}
 
-	return s.runTests(os.Stdout, tap)
+	err = s.runTests(s.opts.Output, tap)
+	if err2 := s.writeReport(); err == nil && err2 != nil {
+		err = err2
+	}
+	return err
 }
 
-func (s *Suite) runTests(out, tap io.Writer) error {
+func (s *Suite) runTests(out, tap io.Writer) (err error) {
 	s.running = 1 // Set the count to 1 for the main (sequential) test.
 	t := &H{
 		signal:  make(chan bool),
@@ -265,9 +284,24 @@ func (s *Suite) runTests(out, tap io.Writer) error {
 		tap:     tap,
 		suite:   s,
 	}
+	// Run tests in a stable order and work out which of them will
+	// actually run so fixtures can be torn down after their last user.
+	var names []string
+	for _, name := range s.tests.List() {
+		if _, ok := s.match.fullName(t, name); ok {
+			names = append(names, name)
+		}
+	}
+	s.initFixtures(names)
+	defer func() {
+		if !s.teardownFixtures(out) && err == nil {
+			err = SuiteFailed
+		}
+	}()
+
 	tRunner(t, func(t *H) {
-		for name, test := range s.tests {
-			t.Run(name, test)
+		for _, name := range names {
+			t.Run(name, s.tests[name])
 		}
 		// Run catching the signal rather than the tRunner as a separate
 		// goroutine to avoid adding a goroutine during the sequential
@@ -15,10 +15,13 @@
 package cluster
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/coreos/mantle/harness"
 	"github.com/coreos/mantle/kola/skip"
 	"github.com/coreos/mantle/platform"
 )
@@ -29,9 +32,37 @@ type TestCluster struct {
 	Name        string
 	NativeFuncs []string
 	Options     map[string]string
+
+	*harness.H
 	platform.Cluster
 }
 
+// Run runs f as a subtest against the same cluster and reports whether
+// it succeeded. Fatal and Skip called within f only end the subtest.
+func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
+	return t.H.Run(name, func(h *harness.H) {
+		tc := *t
+		tc.H = h
+
+		// Translate the panics raised by Fatal and Skip into the
+		// harness equivalents which only stop this goroutine.
+		defer func() {
+			switch r := recover().(type) {
+			case nil:
+				// no-op
+			case skip.Skip:
+				h.Skip(r)
+			case error:
+				h.Fatal(r)
+			default:
+				h.Fatalf("test panicked: %v", r)
+			}
+		}()
+
+		f(tc)
+	})
+}
+
 // RunNative runs a registered NativeFunc on a remote machine
 func (t *TestCluster) RunNative(funcName string, m platform.Machine) error {
 	// scp and execute kolet on remote machine
@@ -62,23 +93,97 @@ func (t *TestCluster) ListNativeFunctions() []string {
 	return t.NativeFuncs
 }
 
-// DropFile places file from localPath to ~/ on every machine in cluster
+// DropFile places the file or directory from localPath in ~/ on every
+// machine in cluster, keeping its permissions.
 func (t *TestCluster) DropFile(localPath string) error {
-	in, err := os.Open(localPath)
+	for _, m := range t.Machines() {
+		if err := platform.CopyTo(m, localPath, filepath.Base(localPath), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveArtifact writes the contents of r to the named file under the
+// test's output directory and records it in the test report. The name
+// may include subdirectories, which are created as needed.
+func (t *TestCluster) SaveArtifact(name string, r io.Reader) error {
+	path := filepath.Join(t.OutputDir(), filepath.Clean("/"+name))
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("saving artifact %s: %v", name, err)
+	}
+
+	t.AddArtifact(path)
+	return nil
+}
+
+// CollectFromMachine copies remotePath from machine m into the test's
+// output directory as the artifact "<machine id>/<remotePath>".
+func (t *TestCluster) CollectFromMachine(m platform.Machine, remotePath string) error {
+	in, err := platform.ReadFile(m, remotePath)
 	if err != nil {
 		return err
 	}
-	defer in.Close()
 
+	// ReadFile only reports errors from the remote cat when closed so
+	// buffer the contents instead of saving a partial file.
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, in)
+	if err2 := in.Close(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s from %s: %v", remotePath, m.ID(), err)
+	}
+
+	return t.SaveArtifact(filepath.Join(m.ID(), remotePath), &buf)
+}
+
+// collectCommands are run on every machine when a test fails, the output
+// of each is saved as "<machine id>/<name>".
+var collectCommands = []struct {
+	name string
+	cmd  string
+}{
+	{"journalctl.txt", "journalctl --no-pager --output=short-precise"},
+	{"systemctl-failed.txt", "systemctl --no-pager --failed"},
+	{"dmesg.txt", "dmesg"},
+}
+
+// CollectDefaultArtifacts saves the journal, failed units, kernel log and
+// /etc/os-release from every machine in the cluster. Errors are logged
+// rather than returned so one unreachable machine doesn't prevent
+// collecting from the others.
+func (t *TestCluster) CollectDefaultArtifacts() {
 	for _, m := range t.Machines() {
-		if _, err := in.Seek(0, 0); err != nil {
-			return err
+		for _, c := range collectCommands {
+			out, err := m.SSH(c.cmd)
+			if err != nil {
+				t.Logf("collecting %s from %s: %v", c.name, m.ID(), err)
+				if len(out) == 0 {
+					continue
+				}
+			}
+			name := filepath.Join(m.ID(), c.name)
+			if err := t.SaveArtifact(name, bytes.NewReader(out)); err != nil {
+				t.Logf("saving %s: %v", name, err)
+			}
 		}
-		if err := platform.InstallFile(in, m, filepath.Base(localPath)); err != nil {
-			return err
+
+		if err := t.CollectFromMachine(m, "/etc/os-release"); err != nil {
+			t.Logf("collecting /etc/os-release from %s: %v", m.ID(), err)
 		}
 	}
-	return nil
 }
 
 // Fatal, Fatalf, Skip, and Skipf partially implement testing.TB.
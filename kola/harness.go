@@ -49,8 +49,30 @@ var (
 
 	TestParallelism int    //glue var to set test parallelism from main
 	TAPFile         string // if not "", write TAP results here
+	ShowProgress    bool   // glue var to enable the live progress view from main
+
+	// LogFormatter is restored when the live progress view stops
+	// routing log messages, capnslog's default is used if nil.
+	LogFormatter capnslog.Formatter
 
 	testOptions = make(map[string]string, 0)
+
+	// clusters shared between tests with identical userdata
+	sharedClusters clusterPool
+
+	// status of the current RunTests call
+	runProgress *progress
+
+	// extra platforms added by RegisterTestPlatform
+	testPlatforms = map[string]func(outputDir string) (platform.Cluster, error){}
+)
+
+const (
+	// upper bound of the random delay before each test starts
+	startSplay = 2 * time.Second
+
+	// time allowed for remote journals to catch up after a failed test
+	journalFlushDelay = 2 * time.Second
 )
 
 // RegisterTestOption registers any options that need visibility inside
@@ -64,16 +86,27 @@ func RegisterTestOption(name, option string) {
 	testOptions[name] = option
 }
 
+// RegisterTestPlatform makes a platform available to RunTest and
+// RunTests so kola tests can be unit tested with go test, typically
+// against clusters from platform/machine/fake. Tests on these platforms
+// neither start with a random delay to spread out cloud API requests
+// nor wait for remote journals to be flushed when they fail.
+// Registering a name again replaces it. Must not be called while tests
+// are running.
+func RegisterTestPlatform(name string, newCluster func(outputDir string) (platform.Cluster, error)) {
+	testPlatforms[name] = newCluster
+}
+
 // NativeRunner is a closure passed to all kola test functions and used
 // to run native go functions directly on kola machines. It is necessary
 // glue until kola does introspection.
 type NativeRunner func(funcName string, m platform.Machine) error
 
-func filterTests(tests map[string]*register.Test, pattern, platform string, version semver.Version) (map[string]*register.Test, error) {
+func filterTests(tests map[string]*register.Test, patterns []string, tags register.TagExpr, platform string, version semver.Version) (map[string]*register.Test, error) {
 	r := make(map[string]*register.Test)
 
 	for name, t := range tests {
-		match, err := filepath.Match(pattern, t.Name)
+		match, exact, err := MatchPatterns(patterns, t.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -81,8 +114,12 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 			continue
 		}
 
+		if tags != nil && !tags.Match(t.Tags) {
+			continue
+		}
+
 		// Check the test's min and end versions when running more then one test
-		if t.Name != pattern && versionOutsideRange(version, t.MinVersion, t.EndVersion) {
+		if !exact && versionOutsideRange(version, t.MinVersion, t.EndVersion) {
 			continue
 		}
 
@@ -105,6 +142,25 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 	return r, nil
 }
 
+// MatchPatterns checks name against a list of glob patterns. The name
+// matches if any of the patterns match and is considered an exact match
+// if one of the patterns is the name itself.
+func MatchPatterns(patterns []string, name string) (match, exact bool, err error) {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true, true, nil
+		}
+		m, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, false, err
+		}
+		if m {
+			match = true
+		}
+	}
+	return match, false, nil
+}
+
 // versionOutsideRange checks to see if version is outside [min, end). If end
 // is a zero value, it is ignored and there is no upper bound. If version is a
 // zero value, the bounds are ignored.
@@ -125,30 +181,35 @@ func versionOutsideRange(version, minVersion, endVersion semver.Version) bool {
 }
 
 // RunTests is a harness for running multiple tests in parallel. Filters
-// tests based on a glob pattern and by platform. Has access to all
-// tests either registered in this package or by imported packages that
-// register tests in their init() function.
+// tests based on glob patterns, an optional tag expression, and by
+// platform. Has access to all tests either registered in this package
+// or by imported packages that register tests in their init() function.
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. If it already exists it will be erased!
-func RunTests(pattern, pltfrm, outputDir string) error {
+func RunTests(patterns []string, tagExpr, pltfrm, outputDir string) error {
+	var tags register.TagExpr
+	if tagExpr != "" {
+		var err error
+		if tags, err = register.ParseTagExpr(tagExpr); err != nil {
+			return err
+		}
+	}
+
 	// Avoid incurring cost of starting machine in getClusterSemver when
 	// either:
 	// 1) we already know 0 tests will run
-	// 2) glob is an exact match which means minVersion will be ignored
-	//    either way
-	tests, err := filterTests(register.Tests, pattern, pltfrm, semver.Version{})
+	// 2) all tests are exact matches which means minVersion will be
+	//    ignored either way
+	tests, err := filterTests(register.Tests, patterns, tags, pltfrm, semver.Version{})
 	if err != nil {
 		plog.Fatal(err)
 	}
 
-	var skipGetVersion bool
-	if len(tests) == 0 {
-		skipGetVersion = true
-	} else if len(tests) == 1 {
-		for name := range tests {
-			if name == pattern {
-				skipGetVersion = true
-			}
+	skipGetVersion := true
+	for name := range tests {
+		if _, exact, _ := MatchPatterns(patterns, name); !exact {
+			skipGetVersion = false
+			break
 		}
 	}
 
@@ -159,16 +220,33 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 		}
 
 		// one more filter pass now that we know real version
-		tests, err = filterTests(tests, pattern, pltfrm, *version)
+		tests, err = filterTests(tests, patterns, tags, pltfrm, *version)
 		if err != nil {
 			plog.Fatal(err)
 		}
 	}
 
+	return runTests(tests, pltfrm, outputDir)
+}
+
+// RunTest runs a single test without registering it. It is used by
+// binaries that aim to run one test, such as kola etcdupgrade, so the
+// test's 'Platforms' and 'MinVersion' are not respected. outputDir is
+// where test logs and data will be written.
+func RunTest(t *register.Test, pltfrm, outputDir string) error {
+	return runTests(map[string]*register.Test{t.Name: t}, pltfrm, outputDir)
+}
+
+// runTests runs tests in parallel under a harness suite.
+func runTests(tests map[string]*register.Test, pltfrm, outputDir string) error {
+	runProgress = newProgress(outputDir, ShowProgress)
+	defer func() { runProgress = nil }()
+
 	opts := harness.Options{
 		OutputDir: outputDir,
 		Parallel:  TestParallelism,
 		Verbose:   true,
+		Output:    runProgress.Output(),
 	}
 	var htests harness.Tests
 	for _, test := range tests {
@@ -179,11 +257,12 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 			// don't go too fast, in case we're talking to a rate limiting api like AWS EC2.
 			// FIXME(marineam): API requests must do their own
 			// backoff due to rate limiting, this is unreliable.
-			max := int64(2 * time.Second)
-			splay := time.Duration(rand.Int63n(max))
-			time.Sleep(splay)
+			if _, ok := testPlatforms[pltfrm]; !ok {
+				splay := time.Duration(rand.Int63n(int64(startSplay)))
+				time.Sleep(splay)
+			}
 
-			err := RunTest(test, pltfrm, outputDir)
+			err := runTest(h, test, pltfrm)
 			if _, ok := err.(skip.Skip); ok {
 				h.Skip(err)
 			} else if err != nil {
@@ -194,7 +273,11 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 	}
 
 	suite := harness.NewSuite(opts, htests)
-	err = suite.Run()
+	suite.AddListener(runProgress.Event)
+	runProgress.Start()
+	err := suite.Run()
+	runProgress.Stop()
+	sharedClusters.destroy()
 
 	if TAPFile != "" {
 		src := filepath.Join(outputDir, "test.tap")
@@ -223,17 +306,7 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 		return nil, err
 	}
 
-	switch pltfrm {
-	case "qemu":
-		cluster, err = qemu.NewCluster(&QEMUOptions, testDir)
-	case "gce":
-		cluster, err = gcloud.NewCluster(&GCEOptions, testDir)
-	case "aws":
-		cluster, err = aws.NewCluster(&AWSOptions, testDir)
-	default:
-		err = fmt.Errorf("invalid platform %q", pltfrm)
-	}
-
+	cluster, err = newCluster(pltfrm, testDir)
 	if err != nil {
 		return nil, fmt.Errorf("creating cluster for semver check: %v", err)
 	}
@@ -261,52 +334,55 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 	return version, nil
 }
 
-// RunTest is a harness for running a single test. It is used by
-// RunTests but can also be used directly by binaries that aim to run a
-// single test. Using RunTest directly means that TestCluster flags used
-// to filter out tests such as 'Platforms' or 'MinVersion'
-// are not respected.
-// outputDir is where various test logs and data will be written for
-// analysis after the test run. It should already exist.
-func RunTest(t *register.Test, pltfrm, outputDir string) (err error) {
+// runTest is a harness for running a single test. It is used by
+// RunTests and expects the test to have already been filtered by
+// 'Platforms' and 'MinVersion'. Logs and data are written to the test's
+// harness output directory for analysis after the test run.
+func runTest(h *harness.H, t *register.Test, pltfrm string) (err error) {
 	var c platform.Cluster
 
-	testDir := filepath.Join(outputDir, t.Name)
-	if err := os.MkdirAll(testDir, 0777); err != nil {
-		return err
+	if t.SharedCluster {
+		c = sharedClusters.acquire(t)
 	}
-
-	switch pltfrm {
-	case "qemu":
-		c, err = qemu.NewCluster(&QEMUOptions, testDir)
-	case "gce":
-		c, err = gcloud.NewCluster(&GCEOptions, testDir)
-	case "aws":
-		c, err = aws.NewCluster(&AWSOptions, testDir)
-	default:
-		err = fmt.Errorf("invalid platform %q", pltfrm)
-	}
-
-	if err != nil {
+	reused := c != nil
+	if reused {
+		h.Logf("Reusing shared cluster")
+		// keep logs of the machines with the test using them
+		if s, ok := c.(platform.OutputDirSetter); ok {
+			if err := s.SetOutputDir(h.OutputDir()); err != nil {
+				plog.Warningf("Moving cluster output to %s: %v", h.OutputDir(), err)
+			}
+		}
+	} else if c, err = newCluster(pltfrm, h.OutputDir()); err != nil {
+		if t.SharedCluster {
+			sharedClusters.release(t, nil, false)
+		}
 		return fmt.Errorf("Cluster failed: %v", err)
 	}
+
+	runProgress.attach(h.Name(), c)
 	defer func() {
+		runProgress.detach(c)
+
+		// Only clusters from passing tests are safe to hand to
+		// another test, anything else is torn down.
+		if t.SharedCluster {
+			sharedClusters.release(t, c, err == nil && !h.Failed())
+			return
+		}
 		if err := c.Destroy(); err != nil {
 			plog.Errorf("cluster.Destroy(): %v", err)
 		}
 	}()
 
-	url, err := c.GetDiscoveryURL(t.ClusterSize)
-	if err != nil {
-		return fmt.Errorf("Failed to create discovery endpoint: %v", err)
-	}
+	// Fail the test if any machine crashes. check is also called before
+	// collecting artifacts below, calling it again is a no-op.
+	crashes := watchCrashes(c)
+	defer crashes.check(h)
 
-	cfgs := MakeConfigs(url, t.UserData, t.ClusterSize)
-
-	if t.ClusterSize > 0 {
-		_, err := platform.NewMachines(c, cfgs)
-		if err != nil {
-			return fmt.Errorf("Cluster failed starting machines: %v", err)
+	if !reused {
+		if err := startMachines(c, t); err != nil {
+			return err
 		}
 	}
 
@@ -327,6 +403,7 @@ func RunTest(t *register.Test, pltfrm, outputDir string) (err error) {
 		Name:        t.Name,
 		NativeFuncs: names,
 		Options:     tempTestOptions,
+		H:           h,
 		Cluster:     c,
 	}
 
@@ -354,15 +431,77 @@ func RunTest(t *register.Test, pltfrm, outputDir string) (err error) {
 			err = fmt.Errorf("test panicked: %v", r)
 		}
 
-		// give some time for the remote journal to be flushed so it can be read
-		// before we run the deferred machine destruction
-		if err != nil {
-			time.Sleep(2 * time.Second)
+		if _, ok := err.(skip.Skip); ok {
+			return
+		}
+
+		// give some time for the remote journal to be flushed so
+		// the recording is complete before it is collected and the
+		// machines are destroyed
+		if _, ok := testPlatforms[pltfrm]; !ok && (err != nil || h.Failed()) {
+			time.Sleep(journalFlushDelay)
+		}
+
+		// check for crashes now so they are included in the artifacts
+		crashes.check(h)
+		if err != nil || h.Failed() {
+			tcluster.CollectDefaultArtifacts()
 		}
 	}()
 
 	// run test
-	return t.Run(tcluster)
+	if t.Run != nil {
+		if err := t.Run(tcluster); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range t.Subtests {
+		sub := sub // for the closure
+		tcluster.Run(sub.Name, func(c cluster.TestCluster) {
+			if err := sub.Run(c); err != nil {
+				c.Fatal(err)
+			}
+		})
+	}
+
+	return nil
+}
+
+// newCluster creates a cluster on the given platform.
+func newCluster(pltfrm, outputDir string) (platform.Cluster, error) {
+	switch pltfrm {
+	case "qemu":
+		return qemu.NewCluster(&QEMUOptions, outputDir)
+	case "gce":
+		return gcloud.NewCluster(&GCEOptions, outputDir)
+	case "aws":
+		return aws.NewCluster(&AWSOptions, outputDir)
+	default:
+		if newTestCluster, ok := testPlatforms[pltfrm]; ok {
+			return newTestCluster(outputDir)
+		}
+		return nil, fmt.Errorf("invalid platform %q", pltfrm)
+	}
+}
+
+// startMachines starts the machines requested by the test.
+func startMachines(c platform.Cluster, t *register.Test) error {
+	url, err := c.GetDiscoveryURL(t.ClusterSize)
+	if err != nil {
+		return fmt.Errorf("Failed to create discovery endpoint: %v", err)
+	}
+
+	cfgs := MakeConfigs(url, t.UserData, t.ClusterSize)
+
+	if t.ClusterSize > 0 {
+		_, err := platform.NewMachines(c, cfgs)
+		if err != nil {
+			return fmt.Errorf("Cluster failed starting machines: %v", err)
+		}
+	}
+
+	return nil
 }
 
 // scpKolet searches for a kolet binary and copies it to the machine.
@@ -0,0 +1,206 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/machine/fake"
+)
+
+var (
+	sharedMu       sync.Mutex
+	sharedMachines = make(map[string]string)
+)
+
+// setupFake makes the "fake" platform available and registers the fake.*
+// tests, returning a function which undoes both.
+func setupFake() func() {
+	fakeOptions := fake.Options{Options: &Options}
+	fakeOptions.Setup = func(m *fake.Machine) error {
+		m.Host.AddCommand("systemctl is-active etcd2", mockssh.Response{Stdout: "active\n"})
+		return nil
+	}
+	RegisterTestPlatform("fake", func(outputDir string) (platform.Cluster, error) {
+		return fake.NewCluster(&fakeOptions, outputDir)
+	})
+
+	isActive := func(c cluster.TestCluster) error {
+		out, err := c.Machines()[0].SSH("systemctl is-active etcd2")
+		if err != nil {
+			return err
+		}
+		if string(out) != "active" {
+			return errors.New("etcd2 not active")
+		}
+		return nil
+	}
+
+	register.Register(&register.Test{
+		Name:        "fake.pass",
+		Run:         isActive,
+		ClusterSize: 2,
+	})
+	register.Register(&register.Test{
+		Name:        "fake.fail",
+		Run:         func(c cluster.TestCluster) error { return errors.New("failed") },
+		ClusterSize: 1,
+	})
+	logMessage := func(identifier, message string) func(c cluster.TestCluster) error {
+		return func(c cluster.TestCluster) error {
+			return c.Machines()[0].(*fake.Machine).Log(map[string]string{
+				journal.FIELD_SYSLOG_IDENTIFIER: identifier,
+				journal.FIELD_MESSAGE:           message,
+			})
+		}
+	}
+	register.Register(&register.Test{
+		Name:        "fake.log",
+		Run:         logMessage("fake", "all is well"),
+		ClusterSize: 1,
+	})
+	register.Register(&register.Test{
+		Name:        "fake.crash",
+		Run:         logMessage("kernel", "BUG: unable to handle kernel NULL pointer dereference"),
+		ClusterSize: 1,
+	})
+	register.Register(&register.Test{
+		Name:        "fake.subtests",
+		ClusterSize: 1,
+		Subtests: []register.Subtest{
+			{Name: "active", Run: isActive},
+			{Name: "skipped", Run: func(c cluster.TestCluster) error {
+				c.Skip("not today")
+				return nil
+			}},
+		},
+	})
+	shared := func(c cluster.TestCluster) error {
+		d, ok := c.Cluster.(interface {
+			OutputDir() string
+		})
+		if !ok || d.OutputDir() != c.H.OutputDir() {
+			return errors.New("cluster output not in the test's directory")
+		}
+		sharedMu.Lock()
+		defer sharedMu.Unlock()
+		sharedMachines[c.Name] = c.Machines()[0].ID()
+		return nil
+	}
+	for _, name := range []string{"fake.shared1", "fake.shared2"} {
+		register.Register(&register.Test{
+			Name:          name,
+			Run:           shared,
+			ClusterSize:   1,
+			SharedCluster: true,
+		})
+	}
+	register.Register(&register.Test{
+		Name:        "fake.qemu",
+		Run:         isActive,
+		ClusterSize: 1,
+		Platforms:   []string{"qemu"},
+	})
+	register.Register(&register.Test{
+		Name:        "fake.future",
+		Run:         isActive,
+		ClusterSize: 1,
+		MinVersion:  semver.Version{Major: 9999},
+	})
+
+	return func() {
+		delete(testPlatforms, "fake")
+		for name := range register.Tests {
+			if strings.HasPrefix(name, "fake.") {
+				delete(register.Tests, name)
+			}
+		}
+	}
+}
+
+func TestRunTestsFake(t *testing.T) {
+	defer setupFake()()
+
+	dir, err := ioutil.TempDir("", "kola-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputDir := filepath.Join(dir, "_kola_temp")
+
+	if err := RunTests([]string{"fake.*"}, "", "fake", outputDir); err != harness.SuiteFailed {
+		t.Errorf("expected %v, got %v", harness.SuiteFailed, err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Tests []harness.Result `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, r := range report.Tests {
+		got[r.Name] = r.Result
+	}
+	expect := map[string]string{
+		"fake.pass":             "PASS",
+		"fake.fail":             "FAIL",
+		"fake.log":              "PASS",
+		"fake.crash":            "FAIL",
+		"fake.subtests":         "PASS",
+		"fake.subtests/active":  "PASS",
+		"fake.subtests/skipped": "SKIP",
+		"fake.shared1":          "PASS",
+		"fake.shared2":          "PASS",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v wanted %v", got, expect)
+	}
+
+	// the machines' journals were recorded with the tests
+	logs, err := filepath.Glob(filepath.Join(outputDir, "fake.log", "*", "journal.txt"))
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("expected one journal, got %v %v", logs, err)
+	}
+	if data, err := ioutil.ReadFile(logs[0]); err != nil || !strings.Contains(string(data), "fake: all is well") {
+		t.Errorf("message missing from journal: %q %v", data, err)
+	}
+
+	// the parallel shared tests took turns on one machine
+	if sharedMachines["fake.shared1"] != sharedMachines["fake.shared2"] {
+		t.Errorf("shared tests used different machines: %v", sharedMachines)
+	}
+}
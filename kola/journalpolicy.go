@@ -0,0 +1,117 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/platform"
+)
+
+// crashFilters match journal entries which indicate something went badly
+// wrong on a machine, no matter what the test itself checks for.
+var crashFilters = []struct {
+	desc   string
+	filter journal.Filter
+}{
+	{"kernel oops", journal.Filter{
+		Identifier: "kernel",
+		Message:    regexp.MustCompile(`Oops|BUG:|general protection fault`),
+	}},
+	{"segfault", journal.Filter{
+		Identifier: "kernel",
+		Message:    regexp.MustCompile(`segfault at`),
+	}},
+	{"coredump", journal.Filter{
+		Identifier: "systemd-coredump",
+		Message:    regexp.MustCompile(`dumped core`),
+	}},
+}
+
+type crashWatch struct {
+	machine string
+	desc    string
+	watch   *journal.Watch
+}
+
+// crashWatcher watches the journals of every machine in a cluster for
+// the duration of a single test.
+type crashWatcher struct {
+	mu      sync.Mutex
+	stopped bool
+	watches []crashWatch
+	remove  func() // removes the journal listener.
+}
+
+// watchCrashes starts watching the machines currently in c as well as
+// any machines added later on. New machines are watched from the moment
+// their journal starts recording, so crashes while booting are caught.
+func watchCrashes(c platform.Cluster) *crashWatcher {
+	w := &crashWatcher{}
+	if n, ok := c.(platform.JournalNotifier); ok {
+		w.remove = n.AddJournalListener(w.add)
+	}
+	for _, m := range c.Machines() {
+		if j := m.Journal(); j != nil {
+			w.add(m.ID(), j)
+		}
+	}
+	return w
+}
+
+func (w *crashWatcher) add(machineID string, j *platform.Journal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	for _, f := range crashFilters {
+		w.watches = append(w.watches, crashWatch{
+			machine: machineID,
+			desc:    f.desc,
+			watch:   j.Watch(f.filter),
+		})
+	}
+}
+
+// check stops watching and fails the test for every crash that was
+// logged while it ran.
+func (w *crashWatcher) check(h *harness.H) {
+	if w.remove != nil {
+		w.remove()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	for _, cw := range w.watches {
+		cw.watch.Stop()
+		for {
+			select {
+			case entry := <-cw.watch.Entries():
+				h.Errorf("machine %s logged a %s: %s",
+					cw.machine, cw.desc, entry[journal.FIELD_MESSAGE])
+				continue
+			default:
+			}
+			break
+		}
+	}
+	w.watches = nil
+}
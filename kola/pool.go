@@ -0,0 +1,111 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"sync"
+
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// poolKey identifies clusters that are interchangeable between tests.
+type poolKey struct {
+	userData    string
+	clusterSize int
+}
+
+// clusterPool shares one cluster between the tests with SharedCluster
+// set and the same poolKey. Tests take turns on the cluster, a test
+// that finds it in use waits for it rather than booting another. A
+// cluster is only handed on by tests that passed, a failing test may
+// have left the machines in an unknown state so the next test in line
+// boots a new one.
+type clusterPool struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	slots map[poolKey]*poolSlot
+}
+
+type poolSlot struct {
+	busy    bool
+	cluster platform.Cluster // nil until a test boots one
+}
+
+func keyFor(t *register.Test) poolKey {
+	return poolKey{
+		userData:    t.UserData,
+		clusterSize: t.ClusterSize,
+	}
+}
+
+// acquire waits until no other test is using the cluster for t and
+// returns it, or nil if the caller must boot a new cluster and hand it
+// to release.
+func (p *clusterPool) acquire(t *register.Test) platform.Cluster {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.slots == nil {
+		p.slots = make(map[poolKey]*poolSlot)
+		p.cond = sync.NewCond(&p.mu)
+	}
+	key := keyFor(t)
+	slot, ok := p.slots[key]
+	if !ok {
+		slot = &poolSlot{}
+		p.slots[key] = slot
+	}
+	for slot.busy {
+		p.cond.Wait()
+	}
+	slot.busy = true
+	return slot.cluster
+}
+
+// release hands the cluster used by t to the next test waiting for it.
+// If reusable is false the cluster is destroyed.
+func (p *clusterPool) release(t *register.Test, c platform.Cluster, reusable bool) {
+	if !reusable && c != nil {
+		if err := c.Destroy(); err != nil {
+			plog.Errorf("cluster.Destroy(): %v", err)
+		}
+		c = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slot := p.slots[keyFor(t)]
+	slot.cluster = c
+	slot.busy = false
+	p.cond.Broadcast()
+}
+
+// destroy tears down all idle clusters.
+func (p *clusterPool) destroy() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, slot := range p.slots {
+		if slot.cluster == nil || slot.busy {
+			continue
+		}
+		if err := slot.cluster.Destroy(); err != nil {
+			plog.Errorf("cluster.Destroy(): %v", err)
+		}
+		slot.cluster = nil
+	}
+	p.slots = nil
+}
@@ -0,0 +1,355 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/platform"
+)
+
+const (
+	progressRedraw   = time.Second
+	progressInterval = 10 * time.Second
+	progressFile     = "status.txt"
+)
+
+// testStatus is the last known state of a single test.
+type testStatus struct {
+	state    harness.EventType
+	started  time.Time
+	machines int
+}
+
+// progress tracks the state of a test run from harness and platform
+// events. It periodically writes a summary to status.txt in the output
+// directory and can optionally draw a live view at the bottom of a
+// terminal, in which case all test output must be written through it.
+type progress struct {
+	mu       sync.Mutex
+	start    time.Time
+	started  bool // at least one test has started.
+	tests    map[string]*testStatus
+	clusters map[platform.Cluster]string // test currently using a cluster.
+	watched  map[platform.Cluster]func() // removes the machine listener.
+	results  map[string]int
+
+	statusPath string
+
+	// live terminal view, out is nil if disabled.
+	out     *os.File
+	lines   int                // number of lines currently drawn.
+	prevLog capnslog.Formatter // restored by Stop.
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newProgress creates a tracker writing its status file to outputDir.
+// If live is set and stdout is a terminal the live view is enabled.
+func newProgress(outputDir string, live bool) *progress {
+	p := &progress{
+		start:      time.Now(),
+		tests:      make(map[string]*testStatus),
+		clusters:   make(map[platform.Cluster]string),
+		watched:    make(map[platform.Cluster]func()),
+		results:    make(map[string]int),
+		statusPath: filepath.Join(outputDir, progressFile),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if live && terminal.IsTerminal(int(os.Stdout.Fd())) {
+		p.out = os.Stdout
+	}
+	return p
+}
+
+// Output returns the writer test output should be sent to.
+func (p *progress) Output() io.Writer {
+	if p.out == nil {
+		return os.Stdout
+	}
+	return p
+}
+
+// Write passes test output through to the terminal, keeping the live
+// view below it.
+func (p *progress) Write(b []byte) (int, error) {
+	return p.writeAbove(p.out, b)
+}
+
+// writeAbove writes to w, which should be the terminal, with the live
+// view temporarily erased.
+func (p *progress) writeAbove(w io.Writer, b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := w.Write(b)
+	p.draw()
+	return n, err
+}
+
+// progressLog passes log messages through to stderr, keeping the live
+// view below them.
+type progressLog struct {
+	p *progress
+}
+
+func (l progressLog) Write(b []byte) (int, error) {
+	return l.p.writeAbove(os.Stderr, b)
+}
+
+// Event receives harness events.
+func (p *progress) Event(e harness.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started = true
+	if e.Type == harness.EventFinished {
+		delete(p.tests, e.Name)
+		p.results[e.Result]++
+		return
+	}
+
+	ts, ok := p.tests[e.Name]
+	if !ok {
+		ts = &testStatus{}
+		p.tests[e.Name] = ts
+	}
+	if e.Type == harness.EventRunning && ts.state != harness.EventRunning {
+		ts.started = e.Time
+	}
+	ts.state = e.Type
+}
+
+// attach records that the named test is using cluster c.
+func (p *progress) attach(name string, c platform.Cluster) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clusters[c] = name
+	if ts, ok := p.tests[name]; ok {
+		ts.machines = len(c.Machines())
+	}
+
+	if n, ok := c.(platform.MachineNotifier); ok && p.watched[c] == nil {
+		p.watched[c] = n.AddMachineListener(func(m platform.Machine, added bool) {
+			p.machineEvent(c, added)
+		})
+	}
+}
+
+// detach records that cluster c is no longer in use.
+func (p *progress) detach(c platform.Cluster) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	remove := p.watched[c]
+	delete(p.watched, c)
+	delete(p.clusters, c)
+	p.mu.Unlock()
+
+	// outside of p.mu, the cluster may be calling the listener.
+	if remove != nil {
+		remove()
+	}
+}
+
+func (p *progress) machineEvent(c platform.Cluster, added bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ts, ok := p.tests[p.clusters[c]]
+	if !ok {
+		return
+	}
+	if added {
+		ts.machines++
+	} else if ts.machines > 0 {
+		ts.machines--
+	}
+}
+
+// Start begins periodically updating the status file and live view.
+// While the live view is shown log messages are routed through it.
+func (p *progress) Start() {
+	if p.out != nil {
+		p.prevLog = LogFormatter
+		if p.prevLog == nil {
+			p.prevLog = capnslog.NewDefaultFormatter(os.Stderr)
+		}
+		capnslog.SetFormatter(capnslog.NewStringFormatter(progressLog{p}))
+	}
+	go func() {
+		defer close(p.done)
+		redraw := time.NewTicker(progressRedraw)
+		defer redraw.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-p.stop:
+				p.writeStatus()
+				p.mu.Lock()
+				p.clear()
+				p.mu.Unlock()
+				return
+			case now := <-redraw.C:
+				p.mu.Lock()
+				p.clear()
+				p.draw()
+				p.mu.Unlock()
+				if now.Sub(last) >= progressInterval {
+					p.writeStatus()
+					last = now
+				}
+			}
+		}
+	}()
+}
+
+// Stop writes the final status file and removes the live view.
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.done
+	if p.out != nil {
+		capnslog.SetFormatter(p.prevLog)
+	}
+}
+
+// clear erases the live view. Must be called with p.mu held.
+func (p *progress) clear() {
+	if p.out == nil || p.lines == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+	p.lines = 0
+}
+
+// draw renders the live view, truncated to fit the terminal. Must be
+// called with p.mu held.
+func (p *progress) draw() {
+	if p.out == nil || !p.started {
+		return
+	}
+
+	width, height, err := terminal.GetSize(int(p.out.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	lines := p.render(time.Now(), false)
+	if max := height / 2; len(lines) > max && max > 0 {
+		lines = lines[:max]
+	}
+	for _, line := range lines {
+		if len(line) >= width {
+			line = line[:width-1]
+		}
+		fmt.Fprintln(p.out, line)
+	}
+	p.lines = len(lines)
+}
+
+// writeStatus replaces the status file with a full summary.
+func (p *progress) writeStatus() {
+	p.mu.Lock()
+	if !p.started {
+		p.mu.Unlock()
+		return
+	}
+	lines := p.render(time.Now(), true)
+	p.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := p.statusPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0666); err != nil {
+		plog.Warningf("Failed to write status: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, p.statusPath); err != nil {
+		plog.Warningf("Failed to write status: %v", err)
+	}
+}
+
+// render summarizes the run, listing running tests followed by queued
+// tests. If full is false the queued tests are abbreviated to a count.
+// Must be called with p.mu held.
+func (p *progress) render(now time.Time, full bool) []string {
+	var running, queued []string
+	for name, ts := range p.tests {
+		if ts.state == harness.EventRunning {
+			running = append(running, name)
+		} else {
+			queued = append(queued, name)
+		}
+	}
+	sort.Strings(running)
+	sort.Strings(queued)
+
+	finished := p.results["PASS"] + p.results["FAIL"] + p.results["SKIP"]
+	lines := []string{fmt.Sprintf(
+		"=== %s elapsed: %d running, %d queued, %d finished (%d passed, %d failed, %d skipped)",
+		fmtElapsed(now.Sub(p.start)), len(running), len(queued), finished,
+		p.results["PASS"], p.results["FAIL"], p.results["SKIP"])}
+
+	for _, name := range running {
+		ts := p.tests[name]
+		machines := "machines"
+		if ts.machines == 1 {
+			machines = "machine"
+		}
+		lines = append(lines, fmt.Sprintf("    %-40s %8s  %d %s",
+			name, fmtElapsed(now.Sub(ts.started)), ts.machines, machines))
+	}
+
+	if len(queued) > 0 {
+		if full {
+			lines = append(lines, "    queued: "+strings.Join(queued, ", "))
+		} else {
+			lines = append(lines, fmt.Sprintf("    %d queued", len(queued)))
+		}
+	}
+
+	return lines
+}
+
+// fmtElapsed formats a duration as "1h02m03s" with second precision.
+func fmtElapsed(d time.Duration) string {
+	d -= d % time.Second
+	return d.String()
+}
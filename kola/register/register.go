@@ -29,11 +29,26 @@ import (
 type Test struct {
 	Name        string // should be uppercase and unique
 	Run         func(cluster.TestCluster) error
+	Subtests    []Subtest // run in order against the same cluster after Run
 	NativeFuncs map[string]func() error
 	UserData    string
 	ClusterSize int
 	Platforms   []string // whitelist of platforms to run test against -- defaults to all
 
+	// Tags are free-form labels used to select tests with tag
+	// expressions. By convention tests are tagged with the components
+	// they cover, such as "docker" or "etcd", plus "network" if they
+	// depend on networking, "cloud" if they only run on cloud platforms
+	// and "slow" if they boot large clusters.
+	Tags []string
+
+	// SharedCluster allows the test to reuse a cluster left behind by
+	// a previous passing test with identical UserData and ClusterSize
+	// instead of booting a new one. Tests sharing a cluster take turns
+	// using it. Only set this for tests that leave the machines in a
+	// state other tests can tolerate, such as read only checks.
+	SharedCluster bool
+
 	// MinVersion prevents the test from executing on CoreOS machines
 	// less than MinVersion. This will be ignored if the name fully
 	// matches without globbing.
@@ -45,6 +60,13 @@ type Test struct {
 	EndVersion semver.Version
 }
 
+// Subtest is a named check run against its parent Test's cluster. Each
+// subtest is reported individually as "<test name>/<subtest name>".
+type Subtest struct {
+	Name string
+	Run  func(cluster.TestCluster) error
+}
+
 // Registered tests live here. Mapping of names to tests.
 var Tests = map[string]*Test{}
 
@@ -61,5 +83,21 @@ func Register(t *Test) {
 		panic(fmt.Sprintf("test %v has an invalid version range", t.Name))
 	}
 
+	if t.Run == nil && len(t.Subtests) == 0 {
+		panic(fmt.Sprintf("test %v has nothing to run", t.Name))
+	}
+
+	for _, sub := range t.Subtests {
+		if sub.Name == "" || sub.Run == nil {
+			panic(fmt.Sprintf("test %v has an invalid subtest", t.Name))
+		}
+	}
+
+	for _, tag := range t.Tags {
+		if !validTag(tag) {
+			panic(fmt.Sprintf("test %v has an invalid tag %q", t.Name, tag))
+		}
+	}
+
 	Tests[t.Name] = t
 }
@@ -0,0 +1,188 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagExpr is a boolean expression over test tags such as
+// "network && !slow" or "(docker || rkt) && !cloud-only".
+// Supported operators, from lowest to highest precedence, are ||, &&
+// and !. Parentheses may be used for grouping.
+type TagExpr interface {
+	// Match reports whether the given set of tags satisfies the expression.
+	Match(tags []string) bool
+	String() string
+}
+
+type tagName string
+
+func (t tagName) Match(tags []string) bool {
+	for _, tag := range tags {
+		if tag == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t tagName) String() string { return string(t) }
+
+type tagNot struct{ x TagExpr }
+
+func (n tagNot) Match(tags []string) bool { return !n.x.Match(tags) }
+func (n tagNot) String() string           { return "!" + n.x.String() }
+
+type tagAnd struct{ x, y TagExpr }
+
+func (a tagAnd) Match(tags []string) bool { return a.x.Match(tags) && a.y.Match(tags) }
+func (a tagAnd) String() string           { return "(" + a.x.String() + " && " + a.y.String() + ")" }
+
+type tagOr struct{ x, y TagExpr }
+
+func (o tagOr) Match(tags []string) bool { return o.x.Match(tags) || o.y.Match(tags) }
+func (o tagOr) String() string           { return "(" + o.x.String() + " || " + o.y.String() + ")" }
+
+// ParseTagExpr parses a tag expression. An empty expression is an error.
+func ParseTagExpr(expr string) (TagExpr, error) {
+	p := tagParser{s: expr}
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok != "" {
+		return nil, fmt.Errorf("tag expression %q: unexpected %q", expr, tok)
+	}
+	return x, nil
+}
+
+// validTag reports whether tag may be used as a test tag.
+func validTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.", r)
+}
+
+type tagParser struct {
+	s   string
+	pos int
+}
+
+// next consumes and returns the next token, "" at the end of input.
+func (p *tagParser) next() string {
+	tok, n := p.scan()
+	p.pos += n
+	return tok
+}
+
+// peek returns the next token without consuming it.
+func (p *tagParser) peek() string {
+	tok, _ := p.scan()
+	return tok
+}
+
+func (p *tagParser) scan() (string, int) {
+	s := p.s[p.pos:]
+	trimmed := strings.TrimLeftFunc(s, unicode.IsSpace)
+	skip := len(s) - len(trimmed)
+	switch {
+	case trimmed == "":
+		return "", skip
+	case strings.HasPrefix(trimmed, "&&"), strings.HasPrefix(trimmed, "||"):
+		return trimmed[:2], skip + 2
+	case trimmed[0] == '!', trimmed[0] == '(', trimmed[0] == ')':
+		return trimmed[:1], skip + 1
+	}
+	end := strings.IndexFunc(trimmed, func(r rune) bool { return !isTagRune(r) })
+	if end == -1 {
+		end = len(trimmed)
+	} else if end == 0 {
+		// Unknown character, return it as a token so the caller can report it.
+		end = 1
+	}
+	return trimmed[:end], skip + end
+}
+
+func (p *tagParser) parseOr() (TagExpr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = tagOr{x, y}
+	}
+	return x, nil
+}
+
+func (p *tagParser) parseAnd() (TagExpr, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = tagAnd{x, y}
+	}
+	return x, nil
+}
+
+func (p *tagParser) parseNot() (TagExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("tag expression %q: unexpected end of expression", p.s)
+	case tok == "!":
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{x}, nil
+	case tok == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok != ")" {
+			return nil, fmt.Errorf("tag expression %q: missing closing parenthesis", p.s)
+		}
+		return x, nil
+	case validTag(tok):
+		return tagName(tok), nil
+	default:
+		return nil, fmt.Errorf("tag expression %q: unexpected %q", p.s, tok)
+	}
+}
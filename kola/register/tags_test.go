@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tags := []string{"network", "slow", "cloud-only"}
+	testCases := []struct {
+		expr  string
+		match bool
+	}{
+		{"network", true},
+		{"docker", false},
+		{"!docker", true},
+		{"!!network", true},
+		{"network && slow", true},
+		{"network && !slow", false},
+		{"docker || slow", true},
+		{"docker || rkt", false},
+		{"docker || network && slow", true},
+		{"(docker || network) && !slow", false},
+		{"!(docker || rkt) && cloud-only", true},
+		{"  network&&slow  ", true},
+	}
+	for _, tc := range testCases {
+		x, err := ParseTagExpr(tc.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tc.expr, err)
+			continue
+		}
+		if m := x.Match(tags); m != tc.match {
+			t.Errorf("%q (parsed as %s): got %t wanted %t", tc.expr, x, m, tc.match)
+		}
+	}
+}
+
+func TestParseTagExprInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"network &&",
+		"|| network",
+		"(network",
+		"network)",
+		"network slow",
+		"network & slow",
+		"!",
+		"net$work",
+	} {
+		if x, err := ParseTagExpr(expr); err == nil {
+			t.Errorf("%q: expected an error, got %s", expr, x)
+		}
+	}
+}
@@ -26,6 +26,7 @@ const (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.basic",
+		Tags:        []string{"core"},
 		Run:         LocalTests,
 		ClusterSize: 1,
 		NativeFuncs: map[string]func() error{
@@ -44,6 +45,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.cluster",
+		Tags:        []string{"core", "etcd", "slow"},
 		Run:         ClusterTests,
 		ClusterSize: 3,
 		NativeFuncs: map[string]func() error{
@@ -85,6 +87,7 @@ func init() {
 	// tests requiring network connection to internet
 	register.Register(&register.Test{
 		Name:        "coreos.internet",
+		Tags:        []string{"core", "network", "cloud"},
 		Run:         InternetTests,
 		ClusterSize: 1,
 		Platforms:   []string{"gce", "aws"},
@@ -44,6 +44,7 @@ func init() {
 		Run:         dockerResources,
 		ClusterSize: 1,
 		Name:        "docker.resources",
+		Tags:        []string{"docker"},
 		UserData:    `#cloud-config`,
 		// began shipping docker 1.10 in 949, which has all of the
 		// tested resource options.
@@ -53,6 +54,7 @@ func init() {
 		Run:         dockerNetwork,
 		ClusterSize: 2,
 		Name:        "docker.network",
+		Tags:        []string{"docker"},
 		UserData:    `#cloud-config`,
 
 		MinVersion: semver.Version{Major: 1192},
@@ -61,6 +63,7 @@ func init() {
 		Run:         dockerOldClient,
 		ClusterSize: 1,
 		Name:        "docker.oldclient",
+		Tags:        []string{"docker"},
 		UserData:    `#cloud-config`,
 		MinVersion:  semver.Version{Major: 1192},
 	})
@@ -68,6 +71,7 @@ func init() {
 		Run:         dockerUserns,
 		ClusterSize: 1,
 		Name:        "docker.userns",
+		Tags:        []string{"docker"},
 		// Source yaml:
 		// https://github.com/coreos/container-linux-config-transpiler
 		/*
@@ -102,6 +106,7 @@ func init() {
 		Run:         dockerNetworksReliably,
 		ClusterSize: 1,
 		Name:        "docker.networks-reliably",
+		Tags:        []string{"docker"},
 		UserData:    `#cloud-config`,
 		MinVersion:  semver.Version{Major: 1192},
 	})
@@ -109,6 +114,7 @@ func init() {
 		Run:         dockerUserNoCaps,
 		ClusterSize: 1,
 		Name:        "docker.user-no-caps",
+		Tags:        []string{"docker"},
 		UserData:    `#cloud-config`,
 		MinVersion:  semver.Version{Major: 1192},
 	})
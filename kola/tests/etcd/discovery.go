@@ -31,6 +31,7 @@ func init() {
 		Run:         Discovery,
 		ClusterSize: 3,
 		Name:        "coreos.etcd2.discovery",
+		Tags:        []string{"etcd", "slow"},
 		UserData: `{
   "ignition": { "version": "2.0.0" },
   "systemd": {
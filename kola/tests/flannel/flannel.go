@@ -81,6 +81,7 @@ func init() {
 		Run:         udp,
 		ClusterSize: 3,
 		Name:        "coreos.flannel.udp",
+		Tags:        []string{"flannel", "network", "cloud", "slow"},
 		Platforms:   []string{"aws", "gce"},
 		UserData:    strings.Replace(flannelConf, "$type", "udp", -1),
 	})
@@ -89,6 +90,7 @@ func init() {
 		Run:         vxlan,
 		ClusterSize: 3,
 		Name:        "coreos.flannel.vxlan",
+		Tags:        []string{"flannel", "network", "cloud", "slow"},
 		Platforms:   []string{"aws", "gce"},
 		UserData:    strings.Replace(flannelConf, "$type", "vxlan", -1),
 	})
@@ -115,6 +115,7 @@ func init() {
 		Run:         Proxy,
 		ClusterSize: 0,
 		Name:        "coreos.fleet.etcdproxy",
+		Tags:        []string{"fleet", "etcd"},
 		UserData:    `#cloud-config`,
 	})
 }
@@ -27,12 +27,14 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.empty.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         empty,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.empty.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         empty,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -44,6 +44,7 @@ func init() {
 		           }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.btrfsroot.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         btrfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -51,6 +52,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.btrfsroot.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         btrfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -78,6 +80,7 @@ func init() {
 		         }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.xfsroot.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         xfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -85,6 +88,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.xfsroot.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         xfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -46,6 +46,7 @@ func init() {
 		      }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.sethostname.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         setHostname,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -53,6 +54,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v1.sethostname.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         setHostname,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
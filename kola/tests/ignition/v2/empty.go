@@ -24,6 +24,7 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.empty.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         empty,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -31,6 +32,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.empty.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         empty,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -24,6 +24,7 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.once",
+		Tags:        []string{"ignition"},
 		Run:         runsOnce,
 		ClusterSize: 1,
 		UserData: `{
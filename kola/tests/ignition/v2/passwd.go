@@ -26,6 +26,7 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.groups",
+		Tags:        []string{"ignition"},
 		Run:         groups,
 		ClusterSize: 1,
 		UserData: `{
@@ -53,6 +54,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.users",
+		Tags:        []string{"ignition"},
 		Run:         users,
 		ClusterSize: 1,
 		UserData: `{
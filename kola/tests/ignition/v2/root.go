@@ -49,6 +49,7 @@ func init() {
 		           }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.btrfsroot.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         btrfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -57,6 +58,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.btrfsroot.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         btrfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -88,6 +90,7 @@ func init() {
 		         }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.xfsroot.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         xfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -96,6 +99,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.xfsroot.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         xfsRoot,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -127,6 +131,7 @@ func init() {
 		         }`
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.ext4Root.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         ext4Root,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -135,6 +140,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.ext4Root.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         ext4Root,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -143,6 +149,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.ext4CheckExisting.aws",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         ext4CheckExisting,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -151,6 +158,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.ignition.v2.ext4CheckExisting.gce",
+		Tags:        []string{"ignition", "cloud"},
 		Run:         ext4CheckExisting,
 		ClusterSize: 1,
 		Platforms:   []string{"gce"},
@@ -54,6 +54,7 @@ func init() {
 
 			register.Register(&register.Test{
 				Name:        "google.kubernetes.basic." + r + "." + t,
+				Tags:        []string{"kubernetes", "cloud", "slow"},
 				Run:         f,
 				ClusterSize: 0,
 				MinVersion:  min,
@@ -33,6 +33,7 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.locksmith.cluster",
+		Tags:        []string{"locksmith", "etcd", "slow"},
 		Run:         locksmithCluster,
 		ClusterSize: 3,
 		UserData: `{
@@ -68,6 +69,7 @@ func init() {
 	})
 	register.Register(&register.Test{
 		Name:        "coreos.locksmith.tls",
+		Tags:        []string{"locksmith", "etcd"},
 		Run:         locksmithTLS,
 		ClusterSize: 1,
 		UserData: `{
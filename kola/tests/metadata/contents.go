@@ -27,6 +27,7 @@ import (
 func init() {
 	register.Register(&register.Test{
 		Name:        "coreos.metadata.aws",
+		Tags:        []string{"metadata", "cloud"},
 		Run:         verifyAWS,
 		ClusterSize: 1,
 		Platforms:   []string{"aws"},
@@ -50,6 +51,7 @@ func init() {
 
 	register.Register(&register.Test{
 		Name:        "coreos.metadata.azure",
+		Tags:        []string{"metadata", "cloud"},
 		Run:         verifyAzure,
 		ClusterSize: 1,
 		Platforms:   []string{"azure"},
@@ -26,6 +26,7 @@ func init() {
 		Run:         AuthVerify,
 		ClusterSize: 1,
 		Name:        "coreos.auth.verify",
+		Tags:        []string{"auth"},
 		Platforms:   []string{"qemu", "aws", "gce"},
 		UserData:    `#cloud-config`,
 	})
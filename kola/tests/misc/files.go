@@ -24,41 +24,54 @@ import (
 )
 
 func init() {
+	// the checks only read the filesystem so they can share machines
 	register.Register(&register.Test{
-		Run:         DeadLinks,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.deadlinks",
-		UserData:    `#cloud-config`,
+		Run:           DeadLinks,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.deadlinks",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 	register.Register(&register.Test{
-		Run:         SUIDFiles,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.suid",
-		UserData:    `#cloud-config`,
+		Run:           SUIDFiles,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.suid",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 	register.Register(&register.Test{
-		Run:         SGIDFiles,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.sgid",
-		UserData:    `#cloud-config`,
+		Run:           SGIDFiles,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.sgid",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 	register.Register(&register.Test{
-		Run:         WritableFiles,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.writablefiles",
-		UserData:    `#cloud-config`,
+		Run:           WritableFiles,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.writablefiles",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 	register.Register(&register.Test{
-		Run:         WritableDirs,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.writabledirs",
-		UserData:    `#cloud-config`,
+		Run:           WritableDirs,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.writabledirs",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 	register.Register(&register.Test{
-		Run:         StickyDirs,
-		ClusterSize: 1,
-		Name:        "coreos.filesystem.stickydirs",
-		UserData:    `#cloud-config`,
+		Run:           StickyDirs,
+		ClusterSize:   1,
+		Name:          "coreos.filesystem.stickydirs",
+		Tags:          []string{"filesystem"},
+		UserData:      `#cloud-config`,
+		SharedCluster: true,
 	})
 }
 
@@ -0,0 +1,62 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/machine/fake"
+)
+
+// runFake runs a registered test against fake machines on which the
+// search for SUID files finds files.
+func runFake(t *testing.T, name string, files ...string) error {
+	dir, err := ioutil.TempDir("", "kola-misc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kola.RegisterTestPlatform("fake", func(outputDir string) (platform.Cluster, error) {
+		return fake.NewCluster(&fake.Options{
+			Options: &kola.Options,
+			Setup: func(m *fake.Machine) error {
+				find := "sudo find / -ignore_readdir_race -path /sys -prune -o -path /proc -prune -o -path /var/lib/rkt -prune -o -type f -perm -4000 -print"
+				m.Host.AddCommand(find, mockssh.Response{Stdout: strings.Join(files, "\n")})
+				return nil
+			},
+		}, outputDir)
+	})
+
+	return kola.RunTest(register.Tests[name], "fake", filepath.Join(dir, "_kola_temp"))
+}
+
+func TestSUIDFiles(t *testing.T) {
+	if err := runFake(t, "coreos.filesystem.suid", "/usr/bin/sudo", "/usr/bin/su"); err != nil {
+		t.Errorf("known files rejected: %v", err)
+	}
+	if err := runFake(t, "coreos.filesystem.suid", "/usr/bin/sudo", "/opt/bin/backdoor"); err != harness.SuiteFailed {
+		t.Errorf("expected %v for an unknown file, got %v", harness.SuiteFailed, err)
+	}
+}
@@ -27,6 +27,7 @@ func init() {
 		Run:         InstallCloudConfig,
 		ClusterSize: 1,
 		Name:        "coreos.install.cloudinit",
+		Tags:        []string{"cloudinit"},
 		UserData: `{
   "ignition": { "version": "2.0.0" },
   "storage": {
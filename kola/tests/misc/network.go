@@ -28,6 +28,7 @@ func init() {
 		Run:         NetworkListeners,
 		ClusterSize: 1,
 		Name:        "coreos.network.listeners",
+		Tags:        []string{"network"},
 		UserData:    `#cloud-config`,
 	})
 }
@@ -76,6 +76,7 @@ func init() {
 		Run:         NFSv3,
 		ClusterSize: 0,
 		Name:        "linux.nfs.v3",
+		Tags:        []string{"nfs", "network"},
 		Platforms:   []string{"qemu", "aws"},
 		UserData:    `#cloud-config`,
 	})
@@ -83,6 +84,7 @@ func init() {
 		Run:         NFSv4,
 		ClusterSize: 0,
 		Name:        "linux.nfs.v4",
+		Tags:        []string{"nfs", "network"},
 		Platforms:   []string{"qemu", "aws"},
 		UserData:    `#cloud-config`,
 	})
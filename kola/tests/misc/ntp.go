@@ -29,6 +29,7 @@ func init() {
 		Run:         NTP,
 		ClusterSize: 0,
 		Name:        "linux.ntp",
+		Tags:        []string{"ntp", "network"},
 		Platforms:   []string{"qemu"},
 		UserData:    `#cloud-config`,
 	})
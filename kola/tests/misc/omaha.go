@@ -31,6 +31,7 @@ func init() {
 		Run:         OmahaPing,
 		ClusterSize: 1,
 		Name:        "coreos.omaha.ping",
+		Tags:        []string{"update"},
 		Platforms:   []string{"qemu"},
 		UserData: `#cloud-config
 
@@ -41,16 +42,6 @@ coreos:
 	})
 }
 
-type pingServer struct {
-	omaha.UpdaterStub
-
-	ping chan struct{}
-}
-
-func (ps *pingServer) Ping(req *omaha.Request, app *omaha.AppRequest) {
-	ps.ping <- struct{}{}
-}
-
 func OmahaPing(c cluster.TestCluster) error {
 	qc, ok := c.Cluster.(*qemu.Cluster)
 	if !ok {
@@ -59,10 +50,7 @@ func OmahaPing(c cluster.TestCluster) error {
 
 	omahaserver := qc.LocalCluster.OmahaServer
 
-	svc := &pingServer{
-		ping: make(chan struct{}),
-	}
-
+	svc := omaha.NewRecordingUpdater(omaha.UpdaterStub{})
 	omahaserver.Updater = svc
 
 	m := c.Machines()[0]
@@ -72,13 +60,9 @@ func OmahaPing(c cluster.TestCluster) error {
 		return fmt.Errorf("failed to execute update_engine_client -check_for_update: %v: %v", out, err)
 	}
 
-	tc := time.After(30 * time.Second)
-
-	select {
-	case <-tc:
+	if err := svc.WaitForPing("", 30*time.Second); err != nil {
 		platform.Manhole(m)
-		return errors.New("timed out waiting for omaha ping")
-	case <-svc.ping:
+		return err
 	}
 
 	return nil
@@ -26,6 +26,7 @@ func init() {
 		Run:         SelinuxEnforce,
 		ClusterSize: 1,
 		Name:        "coreos.selinux.enforce",
+		Tags:        []string{"selinux"},
 		UserData:    `#cloud-config`,
 	})
 }
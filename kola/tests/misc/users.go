@@ -28,6 +28,7 @@ func init() {
 		ClusterSize: 1,
 		Platforms:   []string{"qemu", "aws"},
 		Name:        "coreos.users.shells",
+		Tags:        []string{"auth"},
 		UserData:    `#cloud-config`,
 	})
 }
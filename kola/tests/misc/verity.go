@@ -30,6 +30,7 @@ func init() {
 		Run:         VerityVerify,
 		ClusterSize: 1,
 		Name:        "coreos.verity.verify",
+		Tags:        []string{"verity"},
 		Platforms:   []string{"qemu", "aws", "gce"},
 		UserData:    `#cloud-config`,
 	})
@@ -37,6 +38,7 @@ func init() {
 		Run:         VerityCorruption,
 		ClusterSize: 1,
 		Name:        "coreos.verity.corruption",
+		Tags:        []string{"verity"},
 		Platforms:   []string{"qemu", "aws", "gce"},
 		UserData:    `#cloud-config`,
 	})
@@ -43,6 +43,7 @@ func init() {
 		ClusterSize: 1,
 		Platforms:   []string{"aws", "gce"},
 		Name:        "coreos.rkt.etcd3",
+		Tags:        []string{"rkt", "etcd", "cloud"},
 		UserData:    conf,
 		MinVersion:  semver.Version{Major: 1213},
 	})
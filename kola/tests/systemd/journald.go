@@ -46,6 +46,7 @@ func init() {
 		Run:         journalRemote225,
 		ClusterSize: 0,
 		Name:        "systemd.journal.remote.225",
+		Tags:        []string{"systemd", "network"},
 		UserData:    `#cloud-config`,
 		EndVersion:  semver.Version{Major: 1024},
 	})
@@ -54,6 +55,7 @@ func init() {
 		Run:         journalRemote229,
 		ClusterSize: 0,
 		Name:        "systemd.journal.remote.229",
+		Tags:        []string{"systemd", "network"},
 		UserData:    `#cloud-config`,
 		MinVersion:  semver.Version{Major: 1024},
 	})
@@ -28,6 +28,7 @@ func init() {
 		Run:         gshadowParser,
 		ClusterSize: 1,
 		Name:        "systemd.sysusers.gshadow",
+		Tags:        []string{"systemd"},
 		UserData:    `#cloud-config`,
 		MinVersion:  semver.Version{Major: 1095},
 	})
@@ -0,0 +1,88 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bytes"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// chainAgent combines a local keyring with a forwarded agent. Keys are
+// only ever added to or removed from the local keyring, the forwarded
+// agent belongs to the user and is used read only.
+type chainAgent struct {
+	local    agent.Agent
+	upstream agent.Agent
+}
+
+func (c *chainAgent) List() ([]*agent.Key, error) {
+	keys, err := c.local.List()
+	if err != nil {
+		return nil, err
+	}
+	more, err := c.upstream.List()
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, more...), nil
+}
+
+// Sign uses whichever agent holds the key.
+func (c *chainAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	keys, err := c.local.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return c.local.Sign(key, data)
+		}
+	}
+	return c.upstream.Sign(key, data)
+}
+
+func (c *chainAgent) Add(key agent.AddedKey) error {
+	return c.local.Add(key)
+}
+
+func (c *chainAgent) Remove(key ssh.PublicKey) error {
+	return c.local.Remove(key)
+}
+
+func (c *chainAgent) RemoveAll() error {
+	return c.local.RemoveAll()
+}
+
+func (c *chainAgent) Lock(passphrase []byte) error {
+	return c.local.Lock(passphrase)
+}
+
+func (c *chainAgent) Unlock(passphrase []byte) error {
+	return c.local.Unlock(passphrase)
+}
+
+func (c *chainAgent) Signers() ([]ssh.Signer, error) {
+	signers, err := c.local.Signers()
+	if err != nil {
+		return nil, err
+	}
+	more, err := c.upstream.Signers()
+	if err != nil {
+		return nil, err
+	}
+	return append(signers, more...), nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyError is returned when a host presents a key other than the
+// ones previously learned for it.
+type HostKeyError struct {
+	Host string
+	Key  ssh.PublicKey
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("ssh: host key for %s changed, got %s %s",
+		e.Host, e.Key.Type(), fingerprint(e.Key))
+}
+
+// fingerprint formats a key's SHA256 fingerprint the same as OpenSSH.
+func fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// HostKeys verifies SSH host keys. Keys can be added up front if they
+// are known from a trusted source such as cloud metadata, otherwise the
+// first key a host presents is trusted and any different key offered by
+// that host later is rejected.
+type HostKeys struct {
+	// Learned, if not nil, is called whenever a new host's key is
+	// trusted on first use.
+	Learned func(host string, key ssh.PublicKey)
+
+	mu   sync.Mutex
+	keys map[string][]ssh.PublicKey
+}
+
+func NewHostKeys() *HostKeys {
+	return &HostKeys{
+		keys: make(map[string][]ssh.PublicKey),
+	}
+}
+
+// knownHost formats an address the way known_hosts files do, omitting
+// the default port.
+func knownHost(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if port == strconv.Itoa(defaultPort) {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+// Add trusts a key for the given address.
+func (k *HostKeys) Add(address string, key ssh.PublicKey) {
+	host := knownHost(ensurePortSuffix(address, defaultPort))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, known := range k.keys[host] {
+		if keysEqual(known, key) {
+			return
+		}
+	}
+	k.keys[host] = append(k.keys[host], key)
+}
+
+// Forget removes all keys for the given address, for example once the
+// machine using it is destroyed and the address may be reused.
+func (k *HostKeys) Forget(address string) {
+	host := knownHost(ensurePortSuffix(address, defaultPort))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, host)
+}
+
+// Check is suitable for use as a ssh.ClientConfig HostKeyCallback.
+func (k *HostKeys) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	host := knownHost(hostname)
+
+	k.mu.Lock()
+	known, ok := k.keys[host]
+	if !ok {
+		k.keys[host] = []ssh.PublicKey{key}
+	}
+	k.mu.Unlock()
+
+	if !ok {
+		if k.Learned != nil {
+			k.Learned(host, key)
+		}
+		return nil
+	}
+	for _, knownKey := range known {
+		if keysEqual(knownKey, key) {
+			return nil
+		}
+	}
+	return &HostKeyError{Host: host, Key: key}
+}
+
+// WriteKnownHosts writes all keys in the OpenSSH known_hosts format.
+func (k *HostKeys) WriteKnownHosts(w io.Writer) error {
+	k.mu.Lock()
+	hosts := make([]string, 0, len(k.keys))
+	for host := range k.keys {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var buf bytes.Buffer
+	for _, host := range hosts {
+		for _, key := range k.keys[host] {
+			fmt.Fprintf(&buf, "%s %s %s\n", host, key.Type(),
+				base64.StdEncoding.EncodeToString(key.Marshal()))
+		}
+	}
+	k.mu.Unlock()
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ReadKnownHosts adds the keys from an OpenSSH known_hosts file. Hashed
+// host names, wildcards, and markers such as @revoked are not supported
+// and those lines are skipped.
+func (k *HostKeys) ReadKnownHosts(r io.Reader) error {
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 || line[0] == '#' || line[0] == '@' || line[0] == '|' {
+			continue
+		}
+
+		fields := bytes.Fields(line)
+		if len(fields) < 3 {
+			return fmt.Errorf("known_hosts: invalid line %q", line)
+		}
+		keyBytes, err := base64.StdEncoding.DecodeString(string(fields[2]))
+		if err != nil {
+			return fmt.Errorf("known_hosts: %v", err)
+		}
+		key, err := ssh.ParsePublicKey(keyBytes)
+		if err != nil {
+			return fmt.Errorf("known_hosts: %v", err)
+		}
+
+		for _, host := range bytes.Split(fields[0], []byte{','}) {
+			if bytes.ContainsAny(host, "*?!") {
+				continue
+			}
+			k.Add(string(host), key)
+		}
+	}
+	return lines.Err()
+}
+
+func keysEqual(a, b ssh.PublicKey) bool {
+	return a.Type() == b.Type() && bytes.Equal(a.Marshal(), b.Marshal())
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/mockssh"
+)
+
+func TestHostKeys(t *testing.T) {
+	testKey, err := ssh.ParsePrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key1 := mockssh.HostKey()
+	key2 := testKey.PublicKey()
+
+	var learned []string
+	k := NewHostKeys()
+	k.Learned = func(host string, key ssh.PublicKey) {
+		learned = append(learned, host)
+	}
+
+	// trust on first use
+	if err := k.Check("10.0.0.1:22", nil, key1); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Check("10.0.0.1:22", nil, key1); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Check("10.0.0.1:22", nil, key2); err == nil {
+		t.Errorf("changed key accepted")
+	} else if _, ok := err.(*HostKeyError); !ok {
+		t.Errorf("unexpected error type %T: %v", err, err)
+	}
+
+	// keys are per port
+	if err := k.Check("10.0.0.1:2222", nil, key2); err != nil {
+		t.Fatal(err)
+	}
+
+	// known up front
+	k.Add("10.0.0.2", key2)
+	if err := k.Check("10.0.0.2:22", nil, key1); err == nil {
+		t.Errorf("unknown key accepted")
+	}
+
+	if strings.Join(learned, " ") != "10.0.0.1 [10.0.0.1]:2222" {
+		t.Errorf("unexpected learned hosts %q", learned)
+	}
+
+	var buf bytes.Buffer
+	if err := k.WriteKnownHosts(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "10.0.0.1 ssh-rsa ") ||
+		!strings.HasPrefix(lines[1], "10.0.0.2 ssh-rsa ") ||
+		!strings.HasPrefix(lines[2], "[10.0.0.1]:2222 ssh-rsa ") {
+		t.Errorf("unexpected known_hosts:\n%s", buf.String())
+	}
+
+	k2 := NewHostKeys()
+	if err := k2.ReadKnownHosts(strings.NewReader("# comment\n" + buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	if err := k2.WriteKnownHosts(&buf2); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != buf2.String() {
+		t.Errorf("round trip failed, got:\n%s\nwanted:\n%s", buf2.String(), buf.String())
+	}
+
+	// a new machine reusing the address
+	k.Forget("10.0.0.1")
+	if err := k.Check("10.0.0.1:22", nil, key2); err != nil {
+		t.Errorf("forgotten key still checked: %v", err)
+	}
+}
+
+// keyDialer connects to mock servers using the given host key.
+type keyDialer struct {
+	key ssh.Signer
+}
+
+func (d *keyDialer) Dial(network, address string) (net.Conn, error) {
+	return mockssh.NewServerConn(mockssh.ServerConfig{
+		Handler: func(s *mockssh.Session) { s.Exit(0) },
+		PublicKeyCallback: func(user string, key ssh.PublicKey) bool {
+			return true
+		},
+		HostKey: d.key,
+	}), nil
+}
+
+func TestSSHAgentHostKeys(t *testing.T) {
+	testKey, err := ssh.ParsePrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := &keyDialer{}
+	a, err := NewSSHAgent(dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	client, err := a.NewClient("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// the machine "rebooted" with a new key
+	dialer.key = testKey
+	if _, err := a.NewClient("host"); err == nil {
+		t.Fatal("connected despite a changed host key")
+	}
+}
@@ -31,6 +31,7 @@ type Formatter interface {
 type shortWriter struct {
 	w      io.Writer
 	tz     *time.Location
+	host   string
 	bootid string
 }
 
@@ -57,12 +58,21 @@ func (s *shortWriter) WriteEntry(entry Entry) error {
 	}
 
 	if s.isReboot(entry) {
-		io.WriteString(s.w, "-- Reboot --\n")
+		if s.host != "" {
+			io.WriteString(s.w, "-- Reboot "+s.host+" --\n")
+		} else {
+			io.WriteString(s.w, "-- Reboot --\n")
+		}
 	}
 
 	var buf bytes.Buffer
 	buf.WriteString(realtime.In(s.tz).Format(time.StampMicro))
 
+	if s.host != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(s.host)
+	}
+
 	if identifier, ok := entry[FIELD_SYSLOG_IDENTIFIER]; ok {
 		buf.WriteByte(' ')
 		buf.Write(identifier)
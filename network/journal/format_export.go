@@ -0,0 +1,178 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// addressFields are written first, in this order, by journalctl.
+var addressFields = []string{
+	FIELD_CURSOR,
+	FIELD_REALTIME_TIMESTAMP,
+	FIELD_MONOTONIC_TIMESTAMP,
+	FIELD_BOOT_ID,
+}
+
+// sortedFields returns the entry's field names with the address fields
+// first followed by the rest in lexical order.
+func (e Entry) sortedFields() []string {
+	fields := make([]string, 0, len(e))
+	for _, name := range addressFields {
+		if _, ok := e[name]; ok {
+			fields = append(fields, name)
+		}
+	}
+	start := len(fields)
+	for name := range e {
+		if !isAddressField(name) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields[start:])
+	return fields
+}
+
+func isAddressField(name string) bool {
+	for _, field := range addressFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary reports whether a value is not text, which journalctl's JSON
+// format writes as an array of bytes. Text is valid UTF-8 without control
+// characters other than newlines and tabs.
+func isBinary(value []byte) bool {
+	for _, b := range value {
+		if (b < ' ' && b != '\t' && b != '\n') || b == 0x7f {
+			return true
+		}
+	}
+	return !utf8.Valid(value)
+}
+
+// isExportBinary reports whether a value must use the binary encoding of
+// the export format, which also covers multi-line text.
+func isExportBinary(value []byte) bool {
+	return isBinary(value) || bytes.IndexByte(value, '\n') >= 0
+}
+
+type exportWriter struct {
+	w io.Writer
+}
+
+// ExportWriter writes journal entries in the lossless journal export
+// format read by ExportReader. Recordings in this format can be converted
+// into a native journal file readable by `journalctl --file` using
+// systemd-journal-remote.
+func ExportWriter(w io.Writer) Formatter {
+	return &exportWriter{w: w}
+}
+
+// SetTimezone does nothing, timestamps are always written as is.
+func (e *exportWriter) SetTimezone(tz *time.Location) {}
+
+func (e *exportWriter) WriteEntry(entry Entry) error {
+	var buf bytes.Buffer
+	for _, name := range entry.sortedFields() {
+		value := entry[name]
+		buf.WriteString(name)
+		if isExportBinary(value) {
+			buf.WriteByte('\n')
+			size := make([]byte, 8)
+			binary.LittleEndian.PutUint64(size, uint64(len(value)))
+			buf.Write(size)
+		} else {
+			buf.WriteByte('=')
+		}
+		buf.Write(value)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := buf.WriteTo(e.w)
+	return err
+}
+
+type jsonWriter struct {
+	w io.Writer
+}
+
+// JSONWriter writes journal entries as one JSON object per line, similar
+// to journalctl's "json" format. Text values, including multi-line
+// messages, are written as strings and other values as arrays of bytes.
+func JSONWriter(w io.Writer) Formatter {
+	return &jsonWriter{w: w}
+}
+
+// SetTimezone does nothing, timestamps are always written as is.
+func (j *jsonWriter) SetTimezone(tz *time.Location) {}
+
+func (j *jsonWriter) WriteEntry(entry Entry) error {
+	obj := make(map[string]interface{}, len(entry))
+	for name, value := range entry {
+		if isBinary(value) {
+			array := make([]int, len(value))
+			for i, b := range value {
+				array[i] = int(b)
+			}
+			obj[name] = array
+		} else {
+			obj[name] = string(value)
+		}
+	}
+
+	// Encode to a buffer first to avoid writing partial entries.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return err
+	}
+
+	_, err := buf.WriteTo(j.w)
+	return err
+}
+
+type multiFormatter []Formatter
+
+// MultiFormatter writes journal entries to all of the given formatters.
+func MultiFormatter(formatters ...Formatter) Formatter {
+	return multiFormatter(formatters)
+}
+
+func (m multiFormatter) SetTimezone(tz *time.Location) {
+	for _, f := range m {
+		f.SetTimezone(tz)
+	}
+}
+
+func (m multiFormatter) WriteEntry(entry Entry) error {
+	for _, f := range m {
+		if err := f.WriteEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r io.Reader) []Entry {
+	var entries []Entry
+	er := NewExportReader(r)
+	for {
+		entry, err := er.ReadEntry()
+		if err == io.EOF {
+			return entries
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestExportWriterRoundTrip(t *testing.T) {
+	for _, data := range []string{exportText, exportBinary} {
+		entries := readAll(t, strings.NewReader(data))
+
+		var buf bytes.Buffer
+		w := ExportWriter(&buf)
+		for _, entry := range entries {
+			if err := w.WriteEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := readAll(t, &buf); !reflect.DeepEqual(got, entries) {
+			t.Errorf("got %v wanted %v", got, entries)
+		}
+	}
+}
+
+func TestExportWriterFormat(t *testing.T) {
+	entry := Entry{
+		FIELD_MESSAGE:            []byte("multi\nline"),
+		FIELD_PRIORITY:           []byte("6"),
+		FIELD_BOOT_ID:            []byte("6c7c6013a26343b29e964691ff25d04c"),
+		FIELD_REALTIME_TIMESTAMP: []byte("1342540861421465"),
+		FIELD_CURSOR:             []byte("s=739ad463348b4ceca5a9e69c95a3c93f"),
+	}
+	expect := "__CURSOR=s=739ad463348b4ceca5a9e69c95a3c93f\n" +
+		"__REALTIME_TIMESTAMP=1342540861421465\n" +
+		"_BOOT_ID=6c7c6013a26343b29e964691ff25d04c\n" +
+		"MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\n" +
+		"PRIORITY=6\n" +
+		"\n"
+
+	var buf bytes.Buffer
+	if err := ExportWriter(&buf).WriteEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expect {
+		t.Errorf("got %q wanted %q", buf.String(), expect)
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	entries := readAll(t, strings.NewReader(exportBinary))
+	entries = append(entries, Entry{
+		FIELD_MESSAGE: []byte("multi\nline\twith tab"),
+		"BINARY":      []byte("nul\x00"),
+	})
+
+	var buf bytes.Buffer
+	w := JSONWriter(&buf)
+	for _, entry := range entries {
+		if err := w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := json.NewDecoder(&buf)
+	for _, entry := range entries {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err != nil {
+			t.Fatal(err)
+		}
+		if len(obj) != len(entry) {
+			t.Errorf("got %d fields wanted %d", len(obj), len(entry))
+		}
+		for name, value := range entry {
+			switch v := obj[name].(type) {
+			case string:
+				if isBinary(value) || v != string(value) {
+					t.Errorf("%s: got %q wanted %q", name, v, value)
+				}
+			case []interface{}:
+				if !isBinary(value) || len(v) != len(value) {
+					t.Errorf("%s: got %v wanted %q", name, v, value)
+				}
+			default:
+				t.Errorf("%s: unexpected value %v", name, v)
+			}
+		}
+	}
+}
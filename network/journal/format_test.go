@@ -178,3 +178,26 @@ Feb 14 20:15:16.372858 python3[16853]: foo
 		t.Errorf("unexpected output:\n%s", d)
 	}
 }
+
+func TestFormatShortGap(t *testing.T) {
+	var buf bytes.Buffer
+	w := MultiFormatter(ShortWriter(&buf), ExportWriter(&buf))
+	lost := time.Unix(0, 0)
+	for _, gap := range []Gap{
+		{Reason: GapReconnect, Lost: lost, Resumed: lost.Add(1500 * time.Millisecond)},
+		{Reason: GapReconnect, Lost: lost, Resumed: lost.Add(time.Second), Err: io.EOF},
+		{Reason: GapBootMissing, BootID: "6c7c6013a26343b29e964691ff25d04c"},
+	} {
+		if err := w.(GapWriter).WriteGap(gap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := `-- Journal stream lost, reconnected after 1.5s --
+-- Journal stream lost, reconnected after 1s (EOF) --
+-- Boot 6c7c6013a26343b29e964691ff25d04c is no longer in the journal, entries may be missing --
+`
+	if buf.String() != expect {
+		t.Errorf("%s", diff.Diff(expect, buf.String()))
+	}
+}
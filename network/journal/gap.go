@@ -0,0 +1,98 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GapReason describes why entries may be missing from a recording.
+type GapReason int
+
+const (
+	// GapReconnect is recorded when the journal stream ended
+	// unexpectedly and the recorder had to reconnect. Entries are
+	// resumed from the last cursor so normally nothing is lost.
+	GapReconnect GapReason = iota
+
+	// GapBootMissing is recorded when the boot the last cursor belongs
+	// to is no longer in the journal, for example after the journal was
+	// rotated or wiped. Recording restarts from the current boot and
+	// any entries in between are lost.
+	GapBootMissing
+)
+
+// Gap marks an interruption in a journal recording.
+type Gap struct {
+	Reason  GapReason
+	Lost    time.Time // when the stream was lost
+	Resumed time.Time // when recording resumed
+	Err     error     // why the stream was lost, if known
+	BootID  string    // the missing boot for GapBootMissing
+}
+
+func (g Gap) String() string {
+	switch g.Reason {
+	case GapReconnect:
+		d := g.Resumed.Sub(g.Lost)
+		d -= d % time.Millisecond
+		s := fmt.Sprintf("Journal stream lost, reconnected after %v", d)
+		if g.Err != nil {
+			s += fmt.Sprintf(" (%v)", g.Err)
+		}
+		return s
+	case GapBootMissing:
+		return fmt.Sprintf("Boot %s is no longer in the journal, entries may be missing", g.BootID)
+	default:
+		return "Unknown journal gap"
+	}
+}
+
+// GapWriter is implemented by Formatters that can mark interruptions in
+// the recording. Formatters that only write journal entries as is, such
+// as the export format, do not implement it.
+type GapWriter interface {
+	WriteGap(g Gap) error
+}
+
+// WriteGap writes a marker similar to the one for reboots.
+func (s *shortWriter) WriteGap(g Gap) error {
+	_, err := io.WriteString(s.w, "-- "+g.String()+" --\n")
+	return err
+}
+
+func (m multiFormatter) WriteGap(g Gap) error {
+	for _, f := range m {
+		if gw, ok := f.(GapWriter); ok {
+			if err := gw.WriteGap(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cursorBootID extracts the boot ID from a journal cursor.
+func cursorBootID(cursor string) string {
+	for _, field := range strings.Split(cursor, ";") {
+		if strings.HasPrefix(field, "b=") {
+			return field[2:]
+		}
+	}
+	return ""
+}
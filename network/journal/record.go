@@ -18,6 +18,8 @@ import (
 	"context"
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/kballard/go-shellquote"
 	"golang.org/x/crypto/ssh"
@@ -25,19 +27,51 @@ import (
 	"github.com/coreos/mantle/system/exec"
 )
 
+// Default delays between reconnection attempts in FollowSSH.
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 30 * time.Second
+)
+
 type Recorder struct {
 	formatter Formatter
 	cursor    string
 	status    chan error
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	watchMu sync.Mutex
+	watches map[*Watch]struct{}
 }
 
 func NewRecorder(f Formatter) *Recorder {
 	return &Recorder{
-		formatter: f,
-		status:    make(chan error, 1),
+		formatter:  f,
+		status:     make(chan error, 1),
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
 	}
 }
 
+// writeError marks a failure of the local formatter, as opposed to the
+// journal stream, so FollowSSH knows not to reconnect.
+type writeError struct {
+	err error
+}
+
+func (e writeError) Error() string {
+	return e.err.Error()
+}
+
+// unwrapWriteError returns the formatter's original error.
+func unwrapWriteError(err error) error {
+	if we, ok := err.(writeError); ok {
+		return we.err
+	}
+	return err
+}
+
 func (r *Recorder) journalctl() []string {
 	cmd := []string{"journalctl",
 		"--output=export", "--follow", "--lines=all"}
@@ -63,12 +97,30 @@ func (r *Recorder) record(export io.Reader) error {
 		r.cursor = string(entry[FIELD_CURSOR])
 
 		if err := r.formatter.WriteEntry(entry); err != nil {
-			return err
+			return writeError{err}
 		}
+
+		r.notify(entry)
 	}
 }
 
 func (r *Recorder) StartSSH(ctx context.Context, client *ssh.Client) error {
+	wait, err := r.startSession(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		r.status <- unwrapWriteError(wait())
+	}()
+
+	return nil
+}
+
+// startSession runs journalctl over the given connection, returning a
+// function which waits for the stream to end. The connection is closed
+// once the stream ends or the context is canceled.
+func (r *Recorder) startSession(ctx context.Context, client *ssh.Client) (func() error, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	go func() {
 		<-ctx.Done()
@@ -78,23 +130,23 @@ func (r *Recorder) StartSSH(ctx context.Context, client *ssh.Client) error {
 	journal, err := client.NewSession()
 	if err != nil {
 		cancel()
-		return err
+		return nil, err
 	}
 	journal.Stderr = os.Stderr
 
 	export, err := journal.StdoutPipe()
 	if err != nil {
 		cancel()
-		return err
+		return nil, err
 	}
 
 	cmd := shellquote.Join(r.journalctl()...)
 	if err := journal.Start(cmd); err != nil {
 		cancel()
-		return err
+		return nil, err
 	}
 
-	go func() {
+	wait := func() error {
 		err := r.record(export)
 		cancel()
 		err2 := journal.Wait()
@@ -105,12 +157,132 @@ func (r *Recorder) StartSSH(ctx context.Context, client *ssh.Client) error {
 		if err == nil && err2 != nil {
 			err = err2
 		}
-		r.status <- err
+		return err
+	}
+
+	return wait, nil
+}
+
+// FollowSSH is like StartSSH but keeps recording until the context is
+// canceled, reconnecting with exponential backoff whenever the stream is
+// lost. Each interruption is passed to the formatter if it implements
+// GapWriter. Errors from the initial connection are returned directly;
+// errors writing to the formatter stop recording and are returned by Wait.
+func (r *Recorder) FollowSSH(ctx context.Context, dial func() (*ssh.Client, error)) error {
+	wait, err := r.connect(ctx, dial)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		r.status <- r.follow(ctx, dial, wait)
 	}()
 
 	return nil
 }
 
+// connect dials a new connection and starts streaming from the last
+// cursor, or from the start of the current boot if the cursor's boot is
+// no longer in the journal.
+func (r *Recorder) connect(ctx context.Context, dial func() (*ssh.Client, error)) (func() error, error) {
+	client, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if bootid := cursorBootID(r.cursor); bootid != "" {
+		ok, err := hasBoot(client, bootid)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		if !ok {
+			r.cursor = ""
+			r.writeGap(Gap{
+				Reason:  GapBootMissing,
+				Lost:    time.Now(),
+				Resumed: time.Now(),
+				BootID:  bootid,
+			})
+		}
+	}
+
+	return r.startSession(ctx, client)
+}
+
+func (r *Recorder) follow(ctx context.Context, dial func() (*ssh.Client, error), wait func() error) error {
+	backoff := r.minBackoff
+	for {
+		cursor := r.cursor
+		err := wait()
+		if ctx.Err() != nil {
+			return nil
+		}
+		// Reconnecting won't fix a broken output.
+		if we, ok := err.(writeError); ok {
+			return we.err
+		}
+		lost := time.Now()
+
+		// Start over with a short delay if the last session
+		// made some progress.
+		if r.cursor != cursor {
+			backoff = r.minBackoff
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+
+			var err2 error
+			if wait, err2 = r.connect(ctx, dial); err2 == nil {
+				break
+			}
+		}
+
+		r.writeGap(Gap{
+			Reason:  GapReconnect,
+			Lost:    lost,
+			Resumed: time.Now(),
+			Err:     err,
+		})
+	}
+}
+
+// hasBoot reports whether the remote journal still contains the boot.
+func hasBoot(client *ssh.Client, bootid string) (bool, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+
+	err = session.Run(shellquote.Join(
+		"journalctl", "--quiet", "--lines=0", "--boot="+bootid))
+	if _, ok := err.(*ssh.ExitError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *Recorder) writeGap(g Gap) {
+	gw, ok := r.formatter.(GapWriter)
+	if !ok {
+		return
+	}
+	// A broken output will also fail the next WriteEntry, which is
+	// where the error gets reported.
+	gw.WriteGap(g)
+}
+
 func (r *Recorder) StartLocal(ctx context.Context) error {
 	cmd := r.journalctl()
 	journal := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
@@ -126,7 +298,7 @@ func (r *Recorder) StartLocal(ctx context.Context) error {
 	}
 
 	go func() {
-		err := r.record(export)
+		err := unwrapWriteError(r.record(export))
 		err2 := journal.Wait()
 		if err == nil && err2 != nil {
 			err = err2
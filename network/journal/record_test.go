@@ -16,11 +16,14 @@ package journal
 
 import (
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/coreos/mantle/network/mockssh"
 )
 
@@ -128,3 +131,132 @@ func TestRecorderSSHCancel(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type gapFormatter struct {
+	nullFormatter
+	gaps chan Gap
+}
+
+func (g *gapFormatter) WriteGap(gap Gap) error {
+	g.gaps <- gap
+	return nil
+}
+
+func TestRecorderFollowSSH(t *testing.T) {
+	bootText := cursorBootID(cursorText)
+	if bootText != "6c7c6013a26343b29e964691ff25d04c" {
+		t.Fatalf("unexpected boot id %q", bootText)
+	}
+	hasBootCmd := "journalctl --quiet --lines=0 --boot=" + bootText
+
+	// Each connection handles a list of expected commands in order.
+	type step struct {
+		cmd    string
+		output string
+		status int
+		hang   bool
+	}
+	conns := [][]step{
+		{{cmd: journalBoot, output: exportText}},
+		{{cmd: hasBootCmd}, {cmd: journalAfterEsc(cursorText), output: exportText}},
+		{{cmd: hasBootCmd, status: 1}, {cmd: journalBoot, hang: true}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := 0
+	dial := func() (*ssh.Client, error) {
+		if next >= len(conns) {
+			t.Errorf("unexpected connection %d", next)
+			return nil, io.EOF
+		}
+		steps := conns[next]
+		next++
+		return mockssh.NewMockClient(func(s *mockssh.Session) {
+			if len(steps) == 0 {
+				t.Errorf("unexpected session %q", s.Exec)
+				return
+			}
+			st := steps[0]
+			steps = steps[1:]
+			if s.Exec != st.cmd {
+				t.Errorf("got %q wanted %q", s.Exec, st.cmd)
+			}
+			if _, err := io.WriteString(s.Stdout, st.output); err != nil {
+				t.Error(err)
+			}
+			if st.hang {
+				return
+			}
+			if err := s.Exit(st.status); err != nil {
+				t.Error(err)
+			}
+		}), nil
+	}
+
+	formatter := &gapFormatter{gaps: make(chan Gap, 10)}
+	recorder := NewRecorder(formatter)
+	recorder.minBackoff = time.Millisecond
+	if err := recorder.FollowSSH(ctx, dial); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []GapReason{GapReconnect, GapBootMissing, GapReconnect}
+	for i, reason := range expect {
+		select {
+		case gap := <-formatter.gaps:
+			if gap.Reason != reason {
+				t.Errorf("gap %d: got %v wanted %v", i, gap.Reason, reason)
+			}
+			if gap.Reason == GapBootMissing && gap.BootID != bootText {
+				t.Errorf("gap %d: got boot %q wanted %q", i, gap.BootID, bootText)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for gap %d", i)
+		}
+	}
+
+	cancel()
+	if err := recorder.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.cursor != "" {
+		t.Errorf("got cursor %q wanted none", recorder.cursor)
+	}
+}
+
+type errFormatter struct {
+	nullFormatter
+	err error
+}
+
+func (e errFormatter) WriteEntry(entry Entry) error {
+	return e.err
+}
+
+func TestRecorderFollowSSHWriteError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dials := 0
+	dial := func() (*ssh.Client, error) {
+		dials++
+		return mockssh.NewMockClient(func(s *mockssh.Session) {
+			io.WriteString(s.Stdout, exportText)
+			s.Exit(0)
+		}), nil
+	}
+
+	writeErr := errors.New("disk full")
+	recorder := NewRecorder(errFormatter{err: writeErr})
+	recorder.minBackoff = time.Millisecond
+	if err := recorder.FollowSSH(ctx, dial); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recorder.Wait(); err != writeErr {
+		t.Errorf("got error %v wanted %v", err, writeErr)
+	}
+	if dials != 1 {
+		t.Errorf("got %d connections wanted 1", dials)
+	}
+}
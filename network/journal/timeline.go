@@ -0,0 +1,196 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"container/heap"
+	"io"
+	"time"
+)
+
+// TimelineEntry is a journal entry along with the name of the recording
+// it was read from.
+type TimelineEntry struct {
+	Name  string
+	Entry Entry
+}
+
+// Timeline merges journal recordings in the export format from several
+// machines into a single stream ordered by realtime timestamp. Entries
+// without a timestamp cannot be placed and are skipped.
+type Timeline struct {
+	// Filters select which entries are included, an entry is included
+	// if it matches any of them. All entries are included if empty.
+	Filters []Filter
+
+	// Since and Until restrict entries to a time window. The zero
+	// value leaves that end of the window open.
+	Since time.Time
+	Until time.Time
+
+	pending []*timelineSource
+	sources timelineHeap
+}
+
+type timelineSource struct {
+	name     string
+	order    int // breaks ties between equal timestamps.
+	reader   *ExportReader
+	entry    Entry
+	realtime time.Time
+}
+
+// Add includes the recording read from r under the given name.
+func (t *Timeline) Add(name string, r io.Reader) {
+	t.pending = append(t.pending, &timelineSource{
+		name:   name,
+		order:  len(t.pending) + len(t.sources),
+		reader: NewExportReader(r),
+	})
+}
+
+// Next returns the earliest remaining entry, or io.EOF once all
+// recordings have been exhausted. A recording which ends part way
+// through an entry, such as one from a machine that was destroyed while
+// recording, is treated as complete.
+func (t *Timeline) Next() (TimelineEntry, error) {
+	for _, src := range t.pending {
+		if ok, err := t.advance(src); err != nil {
+			return TimelineEntry{}, err
+		} else if ok {
+			heap.Push(&t.sources, src)
+		}
+	}
+	t.pending = nil
+
+	if len(t.sources) == 0 {
+		return TimelineEntry{}, io.EOF
+	}
+
+	src := t.sources[0]
+	next := TimelineEntry{Name: src.name, Entry: src.entry}
+	if ok, err := t.advance(src); err != nil {
+		return TimelineEntry{}, err
+	} else if ok {
+		heap.Fix(&t.sources, 0)
+	} else {
+		heap.Pop(&t.sources)
+	}
+	return next, nil
+}
+
+// advance reads the next included entry from src, returning false once
+// there are none left.
+func (t *Timeline) advance(src *timelineSource) (bool, error) {
+	for {
+		entry, err := src.reader.ReadEntry()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			src.entry = nil
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		realtime := entry.Realtime()
+		if realtime.IsZero() || !t.include(entry, realtime) {
+			continue
+		}
+
+		src.entry = entry
+		src.realtime = realtime
+		return true, nil
+	}
+}
+
+func (t *Timeline) include(entry Entry, realtime time.Time) bool {
+	if !t.Since.IsZero() && realtime.Before(t.Since) {
+		return false
+	}
+	if !t.Until.IsZero() && realtime.After(t.Until) {
+		return false
+	}
+	if len(t.Filters) == 0 {
+		return true
+	}
+	for i := range t.Filters {
+		if t.Filters[i].Match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+type timelineHeap []*timelineSource
+
+func (h timelineHeap) Len() int { return len(h) }
+
+func (h timelineHeap) Less(i, j int) bool {
+	if h[i].realtime.Equal(h[j].realtime) {
+		return h[i].order < h[j].order
+	}
+	return h[i].realtime.Before(h[j].realtime)
+}
+
+func (h timelineHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *timelineHeap) Push(x interface{}) {
+	*h = append(*h, x.(*timelineSource))
+}
+
+func (h *timelineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// TimelineWriter writes merged entries in the same format as ShortWriter
+// with the name of each entry's recording in place of the hostname.
+type TimelineWriter struct {
+	w       io.Writer
+	tz      *time.Location
+	writers map[string]*shortWriter
+}
+
+func NewTimelineWriter(w io.Writer) *TimelineWriter {
+	return &TimelineWriter{
+		w:       w,
+		tz:      time.Local,
+		writers: make(map[string]*shortWriter),
+	}
+}
+
+// SetTimezone updates the time location. The default is local time.
+func (t *TimelineWriter) SetTimezone(tz *time.Location) {
+	t.tz = tz
+	for _, s := range t.writers {
+		s.SetTimezone(tz)
+	}
+}
+
+// WriteEntry writes a single entry, marking reboots of each recording.
+func (t *TimelineWriter) WriteEntry(e TimelineEntry) error {
+	s, ok := t.writers[e.Name]
+	if !ok {
+		s = &shortWriter{
+			w:    t.w,
+			tz:   t.tz,
+			host: e.Name,
+		}
+		t.writers[e.Name] = s
+	}
+	return s.WriteEntry(e.Entry)
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// timelineRecording builds an export format recording with one entry per
+// message, the timestamps given in seconds.
+func timelineRecording(t *testing.T, boot string, entries ...interface{}) *bytes.Buffer {
+	var buf bytes.Buffer
+	w := ExportWriter(&buf)
+	for i := 0; i < len(entries); i += 3 {
+		sec := entries[i].(int)
+		entry := Entry{
+			FIELD_REALTIME_TIMESTAMP: []byte(strconv.Itoa(sec * 1000000)),
+			FIELD_BOOT_ID:            []byte(boot),
+			FIELD_SYSTEMD_UNIT:       []byte(entries[i+1].(string)),
+			FIELD_SYSLOG_IDENTIFIER:  []byte(entries[i+1].(string)),
+			FIELD_MESSAGE:            []byte(entries[i+2].(string)),
+		}
+		if err := w.WriteEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func TestTimeline(t *testing.T) {
+	newTimeline := func() *Timeline {
+		tl := &Timeline{}
+		tl.Add("m1", timelineRecording(t, "a",
+			1, "etcd", "starting",
+			3, "etcd", "elected leader",
+			5, "locksmithd", "rebooting"))
+		// A machine that rebooted, partially truncated.
+		m2 := timelineRecording(t, "b",
+			2, "etcd", "starting",
+			3, "etcd", "following leader")
+		m2.WriteString(timelineRecording(t, "c",
+			6, "etcd", "starting").String())
+		m2.WriteString("MESSAGE=cut off")
+		tl.Add("m2", m2)
+		tl.Add("empty", &bytes.Buffer{})
+		return tl
+	}
+
+	read := func(tl *Timeline) string {
+		var buf bytes.Buffer
+		w := NewTimelineWriter(&buf)
+		w.SetTimezone(time.UTC)
+		for {
+			e, err := tl.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteEntry(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.String()
+	}
+
+	expect := `Jan  1 00:00:01.000000 m1 etcd: starting
+Jan  1 00:00:02.000000 m2 etcd: starting
+Jan  1 00:00:03.000000 m1 etcd: elected leader
+Jan  1 00:00:03.000000 m2 etcd: following leader
+Jan  1 00:00:05.000000 m1 locksmithd: rebooting
+-- Reboot m2 --
+Jan  1 00:00:06.000000 m2 etcd: starting
+`
+	if got := read(newTimeline()); got != expect {
+		t.Errorf("%s", diff.Diff(expect, got))
+	}
+
+	tl := newTimeline()
+	tl.Filters = []Filter{{Unit: "etcd"}}
+	tl.Since = time.Unix(2, 0)
+	tl.Until = time.Unix(4, 0)
+	expect = `Jan  1 00:00:02.000000 m2 etcd: starting
+Jan  1 00:00:03.000000 m1 etcd: elected leader
+Jan  1 00:00:03.000000 m2 etcd: following leader
+`
+	if got := read(tl); got != expect {
+		t.Errorf("%s", diff.Diff(expect, got))
+	}
+}
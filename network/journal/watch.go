@@ -0,0 +1,155 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const watchBufferSize = 64
+
+// Priority is a syslog priority level. The values are offset by one from
+// the numbers used in the PRIORITY field so the zero value matches any.
+type Priority int
+
+const (
+	PriorityAny Priority = iota
+	PriorityEmerg
+	PriorityAlert
+	PriorityCrit
+	PriorityErr
+	PriorityWarning
+	PriorityNotice
+	PriorityInfo
+	PriorityDebug
+)
+
+// Priority parses the PRIORITY field, returning PriorityAny if missing.
+func (e Entry) Priority() Priority {
+	p, err := strconv.Atoi(string(e[FIELD_PRIORITY]))
+	if err != nil || p < 0 || p > 7 {
+		return PriorityAny
+	}
+	return Priority(p + 1)
+}
+
+// Filter selects journal entries. Fields left as the zero value match
+// any entry.
+type Filter struct {
+	Unit       string         // exact match of _SYSTEMD_UNIT
+	Identifier string         // exact match of SYSLOG_IDENTIFIER
+	Message    *regexp.Regexp // search within MESSAGE
+	Priority   Priority       // entries of this priority or more severe
+}
+
+// Match reports whether the entry is selected by the filter.
+func (f *Filter) Match(entry Entry) bool {
+	if f.Unit != "" && string(entry[FIELD_SYSTEMD_UNIT]) != f.Unit {
+		return false
+	}
+	if f.Identifier != "" && string(entry[FIELD_SYSLOG_IDENTIFIER]) != f.Identifier {
+		return false
+	}
+	if f.Message != nil && !f.Message.Match(entry[FIELD_MESSAGE]) {
+		return false
+	}
+	if f.Priority != PriorityAny {
+		p := entry.Priority()
+		if p == PriorityAny || p > f.Priority {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch receives entries matching a Filter as they are recorded. Up to
+// 64 unread entries are buffered, further matches are dropped until the
+// buffer is drained.
+type Watch struct {
+	filter  Filter
+	entries chan Entry
+	r       *Recorder
+}
+
+// Watch subscribes to entries matching the filter recorded from now on.
+// The caller should call Stop when finished with the Watch.
+func (r *Recorder) Watch(f Filter) *Watch {
+	w := &Watch{
+		filter:  f,
+		entries: make(chan Entry, watchBufferSize),
+		r:       r,
+	}
+
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	if r.watches == nil {
+		r.watches = make(map[*Watch]struct{})
+	}
+	r.watches[w] = struct{}{}
+	return w
+}
+
+// notify sends the entry to all matching watches.
+func (r *Recorder) notify(entry Entry) {
+	r.watchMu.Lock()
+	defer r.watchMu.Unlock()
+	for w := range r.watches {
+		if !w.filter.Match(entry) {
+			continue
+		}
+		select {
+		case w.entries <- entry:
+		default:
+		}
+	}
+}
+
+// Entries returns the channel matching entries are delivered on.
+func (w *Watch) Entries() <-chan Entry {
+	return w.entries
+}
+
+// Next returns the next matching entry, blocking until one is recorded
+// or the context is done.
+func (w *Watch) Next(ctx context.Context) (Entry, error) {
+	select {
+	case entry := <-w.entries:
+		return entry, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Wait is like Next but gives up after the given timeout.
+func (w *Watch) Wait(timeout time.Duration) (Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	entry, err := w.Next(ctx)
+	if err == context.DeadlineExceeded {
+		err = fmt.Errorf("journal: no matching entry after %v", timeout)
+	}
+	return entry, err
+}
+
+// Stop unsubscribes the Watch. Buffered entries may still be read.
+func (w *Watch) Stop() {
+	w.r.watchMu.Lock()
+	defer w.r.watchMu.Unlock()
+	delete(w.r.watches, w)
+}
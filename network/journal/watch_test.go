@@ -0,0 +1,90 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/network/mockssh"
+)
+
+func TestFilterMatch(t *testing.T) {
+	entry := Entry{
+		FIELD_SYSTEMD_UNIT:      []byte("crond.service"),
+		FIELD_SYSLOG_IDENTIFIER: []byte("/USR/SBIN/CROND"),
+		FIELD_PRIORITY:          []byte("4"),
+		FIELD_MESSAGE:           []byte("(root) CMD (run-parts /etc/cron.hourly)"),
+	}
+	for _, testcase := range []struct {
+		filter Filter
+		match  bool
+	}{
+		{Filter{}, true},
+		{Filter{Unit: "crond.service"}, true},
+		{Filter{Unit: "sshd.service"}, false},
+		{Filter{Identifier: "/USR/SBIN/CROND"}, true},
+		{Filter{Identifier: "crond"}, false},
+		{Filter{Message: regexp.MustCompile(`run-parts`)}, true},
+		{Filter{Message: regexp.MustCompile(`^run-parts`)}, false},
+		{Filter{Priority: PriorityWarning}, true},
+		{Filter{Priority: PriorityDebug}, true},
+		{Filter{Priority: PriorityErr}, false},
+		{Filter{Unit: "crond.service", Priority: PriorityErr}, false},
+	} {
+		if m := testcase.filter.Match(entry); m != testcase.match {
+			t.Errorf("%+v: got %t wanted %t", testcase.filter, m, testcase.match)
+		}
+	}
+
+	if m := (&Filter{Priority: PriorityDebug}).Match(Entry{}); m {
+		t.Errorf("entry without a priority matched a priority filter")
+	}
+}
+
+func TestRecorderWatch(t *testing.T) {
+	recorder := NewRecorder(nullFormatter{})
+	cron := recorder.Watch(Filter{Identifier: "/USR/SBIN/CROND"})
+	defer cron.Stop()
+	missing := recorder.Watch(Filter{Unit: "missing.service"})
+	defer missing.Stop()
+
+	client := mockssh.NewMockClient(func(s *mockssh.Session) {
+		if _, err := io.WriteString(s.Stdout, exportText); err != nil {
+			t.Error(err)
+		}
+		if err := s.Exit(0); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := recorder.RunSSH(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := cron.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(entry[FIELD_MESSAGE]); msg != "(root) CMD (run-parts /etc/cron.hourly)" {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	if _, err := missing.Wait(10 * time.Millisecond); err == nil {
+		t.Errorf("expected a timeout")
+	}
+}
@@ -0,0 +1,647 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockssh
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kballard/go-shellquote"
+	"golang.org/x/crypto/ssh"
+)
+
+// Response is the canned result of a scripted command.
+type Response struct {
+	Stdout string
+	Stderr string
+	Status int
+}
+
+// UserID is the uid and gid of the SSH user on a Host, as reported by
+// the id builtin.
+const UserID = 500
+
+// File is an entry in a Host's fake filesystem. Files are owned by root
+// unless written over SFTP, which acts as UserID, or extracted by tar.
+type File struct {
+	Data []byte
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// Host simulates a simple machine. Commands are looked up by their exact
+// text in a table of scripted responses, falling back to a few builtin
+// commands (cat, echo, false, grep, id, install, mkdir, rm, tar, tee and
+// true) that operate on an in-memory filesystem. A leading "sudo" is ignored.
+// Shell sessions read commands from stdin one line at a time. Relative
+// paths are kept as is, "." stands in for the home directory.
+type Host struct {
+	mu         sync.Mutex
+	commands   map[string]SessionHandler
+	subsystems map[string]SessionHandler
+	files      map[string]File
+	dirs       map[string]bool
+	history    []string
+}
+
+// NewHost creates an empty Host.
+func NewHost() *Host {
+	return &Host{
+		commands:   make(map[string]SessionHandler),
+		subsystems: make(map[string]SessionHandler),
+		files:      make(map[string]File),
+		dirs:       map[string]bool{"/": true, ".": true},
+	}
+}
+
+// NewClient returns a client connected to a new server for the host.
+func (h *Host) NewClient() *ssh.Client {
+	return NewMockClient(h.ServeSession)
+}
+
+// AddCommand scripts the response to a command.
+func (h *Host) AddCommand(cmd string, r Response) {
+	h.AddCommandFunc(cmd, func(s *Session) {
+		io.WriteString(s.Stdout, r.Stdout)
+		io.WriteString(s.Stderr, r.Stderr)
+		s.Exit(r.Status)
+	})
+}
+
+// AddCommandFunc handles a command with a custom function.
+func (h *Host) AddCommandFunc(cmd string, f SessionHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commands[cmd] = f
+}
+
+// AddSubsystem handles requests for a subsystem such as "sftp".
+func (h *Host) AddSubsystem(name string, f SessionHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subsystems[name] = f
+}
+
+// WriteFile creates or replaces a file owned by root, creating parent
+// directories.
+func (h *Host) WriteFile(name string, data []byte, mode os.FileMode) {
+	h.writeFile(name, File{Data: data, Mode: mode})
+}
+
+func (h *Host) writeFile(name string, f File) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name = path.Clean(name)
+	h.mkdirAll(path.Dir(name))
+	f.Data = append([]byte(nil), f.Data...)
+	h.files[name] = f
+}
+
+// mkdirAll must be called with h.mu held.
+func (h *Host) mkdirAll(dir string) {
+	for dir = path.Clean(dir); !h.dirs[dir]; dir = path.Dir(dir) {
+		h.dirs[dir] = true
+	}
+}
+
+// RemoveFile deletes a file, returning false if it did not exist.
+func (h *Host) RemoveFile(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name = path.Clean(name)
+	_, ok := h.files[name]
+	delete(h.files, name)
+	return ok
+}
+
+// ReadFile returns a file from the fake filesystem.
+func (h *Host) ReadFile(name string) (File, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[path.Clean(name)]
+	return f, ok
+}
+
+// IsDir reports whether a directory exists in the fake filesystem.
+func (h *Host) IsDir(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dirs[path.Clean(name)]
+}
+
+// History returns all commands executed so far, including those run from
+// a shell.
+func (h *Host) History() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.history...)
+}
+
+// Files lists the paths of all files in the fake filesystem.
+func (h *Host) Files() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var names []string
+	for name := range h.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServeSession is a SessionHandler for the host.
+func (h *Host) ServeSession(s *Session) {
+	switch {
+	case s.Subsystem != "":
+		h.mu.Lock()
+		f, ok := h.subsystems[s.Subsystem]
+		h.mu.Unlock()
+		if !ok {
+			fmt.Fprintf(s.Stderr, "mockssh: unknown subsystem %q\n", s.Subsystem)
+			s.Exit(1)
+			return
+		}
+		f(s)
+	case s.Shell:
+		h.shell(s)
+	default:
+		h.mu.Lock()
+		h.history = append(h.history, s.Exec)
+		f, ok := h.commands[s.Exec]
+		h.mu.Unlock()
+		if ok {
+			f(s)
+			return
+		}
+		s.Exit(h.builtin(s.Exec, s.Stdin, s.Stdout, s.Stderr))
+	}
+}
+
+// shell runs commands read from stdin until "exit" or end of input,
+// exiting with the status of the last command.
+func (h *Host) shell(s *Session) {
+	prompt := func() {
+		if s.Pty != nil {
+			io.WriteString(s.Stdout, "$ ")
+		}
+	}
+
+	status := 0
+	lines := bufio.NewScanner(s.Stdin)
+	prompt()
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "exit" {
+			break
+		}
+		if line != "" {
+			status = h.run(s, line)
+		}
+		prompt()
+	}
+	s.Exit(status)
+}
+
+// run executes a single command from a shell, returning its exit status.
+func (h *Host) run(s *Session, cmd string) int {
+	h.mu.Lock()
+	h.history = append(h.history, cmd)
+	f, ok := h.commands[cmd]
+	h.mu.Unlock()
+
+	// Commands in a shell cannot read stdin.
+	stdin := strings.NewReader("")
+	if !ok {
+		return h.builtin(cmd, stdin, s.Stdout, s.Stderr)
+	}
+
+	// Scripted commands expect a session of their own, capture the
+	// exit status rather than letting them end the shell.
+	status := make(chan int, 1)
+	sub := *s
+	sub.Exec = cmd
+	sub.Shell = false
+	sub.Stdin = stdin
+	sub.channel = &statusChannel{Channel: s.channel, status: status}
+	f(&sub)
+	select {
+	case code := <-status:
+		return code
+	default:
+		return 0
+	}
+}
+
+// builtin executes one of the builtin commands.
+func (h *Host) builtin(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+	args, err := shellquote.Split(cmd)
+	if err != nil {
+		fmt.Fprintf(stderr, "mockssh: %v\n", err)
+		return 2
+	}
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return 0
+	}
+
+	builtin, ok := builtins[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "mockssh: %s: command not found\n", args[0])
+		return 127
+	}
+
+	return builtin(h, args[1:], stdin, stdout, stderr)
+}
+
+// statusChannel captures the exit status of scripted commands instead of
+// ending the whole session.
+type statusChannel struct {
+	ssh.Channel
+	status chan int
+}
+
+func (c *statusChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	if name == "exit-status" {
+		v := struct{ Status uint32 }{}
+		if err := ssh.Unmarshal(payload, &v); err != nil {
+			return false, err
+		}
+		c.status <- int(v.Status)
+		return true, nil
+	}
+	return c.Channel.SendRequest(name, wantReply, payload)
+}
+
+func (c *statusChannel) Close() error {
+	return nil
+}
+
+type builtinFunc func(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var builtins map[string]builtinFunc
+
+func init() {
+	builtins = map[string]builtinFunc{
+		"cat":     builtinCat,
+		"echo":    builtinEcho,
+		"false":   func(*Host, []string, io.Reader, io.Writer, io.Writer) int { return 1 },
+		"grep":    builtinGrep,
+		"id":      builtinID,
+		"install": builtinInstall,
+		"mkdir":   builtinMkdir,
+		"rm":      builtinRm,
+		"tar":     builtinTar,
+		"tee":     builtinTee,
+		"true":    func(*Host, []string, io.Reader, io.Writer, io.Writer) int { return 0 },
+	}
+}
+
+// splitFlags separates leading flags from the remaining arguments.
+func splitFlags(args []string) (flags, rest []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return flags, args[i+1:]
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return flags, args[i:]
+		}
+		flags = append(flags, arg)
+	}
+	return flags, nil
+}
+
+func builtinCat(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	status := 0
+	for _, name := range args {
+		if name == "-" || name == "/dev/stdin" {
+			io.Copy(stdout, stdin)
+			continue
+		}
+		f, ok := h.ReadFile(name)
+		if !ok {
+			fmt.Fprintf(stderr, "cat: %s: No such file or directory\n", name)
+			status = 1
+			continue
+		}
+		stdout.Write(f.Data)
+	}
+	return status
+}
+
+func builtinEcho(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fmt.Fprintln(stdout, strings.Join(args, " "))
+	return 0
+}
+
+func builtinGrep(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, args := splitFlags(args)
+	if len(flags) != 0 || len(args) == 0 {
+		fmt.Fprintf(stderr, "grep: usage: grep PATTERN [FILE...]\n")
+		return 2
+	}
+	re, err := regexp.Compile(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "grep: %v\n", err)
+		return 2
+	}
+
+	var inputs []io.Reader
+	for _, name := range args[1:] {
+		f, ok := h.ReadFile(name)
+		if !ok {
+			fmt.Fprintf(stderr, "grep: %s: No such file or directory\n", name)
+			return 2
+		}
+		inputs = append(inputs, bytes.NewReader(f.Data))
+	}
+	if len(inputs) == 0 {
+		inputs = append(inputs, stdin)
+	}
+
+	status := 1
+	lines := bufio.NewScanner(io.MultiReader(inputs...))
+	for lines.Scan() {
+		if re.Match(lines.Bytes()) {
+			fmt.Fprintf(stdout, "%s\n", lines.Bytes())
+			status = 0
+		}
+	}
+	return status
+}
+
+func builtinID(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 1 || (args[0] != "-u" && args[0] != "-g") {
+		fmt.Fprintf(stderr, "id: only -u and -g are supported\n")
+		return 1
+	}
+	fmt.Fprintf(stdout, "%d\n", UserID)
+	return 0
+}
+
+func builtinInstall(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	mode := os.FileMode(0755)
+	var files []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-m" && i+1 < len(args):
+			i++
+			m, err := strconv.ParseUint(args[i], 8, 32)
+			if err != nil {
+				fmt.Fprintf(stderr, "install: invalid mode %q\n", args[i])
+				return 1
+			}
+			mode = os.FileMode(m)
+		case arg == "-D":
+			// parent directories are always created.
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(stderr, "install: unsupported option %q\n", arg)
+			return 1
+		default:
+			files = append(files, arg)
+		}
+	}
+	if len(files) != 2 {
+		fmt.Fprintf(stderr, "install: expected a source and destination\n")
+		return 1
+	}
+
+	var data []byte
+	if src := files[0]; src == "/dev/stdin" {
+		var err error
+		if data, err = ioutil.ReadAll(stdin); err != nil {
+			fmt.Fprintf(stderr, "install: %v\n", err)
+			return 1
+		}
+	} else if f, ok := h.ReadFile(src); ok {
+		data = f.Data
+	} else {
+		fmt.Fprintf(stderr, "install: cannot stat '%s': No such file or directory\n", src)
+		return 1
+	}
+
+	h.WriteFile(files[1], data, mode)
+	return 0
+}
+
+func builtinMkdir(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, dirs := splitFlags(args)
+	parents := len(flags) == 1 && flags[0] == "-p"
+	if len(flags) > 1 || (len(flags) == 1 && !parents) {
+		fmt.Fprintf(stderr, "mkdir: unsupported options %q\n", flags)
+		return 1
+	}
+
+	status := 0
+	for _, dir := range dirs {
+		if !parents && !h.IsDir(path.Dir(path.Clean(dir))) {
+			fmt.Fprintf(stderr, "mkdir: cannot create directory '%s': No such file or directory\n", dir)
+			status = 1
+			continue
+		}
+		h.mu.Lock()
+		h.mkdirAll(dir)
+		h.mu.Unlock()
+	}
+	return status
+}
+
+func builtinRm(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, files := splitFlags(args)
+	force := len(flags) == 1 && flags[0] == "-f"
+
+	status := 0
+	for _, name := range files {
+		if !h.RemoveFile(name) && !force {
+			fmt.Fprintf(stderr, "rm: cannot remove '%s': No such file or directory\n", name)
+			status = 1
+		}
+	}
+	return status
+}
+
+func builtinTee(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	data, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "tee: %v\n", err)
+		return 1
+	}
+	for _, name := range args {
+		h.WriteFile(name, data, 0644)
+	}
+	stdout.Write(data)
+	return 0
+}
+
+// builtinTar supports creating and extracting archives on stdin and
+// stdout: tar [-C DIR] -cf - NAME... and tar [-C DIR] [--numeric-owner] -xf -
+// Extracted files keep the owner recorded in the archive.
+func builtinTar(h *Host, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var dir, mode string
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-C" && i+1 < len(args):
+			i++
+			dir = args[i]
+		case arg == "--numeric-owner":
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for _, c := range arg[1:] {
+				switch c {
+				case 'c', 'x':
+					mode = string(c)
+				case 'f':
+					if i+1 >= len(args) || args[i+1] != "-" {
+						fmt.Fprintf(stderr, "tar: only stdin and stdout are supported\n")
+						return 2
+					}
+					i++
+				case 'p', 'v':
+				default:
+					fmt.Fprintf(stderr, "tar: unsupported option %q\n", c)
+					return 2
+				}
+			}
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	join := func(name string) string {
+		if dir == "" {
+			return path.Clean(name)
+		}
+		return path.Join(dir, name)
+	}
+
+	switch mode {
+	case "c":
+		tw := tar.NewWriter(stdout)
+		for _, name := range names {
+			if err := h.writeTar(tw, join(name), path.Clean(name)); err != nil {
+				fmt.Fprintf(stderr, "tar: %v\n", err)
+				return 2
+			}
+		}
+		if err := tw.Close(); err != nil {
+			fmt.Fprintf(stderr, "tar: %v\n", err)
+			return 2
+		}
+	case "x":
+		tr := tar.NewReader(stdin)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				fmt.Fprintf(stderr, "tar: %v\n", err)
+				return 2
+			}
+			target := join(hdr.Name)
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				h.mu.Lock()
+				h.mkdirAll(target)
+				h.mu.Unlock()
+			case tar.TypeReg, tar.TypeRegA:
+				data, err := ioutil.ReadAll(tr)
+				if err != nil {
+					fmt.Fprintf(stderr, "tar: %v\n", err)
+					return 2
+				}
+				h.writeFile(target, File{
+					Data: data,
+					Mode: os.FileMode(hdr.Mode).Perm(),
+					UID:  hdr.Uid,
+					GID:  hdr.Gid,
+				})
+			default:
+				fmt.Fprintf(stderr, "tar: %s: unsupported entry type\n", hdr.Name)
+				return 2
+			}
+		}
+	default:
+		fmt.Fprintf(stderr, "tar: one of -c or -x is required\n")
+		return 2
+	}
+	return 0
+}
+
+// writeTar archives the file or directory tree at full as name.
+func (h *Host) writeTar(tw *tar.Writer, full, name string) error {
+	if f, ok := h.ReadFile(full); ok {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     int64(f.Mode.Perm()),
+			Uid:      f.UID,
+			Gid:      f.GID,
+			Size:     int64(len(f.Data)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(f.Data)
+		return err
+	}
+	if !h.IsDir(full) {
+		return fmt.Errorf("%s: Cannot stat: No such file or directory", name)
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name + "/",
+		Mode:     0755,
+		Typeflag: tar.TypeDir,
+	}); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	var children []string
+	for d := range h.dirs {
+		if d != full && path.Dir(d) == full {
+			children = append(children, path.Base(d))
+		}
+	}
+	for f := range h.files {
+		if path.Dir(f) == full {
+			children = append(children, path.Base(f))
+		}
+	}
+	h.mu.Unlock()
+	sort.Strings(children)
+
+	for _, child := range children {
+		if err := h.writeTar(tw, path.Join(full, child), path.Join(name, child)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockssh
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/sftp"
+)
+
+func hostRun(t *testing.T, client *ssh.Client, cmd, stdin string) (stdout, stderr string, status int) {
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	var outBuf, errBuf bytes.Buffer
+	session.Stdin = strings.NewReader(stdin)
+	session.Stdout = &outBuf
+	session.Stderr = &errBuf
+	err = session.Run(cmd)
+	if exit, ok := err.(*ssh.ExitError); ok {
+		status = exit.ExitStatus()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return outBuf.String(), errBuf.String(), status
+}
+
+func TestHostCommands(t *testing.T) {
+	host := NewHost()
+	host.AddCommand("systemctl is-active etcd", Response{Stdout: "failed\n", Status: 3})
+	client := host.NewClient()
+	defer client.Close()
+
+	if out, _, status := hostRun(t, client, "systemctl is-active etcd", ""); out != "failed\n" || status != 3 {
+		t.Errorf("got %q %d", out, status)
+	}
+
+	if _, errOut, status := hostRun(t, client, "reboot", ""); status != 127 || errOut == "" {
+		t.Errorf("unknown command returned %d %q", status, errOut)
+	}
+
+	expect := []string{"systemctl is-active etcd", "reboot"}
+	if h := host.History(); !reflect.DeepEqual(h, expect) {
+		t.Errorf("got history %q wanted %q", h, expect)
+	}
+}
+
+func TestHostFiles(t *testing.T) {
+	host := NewHost()
+	host.WriteFile("/etc/os-release", []byte("ID=coreos\n"), 0644)
+	client := host.NewClient()
+	defer client.Close()
+
+	if out, _, status := hostRun(t, client, "cat /etc/os-release", ""); out != "ID=coreos\n" || status != 0 {
+		t.Errorf("got %q %d", out, status)
+	}
+	if _, errOut, status := hostRun(t, client, "cat /missing", ""); status != 1 || errOut == "" {
+		t.Errorf("missing file returned %d %q", status, errOut)
+	}
+
+	// Commands commonly used by tests to install files.
+	if _, errOut, status := hostRun(t, client, "sudo mkdir -p /opt/bin", ""); status != 0 {
+		t.Fatalf("mkdir failed: %q", errOut)
+	}
+	if !host.IsDir("/opt/bin") || !host.IsDir("/opt") {
+		t.Errorf("mkdir did not create directories")
+	}
+	if _, errOut, status := hostRun(t, client, "sudo install -m 0755 /dev/stdin /opt/bin/kolet", "binary"); status != 0 {
+		t.Fatalf("install failed: %q", errOut)
+	}
+	f, ok := host.ReadFile("/opt/bin/kolet")
+	if !ok || string(f.Data) != "binary" || f.Mode != 0755 {
+		t.Errorf("unexpected file %q %v %t", f.Data, f.Mode, ok)
+	}
+
+	if _, _, status := hostRun(t, client, "rm /opt/bin/kolet", ""); status != 0 {
+		t.Errorf("rm failed")
+	}
+	if _, _, status := hostRun(t, client, "rm /opt/bin/kolet", ""); status != 1 {
+		t.Errorf("rm of missing file succeeded")
+	}
+	if files := host.Files(); !reflect.DeepEqual(files, []string{"/etc/os-release"}) {
+		t.Errorf("unexpected files %q", files)
+	}
+}
+
+func TestHostShell(t *testing.T) {
+	host := NewHost()
+	host.WriteFile("/etc/hostname", []byte("mock\n"), os.FileMode(0644))
+	host.AddCommand("uptime", Response{Stdout: "up 1 day\n"})
+	host.AddCommand("fail", Response{Stderr: "failed\n", Status: 2})
+	client := host.NewClient()
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	var stdout bytes.Buffer
+	session.Stdin = strings.NewReader("cat /etc/hostname\nuptime\nfail\n")
+	session.Stdout = &stdout
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	err = session.Wait()
+	if exit, ok := err.(*ssh.ExitError); !ok || exit.ExitStatus() != 2 {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+
+	expect := "$ mock\n$ up 1 day\n$ failed\n$ "
+	if stdout.String() != expect {
+		t.Errorf("got %q wanted %q", stdout.String(), expect)
+	}
+}
+
+func TestHostTar(t *testing.T) {
+	host := NewHost()
+	host.WriteFile("/etc/tree/a", []byte("a"), 0600)
+	host.WriteFile("/etc/tree/sub/b", []byte("b"), 0755)
+	client := host.NewClient()
+	defer client.Close()
+
+	archive, errOut, status := hostRun(t, client, "sudo tar -C /etc -cf - tree", "")
+	if status != 0 {
+		t.Fatalf("tar -c failed: %q", errOut)
+	}
+	if _, errOut, status := hostRun(t, client, "sudo tar -C /srv -xpf -", archive); status != 0 {
+		t.Fatalf("tar -x failed: %q", errOut)
+	}
+
+	expect := []string{"/etc/tree/a", "/etc/tree/sub/b", "/srv/tree/a", "/srv/tree/sub/b"}
+	if files := host.Files(); !reflect.DeepEqual(files, expect) {
+		t.Errorf("got files %q wanted %q", files, expect)
+	}
+	if f, _ := host.ReadFile("/srv/tree/sub/b"); string(f.Data) != "b" || f.Mode != 0755 {
+		t.Errorf("unexpected file %q %v", f.Data, f.Mode)
+	}
+
+	if _, _, status := hostRun(t, client, "tar -C /etc -cf - missing", ""); status != 2 {
+		t.Errorf("archiving a missing file returned %d", status)
+	}
+}
+
+func TestHostSFTP(t *testing.T) {
+	host := NewHost()
+	host.EnableSFTP("/home/core")
+	host.WriteFile("/home/core/notes", []byte("notes"), 0644)
+	host.WriteFile("/etc/shadow", []byte("secret"), 0600)
+	client := host.NewClient()
+	defer client.Close()
+
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	infos, err := sc.ReadDir("/home/core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "notes" || infos[0].Size() != 5 {
+		t.Errorf("unexpected listing %v", infos)
+	}
+
+	f, err := sc.Create("/home/core/bin/tool", 0755)
+	if !os.IsNotExist(err) {
+		t.Errorf("created file in missing directory: %v", err)
+	}
+	if err := sc.MkdirAll("/home/core/bin", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = sc.Create("/home/core/bin/tool", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("tool"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := host.ReadFile("/home/core/bin/tool"); string(file.Data) != "tool" || file.Mode != 0755 {
+		t.Errorf("unexpected file %q %v", file.Data, file.Mode)
+	}
+
+	if _, err := sc.Open("/etc/shadow"); !os.IsPermission(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+}
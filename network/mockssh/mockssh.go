@@ -15,7 +15,8 @@
 // mockssh implements a basic ssh server for use in unit tests.
 //
 // Command execution in the server is implemented by a user provided handler
-// function rather than executing a real shell.
+// function rather than executing a real shell. Host provides a handler
+// which simulates a simple machine with scripted commands and files.
 //
 // Some inspiration is taken from but not based on:
 // https://godoc.org/github.com/gliderlabs/ssh
@@ -26,6 +27,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -69,15 +71,35 @@ uCeD0x31tIEl6p5wYaspSAOZJh8/jz4qMbLOUjmhRUzIJg==
 // handler must call session.Close or session.Exit.
 type SessionHandler func(session *Session)
 
+// Pty describes the pseudo terminal requested by the client.
+type Pty struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+}
+
 // Session represents the server side execution of the client's ssh.Session.
+// Exactly one of Exec, Shell, or Subsystem is set when the handler is
+// called.
 type Session struct {
-	Exec   string   // Command to execute.
-	Env    []string // Environment values provided by the client.
-	Stdin  io.Reader
-	Stdout io.Writer
-	Stderr io.Writer
+	Exec      string   // Command to execute.
+	Shell     bool     // Interactive shell requested.
+	Subsystem string   // Subsystem requested, such as "sftp".
+	Env       []string // Environment values provided by the client.
+	Pty       *Pty     // Terminal requested by the client, if any.
+	User      string   // User the client authenticated as.
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
 
 	channel ssh.Channel
+	done    chan struct{}
+}
+
+// Done is closed once the session has been closed by either side or the
+// connection is lost, for handlers that wait for something to happen.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
 }
 
 // Exit sends the given command exit status and closes the session.
@@ -98,6 +120,26 @@ func (s *Session) Close() error {
 	return s.channel.Close()
 }
 
+// ServerConfig customizes the behavior of a mock server.
+type ServerConfig struct {
+	// Handler is called for every exec, shell, or subsystem request.
+	Handler SessionHandler
+
+	// PasswordCallback and PublicKeyCallback authenticate clients,
+	// returning true to accept them. If both are nil any password is
+	// accepted.
+	PasswordCallback  func(user, password string) bool
+	PublicKeyCallback func(user string, key ssh.PublicKey) bool
+
+	// Latency delays every write from the server to simulate a slow
+	// network connection.
+	Latency time.Duration
+
+	// HostKey identifies the server, defaults to the key returned by
+	// HostKey().
+	HostKey ssh.Signer
+}
+
 // NewMockClient starts a ssh server backed by the given handler and
 // returns a client that is connected to it.
 func NewMockClient(handler SessionHandler) *ssh.Client {
@@ -108,7 +150,7 @@ func NewMockClient(handler SessionHandler) *ssh.Client {
 		},
 	}
 
-	pipe := startMockServer(handler)
+	pipe := NewServerConn(ServerConfig{Handler: handler})
 	conn, chans, reqs, err := ssh.NewClientConn(pipe, "mock", &config)
 	if err != nil {
 		panic(err)
@@ -117,28 +159,70 @@ func NewMockClient(handler SessionHandler) *ssh.Client {
 	return ssh.NewClient(conn, chans, reqs)
 }
 
-type mockServer struct {
-	config  ssh.ServerConfig
-	handler SessionHandler
-	server  *ssh.ServerConn
-}
-
-func startMockServer(handler SessionHandler) net.Conn {
+// NewServerConn starts a ssh server and returns the client side of the
+// connection to it, ready for use with ssh.NewClientConn.
+func NewServerConn(config ServerConfig) net.Conn {
 	m := mockServer{
-		config: ssh.ServerConfig{
-			PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
-				return nil, nil
-			},
-		},
-		handler: handler,
+		handler: config.Handler,
+	}
+
+	if config.PasswordCallback == nil && config.PublicKeyCallback == nil {
+		m.config.PasswordCallback = func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		}
+	}
+	if config.PasswordCallback != nil {
+		m.config.PasswordCallback = func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if !config.PasswordCallback(c.User(), string(pass)) {
+				return nil, fmt.Errorf("mockssh: password rejected for %q", c.User())
+			}
+			return nil, nil
+		}
+	}
+	if config.PublicKeyCallback != nil {
+		m.config.PublicKeyCallback = func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !config.PublicKeyCallback(c.User(), key) {
+				return nil, fmt.Errorf("mockssh: key rejected for %q", c.User())
+			}
+			return nil, nil
+		}
+	}
+	if config.HostKey != nil {
+		m.config.AddHostKey(config.HostKey)
+	} else {
+		m.config.AddHostKey(mockServerPrivateKey)
 	}
-	m.config.AddHostKey(mockServerPrivateKey)
 
 	sPipe, cPipe := bufnet.FixedPipe(pipeBufferSize)
+	if config.Latency > 0 {
+		sPipe = &slowConn{Conn: sPipe, latency: config.Latency}
+	}
 	go m.handleServerConn(sPipe)
 	return cPipe
 }
 
+// HostKey returns the public host key used by all mock servers.
+func HostKey() ssh.PublicKey {
+	return mockServerPrivateKey.PublicKey()
+}
+
+// slowConn delays every write by a fixed amount.
+type slowConn struct {
+	net.Conn
+	latency time.Duration
+}
+
+func (s *slowConn) Write(b []byte) (int, error) {
+	time.Sleep(s.latency)
+	return s.Conn.Write(b)
+}
+
+type mockServer struct {
+	config  ssh.ServerConfig
+	handler SessionHandler
+	server  *ssh.ServerConn
+}
+
 func (m *mockServer) handleServerConn(conn net.Conn) {
 	serverConn, chans, reqs, err := ssh.NewServerConn(conn, &m.config)
 	if err != nil {
@@ -167,17 +251,29 @@ func (m *mockServer) handleServerChannel(newChannel ssh.NewChannel) {
 		return
 	}
 
+	done := make(chan struct{})
+	defer close(done)
+
 	session := &Session{
+		User:    m.server.User(),
 		Stdin:   channel,
 		Stdout:  channel,
 		Stderr:  channel.Stderr(),
 		channel: channel,
+		done:    done,
+	}
+
+	start := func(req *ssh.Request) {
+		req.Reply(true, nil)
+		go m.handler(session)
+		session = nil
 	}
 
-	// shell and pty requests are not implemented.
 	for req := range requests {
 		if session == nil {
-			req.Reply(false, nil)
+			// Window size changes are harmless once started.
+			req.Reply(req.Type == "window-change", nil)
+			continue
 		}
 		switch req.Type {
 		case "exec":
@@ -186,10 +282,40 @@ func (m *mockServer) handleServerChannel(newChannel ssh.NewChannel) {
 				req.Reply(false, nil)
 			} else {
 				session.Exec = v.Value
+				start(req)
+			}
+		case "shell":
+			session.Shell = true
+			start(req)
+		case "subsystem":
+			v := struct{ Name string }{}
+			if err := ssh.Unmarshal(req.Payload, &v); err != nil {
+				req.Reply(false, nil)
+			} else {
+				session.Subsystem = v.Name
+				start(req)
+			}
+		case "pty-req":
+			pty := struct {
+				Term    string
+				Columns uint32
+				Rows    uint32
+				Width   uint32
+				Height  uint32
+				Modes   string
+			}{}
+			if err := ssh.Unmarshal(req.Payload, &pty); err != nil {
+				req.Reply(false, nil)
+			} else {
+				session.Pty = &Pty{
+					Term:    pty.Term,
+					Columns: pty.Columns,
+					Rows:    pty.Rows,
+				}
+				// A terminal has no separate stderr.
+				session.Stderr = channel
 				req.Reply(true, nil)
-				go m.handler(session)
 			}
-			session = nil
 		case "env":
 			kv := struct{ Key, Value string }{}
 			if err := ssh.Unmarshal(req.Payload, &kv); err != nil {
@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"runtime"
@@ -81,6 +82,30 @@ func TestExitStatusMissing(t *testing.T) {
 	}
 }
 
+func TestSessionDone(t *testing.T) {
+	done := make(chan struct{})
+	client := NewMockClient(func(s *Session) {
+		<-s.Done()
+		close(done)
+		s.Close()
+	})
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Start("wait"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not told the connection was lost")
+	}
+}
+
 func TestCat(t *testing.T) {
 	client := NewMockClient(func(s *Session) {
 		if _, err := io.Copy(s.Stdout, s.Stdin); err != nil {
@@ -182,10 +207,17 @@ func TestEnv(t *testing.T) {
 	}
 }
 
-// shell is not implemented, confirm it fails.
 func TestShell(t *testing.T) {
 	client := NewMockClient(func(s *Session) {
-		t.Errorf("executed shell")
+		if !s.Shell || s.Exec != "" {
+			t.Errorf("got shell %t exec %q", s.Shell, s.Exec)
+		}
+		if s.Pty == nil {
+			t.Errorf("missing pty")
+		} else if s.Pty.Term != "xterm" || s.Pty.Columns != 80 || s.Pty.Rows != 40 {
+			t.Errorf("unexpected pty %+v", s.Pty)
+		}
+		io.WriteString(s.Stderr, "Stderr")
 		s.Exit(0)
 	})
 	defer client.Close()
@@ -195,8 +227,120 @@ func TestShell(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := session.Shell(); err == nil {
-		t.Fatal("shell succeeded")
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+	if err := session.RequestPty("xterm", 40, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// stderr is merged into stdout with a pty.
+	if stdout.String() != "Stderr" {
+		t.Errorf("got %q wanted %q", stdout.String(), "Stderr")
+	}
+}
+
+func TestSubsystem(t *testing.T) {
+	client := NewMockClient(func(s *Session) {
+		io.WriteString(s.Stdout, s.Subsystem)
+		s.Exit(0)
+	})
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "sftp" {
+		t.Errorf("got %q wanted %q", out, "sftp")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	handler := func(s *Session) {
+		io.WriteString(s.Stdout, s.User)
+		s.Exit(0)
+	}
+	conf := ServerConfig{
+		Handler: handler,
+		PasswordCallback: func(user, password string) bool {
+			return user == "core" && password == "secret"
+		},
+	}
+
+	dial := func(user, password string) (*ssh.Client, error) {
+		cconf := ssh.ClientConfig{
+			User: user,
+			Auth: []ssh.AuthMethod{ssh.Password(password)},
+		}
+		conn, chans, reqs, err := ssh.NewClientConn(NewServerConn(conf), "mock", &cconf)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.NewClient(conn, chans, reqs), nil
+	}
+
+	if _, err := dial("core", "wrong"); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+
+	client, err := dial("core", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.Output("whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "core" {
+		t.Errorf("got %q wanted %q", out, "core")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	const latency = 20 * time.Millisecond
+	conf := ServerConfig{
+		Handler: func(s *Session) { s.Exit(0) },
+		Latency: latency,
+	}
+	cconf := ssh.ClientConfig{
+		User: "mock",
+		Auth: []ssh.AuthMethod{ssh.Password("")},
+	}
+
+	start := time.Now()
+	conn, chans, reqs, err := ssh.NewClientConn(NewServerConn(conf), "mock", &cconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	// the handshake alone takes several round trips.
+	if d := time.Since(start); d < 2*latency {
+		t.Errorf("connection took %v, expected at least %v", d, 2*latency)
 	}
 }
 
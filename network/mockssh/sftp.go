@@ -0,0 +1,205 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/network/sftp"
+)
+
+// EnableSFTP serves the "sftp" subsystem from the host's filesystem. If
+// any directories are given only paths within them may be accessed, as
+// if by an unprivileged user, all others are denied. Allowing "." allows
+// all relative paths.
+func (h *Host) EnableSFTP(allowed ...string) {
+	fs := &hostFS{h: h}
+	for _, dir := range allowed {
+		fs.allowed = append(fs.allowed, path.Clean(dir))
+	}
+	h.AddSubsystem("sftp", func(s *Session) {
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{s.Stdin, s.Stdout}
+		if err := sftp.Serve(rw, fs); err != nil {
+			fmt.Fprintf(s.Stderr, "sftp: %v\n", err)
+			s.Exit(1)
+			return
+		}
+		s.Exit(0)
+	})
+}
+
+// hostFS adapts a Host to sftp.FileSystem.
+type hostFS struct {
+	h       *Host
+	allowed []string
+}
+
+// check returns the cleaned path or an error if it may not be accessed.
+func (fs *hostFS) check(op, name string) (string, error) {
+	name = path.Clean(name)
+	if len(fs.allowed) == 0 {
+		return name, nil
+	}
+	for _, dir := range fs.allowed {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return name, nil
+		}
+		if dir == "." && !path.IsAbs(name) && !strings.HasPrefix(name, "../") {
+			return name, nil
+		}
+	}
+	return "", &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+}
+
+func (fs *hostFS) Stat(name string) (os.FileInfo, error) {
+	name, err := fs.check("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fs.h.mu.Lock()
+	defer fs.h.mu.Unlock()
+	if fs.h.dirs[name] {
+		return &hostFileInfo{name: path.Base(name), mode: os.ModeDir | 0755}, nil
+	}
+	if f, ok := fs.h.files[name]; ok {
+		return &hostFileInfo{name: path.Base(name), mode: f.Mode, size: int64(len(f.Data))}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *hostFS) ReadDir(name string) ([]os.FileInfo, error) {
+	name, err := fs.check("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	fs.h.mu.Lock()
+	defer fs.h.mu.Unlock()
+	if !fs.h.dirs[name] {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+	}
+	var infos []os.FileInfo
+	for dir := range fs.h.dirs {
+		if dir != name && path.Dir(dir) == name {
+			infos = append(infos, &hostFileInfo{name: path.Base(dir), mode: os.ModeDir | 0755})
+		}
+	}
+	for file, f := range fs.h.files {
+		if path.Dir(file) == name {
+			infos = append(infos, &hostFileInfo{name: path.Base(file), mode: f.Mode, size: int64(len(f.Data))})
+		}
+	}
+	sort.Sort(byName(infos))
+	return infos, nil
+}
+
+func (fs *hostFS) ReadFile(name string) ([]byte, error) {
+	name, err := fs.check("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := fs.h.ReadFile(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return f.Data, nil
+}
+
+func (fs *hostFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name, err := fs.check("open", name)
+	if err != nil {
+		return err
+	}
+	if !fs.h.IsDir(path.Dir(name)) {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	fs.h.writeFile(name, File{Data: data, Mode: perm, UID: UserID, GID: UserID})
+	return nil
+}
+
+func (fs *hostFS) Mkdir(name string, perm os.FileMode) error {
+	name, err := fs.check("mkdir", name)
+	if err != nil {
+		return err
+	}
+	fs.h.mu.Lock()
+	defer fs.h.mu.Unlock()
+	if !fs.h.dirs[path.Dir(name)] {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+	}
+	if _, ok := fs.h.files[name]; ok || fs.h.dirs[name] {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	fs.h.dirs[name] = true
+	return nil
+}
+
+func (fs *hostFS) Chmod(name string, mode os.FileMode) error {
+	name, err := fs.check("chmod", name)
+	if err != nil {
+		return err
+	}
+	fs.h.mu.Lock()
+	defer fs.h.mu.Unlock()
+	if fs.h.dirs[name] {
+		return nil // directories always have mode 0755
+	}
+	f, ok := fs.h.files[name]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	f.Mode = mode.Perm()
+	fs.h.files[name] = f
+	return nil
+}
+
+func (fs *hostFS) Remove(name string) error {
+	name, err := fs.check("remove", name)
+	if err != nil {
+		return err
+	}
+	if !fs.h.RemoveFile(name) {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// hostFileInfo implements os.FileInfo for the host's filesystem.
+type hostFileInfo struct {
+	name string
+	mode os.FileMode
+	size int64
+}
+
+func (fi *hostFileInfo) Name() string       { return fi.name }
+func (fi *hostFileInfo) Size() int64        { return fi.size }
+func (fi *hostFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *hostFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *hostFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *hostFileInfo) Sys() interface{}   { return nil }
+
+type byName []os.FileInfo
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,217 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// AdminPath is where EnableAdmin serves the admin API and status page.
+const AdminPath = "/admin/"
+
+// UpdateLister is implemented by Updaters that can list the updates
+// they offer, such as Catalog and TrivialServer's Updater.
+type UpdateLister interface {
+	Updates() []Update
+}
+
+// PackageSetter is implemented by Updaters whose offered update payload
+// can be replaced at runtime, such as TrivialServer's Updater.
+type PackageSetter interface {
+	SetPackage(path string) error
+}
+
+// ClientStatus summarizes the requests received from one machine.
+type ClientStatus struct {
+	MachineID string        `json:"machine_id"`
+	LastSeen  time.Time     `json:"last_seen"`
+	AppId     string        `json:"app_id"`
+	Version   string        `json:"version"`
+	Track     string        `json:"track,omitempty"`
+	Board     string        `json:"board,omitempty"`
+	Offered   string        `json:"offered,omitempty"`
+	LastEvent *EventRequest `json:"last_event,omitempty"`
+}
+
+// ClientStatuses summarizes records by machine, in order of appearance.
+func ClientStatuses(records []Record) []*ClientStatus {
+	var clients []*ClientStatus
+	byID := make(map[string]*ClientStatus)
+	for _, rec := range records {
+		c, ok := byID[rec.MachineID]
+		if !ok {
+			c = &ClientStatus{MachineID: rec.MachineID}
+			byID[rec.MachineID] = c
+			clients = append(clients, c)
+		}
+		c.LastSeen = rec.Time
+		c.AppId = rec.AppId
+		c.Version = rec.Version
+		c.Track = rec.Track
+		c.Board = rec.Board
+		if rec.Update != "" {
+			c.Offered = rec.Update
+		}
+		if rec.Event != nil {
+			c.LastEvent = rec.Event
+		}
+	}
+	return clients
+}
+
+// EnableAdmin records all requests handled by the server's current
+// Updater and serves an admin API under AdminPath:
+//
+//	GET  /admin/         status page
+//	GET  /admin/clients  JSON list of ClientStatus
+//	GET  /admin/updates  JSON list of updates offered
+//	PUT  /admin/updates  offer the payload in {"path": "..."}
+//	GET  /admin/log      JSON log of all requests received
+//
+// Listing and changing updates requires an Updater implementing
+// UpdateLister or PackageSetter. The admin API is not authenticated,
+// only enable it on trusted networks.
+func (s *Server) EnableAdmin() *RecordingUpdater {
+	rec := NewRecordingUpdater(s.Updater)
+	s.Updater = rec
+
+	a := &adminHandler{rec: rec}
+	s.Mux.HandleFunc(AdminPath, a.status)
+	s.Mux.HandleFunc(AdminPath+"clients", a.clients)
+	s.Mux.HandleFunc(AdminPath+"updates", a.updates)
+	s.Mux.HandleFunc(AdminPath+"log", a.log)
+	return rec
+}
+
+type adminHandler struct {
+	rec *RecordingUpdater
+}
+
+func (a *adminHandler) listUpdates() []Update {
+	u := findUpdater(a.rec, func(u Updater) bool {
+		_, ok := u.(UpdateLister)
+		return ok
+	})
+	if u == nil {
+		return nil
+	}
+	return u.(UpdateLister).Updates()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		plog.Errorf("Failed encoding JSON: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+func (a *adminHandler) clients(w http.ResponseWriter, r *http.Request) {
+	clients := ClientStatuses(a.rec.Records(""))
+	if clients == nil {
+		clients = []*ClientStatus{}
+	}
+	writeJSON(w, clients)
+}
+
+func (a *adminHandler) updates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		updates := a.listUpdates()
+		if updates == nil {
+			updates = []Update{}
+		}
+		writeJSON(w, updates)
+
+	case "PUT", "POST":
+		u := findUpdater(a.rec, func(u Updater) bool {
+			_, ok := u.(PackageSetter)
+			return ok
+		})
+		if u == nil {
+			http.Error(w, "Updater does not support setting packages", http.StatusNotImplemented)
+			return
+		}
+
+		var body struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&body); err != nil || body.Path == "" {
+			http.Error(w, "Expected {\"path\": \"...\"}", http.StatusBadRequest)
+			return
+		}
+		if err := u.(PackageSetter).SetPackage(body.Path); err != nil {
+			plog.Errorf("Setting package %s failed: %v", body.Path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		plog.Noticef("Now offering %s", body.Path)
+		writeJSON(w, a.listUpdates())
+
+	default:
+		http.Error(w, "Expected GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *adminHandler) log(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="omaha-log.json"`)
+	if err := a.rec.WriteJSON(w); err != nil {
+		plog.Errorf("Failed writing log: %v", err)
+	}
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Omaha server status</title></head>
+<body>
+<h1>Updates</h1>
+<table>
+<tr><th>App</th><th>Version</th><th>From</th><th>Packages</th></tr>
+{{range .Updates}}<tr><td>{{.Id}}</td><td>{{.Version}}</td><td>{{.PreviousVersion}}</td><td>{{range .Packages}}{{.Name}} ({{.Size}} bytes) {{end}}</td></tr>
+{{else}}<tr><td colspan="4">none</td></tr>
+{{end}}</table>
+<h1>Clients</h1>
+<table>
+<tr><th>Machine</th><th>Last seen</th><th>App</th><th>Version</th><th>Track</th><th>Offered</th><th>Last event</th></tr>
+{{range .Clients}}<tr><td>{{.MachineID}}</td><td>{{.LastSeen.Format "2006-01-02 15:04:05"}}</td><td>{{.AppId}}</td><td>{{.Version}}</td><td>{{.Track}}</td><td>{{.Offered}}</td><td>{{with .LastEvent}}{{.Type}}: {{.Result}}{{with .ErrorCode}} ({{.}}){{end}}{{end}}</td></tr>
+{{else}}<tr><td colspan="7">none</td></tr>
+{{end}}</table>
+<p><a href="log">Download request log</a></p>
+</body>
+</html>
+`))
+
+func (a *adminHandler) status(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != AdminPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusTemplate.Execute(w, struct {
+		Updates []Update
+		Clients []*ClientStatus
+	}{a.listUpdates(), ClientStatuses(a.rec.Records(""))})
+	if err != nil {
+		plog.Errorf("Failed rendering status: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func getAdmin(t *testing.T, s *TrivialServer, path string, v interface{}) string {
+	res, err := http.Get(fmt.Sprintf("http://%s%s%s", s.Addr(), AdminPath, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", path, res.Status)
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+	return string(body)
+}
+
+func TestAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewTrivialServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	s.EnableAdmin()
+	go s.Serve()
+
+	var updates []Update
+	if getAdmin(t, s, "updates", &updates); len(updates) != 0 {
+		t.Errorf("unexpected updates %v", updates)
+	}
+
+	payload := filepath.Join(dir, "payload")
+	if err := ioutil.WriteFile(payload, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s%supdates", s.Addr(), AdminPath),
+		strings.NewReader(fmt.Sprintf(`{"path": %q}`, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT updates: %s", res.Status)
+	}
+	if getAdmin(t, s, "updates", &updates); len(updates) != 1 || updates[0].Packages[0].Size != 4 {
+		t.Errorf("unexpected updates %v", updates)
+	}
+
+	c := NewClient(fmt.Sprintf("http://%s/v1/update/", s.Addr()), testAppId, testAppVer)
+	c.App.MachineID = "client"
+	c.App.Track = "beta"
+	if _, err := c.CheckUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Event(EventTypeUpdateComplete, EventResultError); err != nil {
+		t.Fatal(err)
+	}
+
+	var clients []ClientStatus
+	getAdmin(t, s, "clients", &clients)
+	if len(clients) != 1 ||
+		clients[0].MachineID != "client" ||
+		clients[0].Track != "beta" ||
+		clients[0].LastEvent == nil ||
+		clients[0].LastEvent.Type != EventTypeUpdateComplete {
+		t.Errorf("unexpected clients %+v", clients)
+	}
+
+	var records []Record
+	if getAdmin(t, s, "log", &records); len(records) != 2 {
+		t.Errorf("unexpected log %v", records)
+	}
+
+	status := getAdmin(t, s, "", nil)
+	if !strings.Contains(status, "client") || !strings.Contains(status, "update.gz") {
+		t.Errorf("unexpected status page:\n%s", status)
+	}
+}
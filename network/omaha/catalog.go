@@ -0,0 +1,390 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// CatalogPath is where a Catalog's payloads are served by NewCatalogServer.
+const CatalogPath = "/catalog/"
+
+// Release is a set of update manifests offered to one board on one or
+// more tracks. A release usually holds a full update and any deltas from
+// earlier versions.
+type Release struct {
+	// AppId is used for manifests that do not include an app id.
+	AppId string `json:"app_id,omitempty"`
+	// Tracks the release is offered on, all tracks if empty.
+	Tracks []string `json:"tracks,omitempty"`
+	// Board the release is built for, all boards if empty.
+	Board string `json:"board,omitempty"`
+	// Updates are update manifests in the XML format written by
+	// sdk/omaha. Payloads are found relative to each manifest using
+	// its codebase. Relative paths are relative to the catalog file.
+	Updates []string `json:"updates"`
+}
+
+// catalogEntry is a single full or delta update loaded from a Release.
+type catalogEntry struct {
+	release *Release
+	update  Update
+	version *semver.Version
+	dir     string // directory holding the payloads
+}
+
+func (e *catalogEntry) offered(app *AppRequest, track string) bool {
+	if !strings.EqualFold(e.update.Id, app.Id) {
+		return false
+	}
+	if e.release.Board != "" && e.release.Board != app.Board {
+		return false
+	}
+	if len(e.release.Tracks) == 0 {
+		return true
+	}
+	for _, t := range e.release.Tracks {
+		if t == track {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog is an Updater that offers releases by app id, track and board.
+// App ids are GUIDs so they match regardless of case. Clients are offered
+// the newest release above their current version, as a delta update if
+// one exists from their version and either they accept deltas or the
+// delta does not set RespectDeltaOK. Catalog is also an http.Handler
+// serving the payloads under CatalogPath.
+type Catalog struct {
+	UpdaterStub
+
+	// DefaultTrack is used for clients that do not send a track.
+	DefaultTrack string `json:"default_track,omitempty"`
+	// Releases are the loaded releases, use AddRelease to add more.
+	Releases []*Release `json:"releases"`
+
+	mu      sync.RWMutex
+	entries []*catalogEntry
+	store   Store
+}
+
+// LoadCatalog reads a JSON catalog and all of the update manifests and
+// payloads it refers to.
+func LoadCatalog(path string) (*Catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Catalog
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return nil, fmt.Errorf("parsing catalog %s: %v", path, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	releases := c.Releases
+	c.Releases = nil
+	for _, r := range releases {
+		rel := *r
+		rel.Updates = make([]string, len(r.Updates))
+		for i, u := range r.Updates {
+			if !filepath.IsAbs(u) {
+				u = filepath.Join(dir, u)
+			}
+			rel.Updates[i] = u
+		}
+		if err := c.AddRelease(&rel); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// AddRelease loads a release's update manifests, verifying the payloads.
+// The catalog keeps a copy of r with the paths of the manifests made
+// absolute. If the catalog has a Store the release is only offered once
+// it has been saved.
+func (c *Catalog) AddRelease(r *Release) error {
+	r, err := absRelease(r)
+	if err != nil {
+		return err
+	}
+
+	var entries []*catalogEntry
+	for _, path := range r.Updates {
+		e := &catalogEntry{release: r}
+		if err := readUpdate(path, &e.update); err != nil {
+			return err
+		}
+
+		if e.update.Id == "" {
+			e.update.Id = r.AppId
+		}
+		if e.update.Id == "" {
+			return fmt.Errorf("%s: missing app id", path)
+		}
+
+		v, err := semver.NewVersion(e.update.Version)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		e.version = v
+
+		if len(e.update.Packages) == 0 {
+			return fmt.Errorf("%s: no packages", path)
+		}
+		e.dir = filepath.Join(filepath.Dir(path), e.update.URL.CodeBase)
+		for _, pkg := range e.update.Packages {
+			if strings.ContainsAny(pkg.Name, `/\`) {
+				return fmt.Errorf("%s: invalid package name %q", path, pkg.Name)
+			}
+			if err := pkg.Verify(e.dir); err != nil {
+				return fmt.Errorf("%s: package %s: %v", path, pkg.Name, err)
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	c.mu.RLock()
+	store := c.store
+	c.mu.RUnlock()
+	if store != nil {
+		if err := store.PutRelease(r); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		e.update.URL.CodeBase = CatalogPath + strconv.Itoa(len(c.entries)) + "/"
+		c.entries = append(c.entries, e)
+	}
+	c.Releases = append(c.Releases, r)
+	return nil
+}
+
+// absRelease copies r, making the paths of its manifests absolute.
+func absRelease(r *Release) (*Release, error) {
+	rel := *r
+	rel.Tracks = append([]string(nil), r.Tracks...)
+	rel.Updates = make([]string, len(r.Updates))
+	for i, u := range r.Updates {
+		abs, err := filepath.Abs(u)
+		if err != nil {
+			return nil, err
+		}
+		rel.Updates[i] = abs
+	}
+	return &rel, nil
+}
+
+func releaseKey(r *Release) string {
+	return strings.Join(r.Updates, "\n")
+}
+
+// SetStore adds the releases kept in a Store and saves the catalog's
+// releases, including any added later, to it. Stored releases whose
+// payloads are no longer valid are skipped with a warning.
+func (c *Catalog) SetStore(s Store) error {
+	stored, err := s.Releases()
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	current := append([]*Release(nil), c.Releases...)
+	c.mu.RUnlock()
+
+	have := make(map[string]bool)
+	for _, r := range current {
+		have[releaseKey(r)] = true
+		if err := s.PutRelease(r); err != nil {
+			return err
+		}
+	}
+	for _, r := range stored {
+		if have[releaseKey(r)] {
+			continue
+		}
+		if err := c.AddRelease(r); err != nil {
+			plog.Warningf("Skipping stored release: %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.store = s
+	c.mu.Unlock()
+	return nil
+}
+
+func readUpdate(path string, u *Update) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := xml.NewDecoder(f).Decode(u); err != nil {
+		return fmt.Errorf("parsing update %s: %v", path, err)
+	}
+	return nil
+}
+
+// Updates returns every update in the catalog.
+func (c *Catalog) Updates() []Update {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	updates := make([]Update, len(c.entries))
+	for i, e := range c.entries {
+		updates[i] = e.update
+	}
+	return updates
+}
+
+// CheckApp rejects unknown apps and versions that cannot be compared.
+func (c *Catalog) CheckApp(req *Request, app *AppRequest) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	known := false
+	for _, e := range c.entries {
+		if strings.EqualFold(e.update.Id, app.Id) {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return AppUnknownId
+	}
+
+	if _, err := semver.NewVersion(app.Version); err != nil {
+		return AppInvalidVersion
+	}
+	return nil
+}
+
+// CheckUpdate chooses the update to offer app.
+func (c *Catalog) CheckUpdate(req *Request, app *AppRequest) (*Update, error) {
+	current, err := semver.NewVersion(app.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	track := app.Track
+	if track == "" {
+		track = c.DefaultTrack
+	}
+
+	prefix := ""
+	if app.UpdateCheck != nil {
+		prefix = app.UpdateCheck.TargetVersionPrefix
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var best *catalogEntry
+	for _, e := range c.entries {
+		if !e.offered(app, track) || !current.LessThan(*e.version) {
+			continue
+		}
+		if !strings.HasPrefix(e.update.Version, prefix) {
+			continue
+		}
+		if prev := e.update.PreviousVersion; prev != "" {
+			if prev != app.Version || (e.update.RespectDeltaOK && !app.DeltaOK) {
+				continue
+			}
+		}
+
+		switch {
+		case best == nil, best.version.LessThan(*e.version):
+			best = e
+		case !e.version.LessThan(*best.version) && best.update.PreviousVersion == "":
+			// prefer a delta to a full update of the same version
+			best = e
+		}
+	}
+
+	if best == nil {
+		return nil, NoUpdate
+	}
+
+	update := best.update
+	return &update, nil
+}
+
+// ServeHTTP serves payloads of the catalog's updates.
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, CatalogPath), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.mu.RLock()
+	var entry *catalogEntry
+	if index >= 0 && index < len(c.entries) {
+		entry = c.entries[index]
+	}
+	c.mu.RUnlock()
+	if entry == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, pkg := range entry.update.Packages {
+		if pkg.Name == parts[1] {
+			http.ServeFile(w, r, filepath.Join(entry.dir, pkg.Name))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// NewCatalogServer creates a Server for catalog, including its payloads.
+func NewCatalogServer(addr string, catalog *Catalog) (*Server, error) {
+	s, err := NewServer(addr, catalog)
+	if err != nil {
+		return nil, err
+	}
+	s.Mux.Handle(CatalogPath, catalog)
+	return s, nil
+}
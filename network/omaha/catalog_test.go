@@ -0,0 +1,281 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestUpdate writes a payload and its manifest to dir/name and
+// returns the manifest path relative to dir.
+func writeTestUpdate(t *testing.T, dir, name string, u Update) string {
+	pkgdir := filepath.Join(dir, name)
+	if err := os.MkdirAll(pkgdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	payload := filepath.Join(pkgdir, "update.gz")
+	if err := ioutil.WriteFile(payload, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AddPackageFromPath(payload); err != nil {
+		t.Fatal(err)
+	}
+	data, err := xml.Marshal(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgdir, "update.xml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(name, "update.xml")
+}
+
+func newTestCatalog(t *testing.T, dir string) *Catalog {
+	full := func(version string) Update {
+		return Update{Manifest: Manifest{Version: version}}
+	}
+	delta := func(from, to string, respect bool) Update {
+		return Update{
+			PreviousVersion: from,
+			RespectDeltaOK:  respect,
+			Manifest:        Manifest{Version: to},
+		}
+	}
+
+	catalog := fmt.Sprintf(`{
+	"default_track": "stable",
+	"releases": [
+		{"app_id": %[1]q, "tracks": ["stable", "beta"], "board": "amd64-usr",
+		 "updates": [%[2]q]},
+		{"app_id": %[1]q, "tracks": ["beta"], "board": "amd64-usr",
+		 "updates": [%[3]q, %[4]q, %[5]q]},
+		{"app_id": %[1]q, "tracks": ["beta"], "board": "arm64-usr",
+		 "updates": [%[6]q]}
+	]
+}`, testAppId,
+		writeTestUpdate(t, dir, "1.1.0", full("1.1.0")),
+		writeTestUpdate(t, dir, "1.2.0", full("1.2.0")),
+		writeTestUpdate(t, dir, "1.2.0-delta-1.0.0", delta("1.0.0", "1.2.0", true)),
+		writeTestUpdate(t, dir, "1.2.0-delta-1.1.0", delta("1.1.0", "1.2.0", false)),
+		writeTestUpdate(t, dir, "1.3.0-arm64", full("1.3.0")))
+
+	path := filepath.Join(dir, "catalog.json")
+	if err := ioutil.WriteFile(path, []byte(catalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCatalogCheckUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newTestCatalog(t, dir)
+
+	for _, tt := range []struct {
+		track   string
+		board   string
+		version string
+		deltaOK bool
+		update  string // version offered
+		prev    string // delta base
+	}{
+		{"", "amd64-usr", "1.0.0", false, "1.1.0", ""},
+		{"stable", "amd64-usr", "1.1.0", false, "", ""},
+		{"beta", "amd64-usr", "0.9.0", true, "1.2.0", ""},
+		{"beta", "amd64-usr", "1.0.0", false, "1.2.0", ""},
+		{"beta", "amd64-usr", "1.0.0", true, "1.2.0", "1.0.0"},
+		{"beta", "amd64-usr", "1.1.0", false, "1.2.0", "1.1.0"},
+		{"beta", "amd64-usr", "1.2.0", true, "", ""},
+		{"beta", "arm64-usr", "1.0.0", false, "1.3.0", ""},
+		{"alpha", "amd64-usr", "1.0.0", false, "", ""},
+	} {
+		req := NewRequest()
+		app := req.AddApp(testAppId, tt.version)
+		app.Track = tt.track
+		app.Board = tt.board
+		app.DeltaOK = tt.deltaOK
+		app.AddUpdateCheck()
+
+		if err := c.CheckApp(req, app); err != nil {
+			t.Errorf("%+v: CheckApp failed: %v", tt, err)
+			continue
+		}
+		u, err := c.CheckUpdate(req, app)
+		if tt.update == "" {
+			if err != NoUpdate {
+				t.Errorf("%+v: expected no update, got %v %v", tt, u, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: CheckUpdate failed: %v", tt, err)
+			continue
+		}
+		if u.Version != tt.update || u.PreviousVersion != tt.prev {
+			t.Errorf("%+v: offered %s from %q", tt, u.Version, u.PreviousVersion)
+		}
+	}
+
+	req := NewRequest()
+	app := req.AddApp(strings.ToLower(testAppId), "1.0.0")
+	app.Board = "amd64-usr"
+	if u, err := c.CheckUpdate(req, app); err != nil || u.Version != "1.1.0" {
+		t.Errorf("lower case app id not matched: %v %v", u, err)
+	}
+	if err := c.CheckApp(req, req.AddApp("{unknown}", "1.0.0")); err != AppUnknownId {
+		t.Errorf("expected unknown app, got %v", err)
+	}
+	if err := c.CheckApp(req, req.AddApp(testAppId, "bogus")); err != AppInvalidVersion {
+		t.Errorf("expected invalid version, got %v", err)
+	}
+}
+
+func TestCatalogServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewCatalogServer("127.0.0.1:0", newTestCatalog(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	go s.Serve()
+
+	req := NewRequest()
+	app := req.AddApp(testAppId, "1.0.0")
+	app.Board = "amd64-usr"
+	app.AddUpdateCheck()
+	buf, err := xml.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := fmt.Sprintf("http://%s/v1/update/", s.Addr())
+	res, err := http.Post(endpoint, "text/xml", bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resp := &Response{}
+	if err := xml.NewDecoder(res.Body).Decode(resp); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if len(resp.Apps) != 1 ||
+		resp.Apps[0].UpdateCheck == nil ||
+		resp.Apps[0].UpdateCheck.Status != UpdateOK ||
+		len(resp.Apps[0].UpdateCheck.URLs) != 1 ||
+		len(resp.Apps[0].UpdateCheck.Manifest.Packages) != 1 {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+
+	url := resp.Apps[0].UpdateCheck.URLs[0].CodeBase +
+		resp.Apps[0].UpdateCheck.Manifest.Packages[0].Name
+	pkgres, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgdata, err := ioutil.ReadAll(pkgres.Body)
+	pkgres.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pkgdata) != "1.1.0" {
+		t.Errorf("unexpected package data: %q", pkgdata)
+	}
+
+	// only payloads in the catalog are served
+	for _, path := range []string{"0/update.xml", "0/../catalog.json", "99/update.gz"} {
+		res, err := http.Get(fmt.Sprintf("http://%s%s%s", s.Addr(), CatalogPath, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: unexpected status %s", path, res.Status)
+		}
+	}
+}
+
+// failingStore refuses to save releases.
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Releases() ([]*Release, error) { return nil, nil }
+func (failingStore) PutRelease(r *Release) error   { return errors.New("disk full") }
+
+func TestCatalogAddRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, writeTestUpdate(t, dir, "1.1.0", Update{Manifest: Manifest{Version: "1.1.0"}}))
+	rel, err := filepath.Rel(wd, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Catalog
+	r := &Release{AppId: testAppId, Updates: []string{rel}}
+	if err := c.AddRelease(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Updates[0] != rel {
+		t.Errorf("caller's release changed to %q", r.Updates[0])
+	}
+	if len(c.Releases) != 1 || c.Releases[0] == r || c.Releases[0].Updates[0] != manifest {
+		t.Errorf("release not copied with absolute paths: %+v", c.Releases)
+	}
+
+	// nothing is offered if the release cannot be stored
+	if err := c.SetStore(failingStore{}); err == nil {
+		t.Fatal("saving the existing release succeeded")
+	}
+	c = Catalog{}
+	if err := c.SetStore(failingStore{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddRelease(r); err == nil {
+		t.Errorf("adding a release that cannot be stored succeeded")
+	}
+	if len(c.Releases) != 0 || len(c.Updates()) != 0 {
+		t.Errorf("unsaved release added: %+v", c.Releases)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Client speaks the update_engine side of the Omaha protocol for a
+// single app, as if it were a machine running that app.
+type Client struct {
+	// URL is the update server's endpoint, e.g. http://host/v1/update/
+	URL string
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// App describes the app sent in every request. Id and Version
+	// are required, pings, update checks and events are filled in
+	// per request.
+	App AppRequest
+}
+
+// NewClient creates a Client for the given app id and version.
+func NewClient(url, appId, version string) *Client {
+	return &Client{
+		URL: url,
+		App: AppRequest{Id: appId, Version: version},
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// NewRequest creates a request with a copy of the client's app.
+func (c *Client) NewRequest() (*Request, *AppRequest) {
+	req := NewRequest()
+	app := c.App
+	app.Ping = nil
+	app.UpdateCheck = nil
+	app.Events = nil
+	req.Apps = []*AppRequest{&app}
+	return req, &app
+}
+
+// Post sends a request and parses the response. The response is
+// returned along with an error if the server reported a failure.
+func (c *Client) Post(req *Request) (*Response, error) {
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient().Post(c.URL, "text/xml", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// Errors for individual apps are still sent as an XML response.
+	resp := &Response{}
+	if err := xml.NewDecoder(io.LimitReader(res.Body, 1024*1024)).Decode(resp); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("omaha: %s", res.Status)
+		}
+		return nil, fmt.Errorf("omaha: invalid response: %v", err)
+	}
+	if resp.Protocol != "3.0" {
+		return resp, fmt.Errorf("omaha: unexpected protocol %q", resp.Protocol)
+	}
+	if res.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("omaha: %s", res.Status)
+	}
+	return resp, nil
+}
+
+// postApp sends a request for a single app and returns its response.
+func (c *Client) postApp(req *Request) (*AppResponse, error) {
+	resp, err := c.Post(req)
+	if resp == nil {
+		return nil, err
+	}
+
+	appId := req.Apps[0].Id
+	for _, app := range resp.Apps {
+		if app.Id != appId {
+			continue
+		}
+		if app.Status != AppOK {
+			return app, app.Status
+		}
+		return app, err
+	}
+
+	if err == nil {
+		err = fmt.Errorf("omaha: no response for app %s", appId)
+	}
+	return nil, err
+}
+
+// CheckUpdate asks the server for an update. NoUpdate is returned as
+// an error if the server has nothing to offer.
+func (c *Client) CheckUpdate() (*UpdateResponse, error) {
+	req, app := c.NewRequest()
+	app.AddUpdateCheck()
+
+	appResp, err := c.postApp(req)
+	if err != nil {
+		return nil, err
+	}
+
+	u := appResp.UpdateCheck
+	switch {
+	case u == nil:
+		return nil, fmt.Errorf("omaha: response missing updatecheck")
+	case u.Status != UpdateOK:
+		return u, u.Status
+	case u.Manifest == nil || len(u.Manifest.Packages) == 0:
+		return u, fmt.Errorf("omaha: update has no packages")
+	case len(u.URLs) == 0:
+		return u, fmt.Errorf("omaha: update has no URLs")
+	}
+	return u, nil
+}
+
+// Ping reports the app as active.
+func (c *Client) Ping() error {
+	req, app := c.NewRequest()
+	app.AddPing()
+
+	appResp, err := c.postApp(req)
+	if err != nil {
+		return err
+	}
+	if appResp.Ping == nil || appResp.Ping.Status != "ok" {
+		return fmt.Errorf("omaha: ping not acknowledged")
+	}
+	return nil
+}
+
+// Event reports progress of an update.
+func (c *Client) Event(eventType EventType, result EventResult) error {
+	req, app := c.NewRequest()
+	event := app.AddEvent()
+	event.Type = eventType
+	event.Result = result
+
+	appResp, err := c.postApp(req)
+	if err != nil {
+		return err
+	}
+	if len(appResp.Events) != 1 || appResp.Events[0].Status != "ok" {
+		return fmt.Errorf("omaha: event not acknowledged")
+	}
+	return nil
+}
+
+// Download fetches and verifies the update's packages into dir,
+// trying each URL in turn, and returns the paths written.
+func (c *Client) Download(u *UpdateResponse, dir string) ([]string, error) {
+	var paths []string
+	for _, pkg := range u.Manifest.Packages {
+		if pkg.Name == "" || strings.ContainsAny(pkg.Name, `/\`) {
+			return nil, fmt.Errorf("omaha: invalid package name %q", pkg.Name)
+		}
+
+		path := filepath.Join(dir, pkg.Name)
+		var err error
+		for _, url := range u.URLs {
+			if err = c.download(url.CodeBase+pkg.Name, path, pkg); err == nil {
+				break
+			}
+			plog.Warningf("Download from %s failed: %v", url.CodeBase, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("omaha: downloading %s: %v", pkg.Name, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (c *Client) download(url, path string, pkg *Package) error {
+	plog.Infof("Downloading %s", url)
+	res, err := c.httpClient().Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", res.Status)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = pkg.VerifyReader(io.TeeReader(io.LimitReader(res.Body, int64(pkg.Size)+1), f))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type unknownAppUpdater struct {
+	UpdaterStub
+}
+
+func (u unknownAppUpdater) CheckApp(req *Request, app *AppRequest) error {
+	return AppUnknownId
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payload := filepath.Join(dir, "payload")
+	if err := ioutil.WriteFile(payload, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewTrivialServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	if err := s.SetPackage(payload); err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecordingUpdater(s.Updater)
+	s.Updater = rec
+	go s.Serve()
+
+	c := NewClient(fmt.Sprintf("http://%s/v1/update/", s.Addr()), testAppId, testAppVer)
+	c.App.MachineID = "client"
+
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := c.CheckUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first mirror is missing the package
+	good := u.URLs[0].CodeBase
+	u.URLs[0].CodeBase = fmt.Sprintf("http://%s/missing/", s.Addr())
+	u.AddURL(good)
+
+	if err := c.Event(EventTypeUpdateDownloadStarted, EventResultSuccess); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := c.Download(u, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(paths[0]); err != nil || string(data) != "test" {
+		t.Errorf("unexpected download %q %v", data, err)
+	}
+
+	if err := rec.WaitForEvents("client", time.Second, DownloadStarted); err != nil {
+		t.Error(err)
+	}
+	if err := rec.WaitForPing("client", time.Second); err != nil {
+		t.Error(err)
+	}
+
+	// corrupt payload
+	u.Manifest.Packages[0].Sha1 = "bogus"
+	if _, err := c.Download(u, out); err == nil {
+		t.Error("corrupt download succeeded")
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("corrupt download not removed: %v", err)
+	}
+
+	s.Updater = UpdaterStub{}
+	if _, err := c.CheckUpdate(); err != NoUpdate {
+		t.Errorf("expected no update, got %v", err)
+	}
+	s.Updater = unknownAppUpdater{}
+	if _, err := c.CheckUpdate(); err != AppUnknownId {
+		t.Errorf("expected unknown app, got %v", err)
+	}
+}
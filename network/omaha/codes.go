@@ -155,6 +155,8 @@ const (
 
 	// Extra error values
 	AppInvalidVersion AppStatus = "error-invalidVersion"
+	AppInvalidEvent   AppStatus = "error-invalidEvent"
+	AppInvalidRequest AppStatus = "error-invalidRequest"
 	AppInternalError  AppStatus = "error-internal"
 )
 
@@ -0,0 +1,176 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"testing"
+)
+
+// fuzzWriter is a minimal http.ResponseWriter.
+type fuzzWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *fuzzWriter) Header() http.Header         { return w.header }
+func (w *fuzzWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *fuzzWriter) WriteHeader(int)             {}
+
+// roundTrip checks that v, decoded from data, encodes to XML that
+// decodes back to the same value.
+func roundTrip(v, v2 interface{}) error {
+	b1, err := xml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %v", err)
+	}
+	if err := xml.Unmarshal(b1, v2); err != nil {
+		return fmt.Errorf("unmarshal %q: %v", b1, err)
+	}
+	b2, err := xml.Marshal(v2)
+	if err != nil {
+		return fmt.Errorf("marshal again: %v", err)
+	}
+	if !bytes.Equal(b1, b2) {
+		return fmt.Errorf("round trip changed %q to %q", b1, b2)
+	}
+	return nil
+}
+
+// fuzz exercises XML handling with arbitrary input, returning 1 if data
+// is an interesting request, 0 otherwise, and an error for any bug.
+func fuzz(data []byte) (int, error) {
+	var resp Response
+	if err := xml.Unmarshal(data, &resp); err == nil {
+		if err := roundTrip(&resp, &Response{}); err != nil {
+			return 0, fmt.Errorf("response: %v", err)
+		}
+	}
+
+	var req Request
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return 0, nil
+	}
+	if err := roundTrip(&req, &Request{}); err != nil {
+		return 0, fmt.Errorf("request: %v", err)
+	}
+
+	handler := &OmahaHandler{Updater: UpdaterStub{}, Strict: true}
+	httpReq, err := http.NewRequest("POST", "/v1/update/", bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	w := &fuzzWriter{header: make(http.Header)}
+	handler.ServeHTTP(w, httpReq)
+	if w.Header().Get("Content-Type") != "text/xml; charset=utf-8" {
+		// rejected before processing any apps
+		return 0, nil
+	}
+	if err := xml.Unmarshal(w.body.Bytes(), &resp); err != nil {
+		return 0, fmt.Errorf("invalid response %q: %v", w.body.Bytes(), err)
+	}
+	if len(resp.Apps) != len(req.Apps) {
+		return 0, fmt.Errorf("%d apps in response to %d", len(resp.Apps), len(req.Apps))
+	}
+	return 1, nil
+}
+
+func fuzzCorpus(t *testing.T) [][]byte {
+	req := NewRequest()
+	app := req.AddApp(testAppId, testAppVer)
+	app.Track = "stable"
+	app.DeltaOK = true
+	app.AddPing()
+	app.AddUpdateCheck()
+	event := app.AddEvent()
+	event.Type = EventTypeUpdateComplete
+	event.Result = EventResultSuccessReboot
+	event.PreviousVersion = "0.9.0"
+	req.AddApp(testAppId, "bogus")
+
+	resp := NewResponse()
+	u := resp.AddApp(testAppId, AppOK).AddUpdateCheck(UpdateOK)
+	u.AddURL("http://localhost/packages/")
+	u.AddManifest("1.1.0").AddPackage().Name = "update.gz"
+
+	var corpus [][]byte
+	for _, v := range []interface{}{req, resp} {
+		b, err := xml.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus = append(corpus, b)
+	}
+	return append(corpus,
+		[]byte(SampleUpdate),
+		[]byte(`<request protocol="3.0"><app appid="" version=""></app></request>`),
+		[]byte(`<request protocol="3.0"><os platform="CoreOS"/></request><request/>`),
+		[]byte(`<response protocol="3.0"><app status="&amp;&lt;&#x10FFFF;"/></response>`))
+}
+
+// mutate randomly changes, duplicates or removes bytes.
+func mutate(r *rand.Rand, b []byte) []byte {
+	b = append([]byte(nil), b...)
+	for n := r.Intn(4) + 1; n > 0 && len(b) > 0; n-- {
+		i := r.Intn(len(b))
+		switch r.Intn(4) {
+		case 0:
+			b[i] = byte(r.Intn(256))
+		case 1:
+			b[i] = "<>/=\"'&; -{}0123456789"[r.Intn(22)]
+		case 2:
+			j := i + r.Intn(len(b)-i)
+			b = append(b[:i], append(append([]byte(nil), b[i:j]...), b[i:]...)...)
+		case 3:
+			j := i + r.Intn(len(b)-i)
+			b = append(b[:i], b[j:]...)
+		}
+	}
+	return b
+}
+
+func TestFuzzCorpus(t *testing.T) {
+	for _, data := range fuzzCorpus(t) {
+		if _, err := fuzz(data); err != nil {
+			t.Errorf("%q: %v", data, err)
+		}
+	}
+}
+
+func TestFuzzMutations(t *testing.T) {
+	iterations := 20000
+	if testing.Short() {
+		iterations = 1000
+	}
+
+	r := rand.New(rand.NewSource(1))
+	corpus := fuzzCorpus(t)
+	interesting := 0
+	for i := 0; i < iterations; i++ {
+		data := mutate(r, corpus[r.Intn(len(corpus))])
+		n, err := fuzz(data)
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		interesting += n
+	}
+	if interesting == 0 {
+		t.Errorf("no valid requests generated")
+	}
+}
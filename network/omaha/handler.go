@@ -15,7 +15,9 @@
 package omaha
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"net/http"
 
@@ -28,6 +30,10 @@ var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "network/omaha"
 
 type OmahaHandler struct {
 	Updater
+
+	// Strict rejects requests that are malformed in any way, instead
+	// of only those the Updater cannot handle. See ValidateApp.
+	Strict bool
 }
 
 func (o *OmahaHandler) ServeHTTP(w http.ResponseWriter, httpReq *http.Request) {
@@ -62,10 +68,26 @@ func (o *OmahaHandler) ServeHTTP(w http.ResponseWriter, httpReq *http.Request) {
 		return
 	}
 
+	if o.Strict {
+		if err := checkTrailer(decoder); err != nil {
+			plog.Errorf("Invalid XML after request: %v", err)
+			http.Error(w, "Invalid XML", http.StatusBadRequest)
+			return
+		}
+	}
+
 	httpStatus := 0
 	omahaResp := NewResponse()
+	seen := make(map[string]bool)
 	for _, appReq := range omahaReq.Apps {
-		appResp := o.serveApp(omahaResp, httpReq, &omahaReq, appReq)
+		var appResp *AppResponse
+		if o.Strict && seen[appReq.Id] {
+			plog.Errorf("Duplicate app: %q", appReq.Id)
+			appResp = omahaResp.AddApp(appReq.Id, AppInvalidId)
+		} else {
+			appResp = o.serveApp(omahaResp, httpReq, &omahaReq, appReq)
+		}
+		seen[appReq.Id] = true
 		if appResp.Status == AppOK {
 			// HTTP is ok if any app is ok.
 			httpStatus = http.StatusOK
@@ -106,7 +128,36 @@ func (o *OmahaHandler) ServeHTTP(w http.ResponseWriter, httpReq *http.Request) {
 	}
 }
 
+// checkTrailer ensures nothing but whitespace, comments and processing
+// instructions follow the request.
+func checkTrailer(decoder *xml.Decoder) error {
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) != 0 {
+				return fmt.Errorf("unexpected text %q", string(t))
+			}
+		case xml.Comment, xml.ProcInst:
+		default:
+			return fmt.Errorf("unexpected %T", tok)
+		}
+	}
+}
+
 func (o *OmahaHandler) serveApp(omahaResp *Response, httpReq *http.Request, omahaReq *Request, appReq *AppRequest) *AppResponse {
+	if o.Strict {
+		if err := ValidateApp(appReq); err != nil {
+			plog.Errorf("Invalid app %q: %v", appReq.Id, err)
+			return omahaResp.AddApp(appReq.Id, err.(AppStatus))
+		}
+	}
+
 	if err := o.CheckApp(omahaReq, appReq); err != nil {
 		if appStatus, ok := err.(AppStatus); ok {
 			return omahaResp.AddApp(appReq.Id, appStatus)
@@ -134,6 +185,14 @@ func (o *OmahaHandler) serveApp(omahaResp *Response, httpReq *http.Request, omah
 }
 
 func (o *OmahaHandler) checkUpdate(appResp *AppResponse, httpReq *http.Request, omahaReq *Request, appReq *AppRequest) {
+	if o.Strict {
+		if err := ValidateUpdateCheck(omahaReq, appReq); err != nil {
+			plog.Errorf("Invalid update check for %q: %v", appReq.Id, err)
+			appResp.AddUpdateCheck(err.(UpdateStatus))
+			return
+		}
+	}
+
 	update, err := o.CheckUpdate(omahaReq, appReq)
 	if err != nil {
 		if updateStatus, ok := err.(UpdateStatus); ok {
@@ -144,13 +203,25 @@ func (o *OmahaHandler) checkUpdate(appResp *AppResponse, httpReq *http.Request,
 		}
 	} else if update != nil {
 		u := appResp.AddUpdateCheck(UpdateOK)
-		fillUpdate(u, update, httpReq)
+		fillUpdate(u, update, o.urlPrefixes(httpReq))
 	} else {
 		appResp.AddUpdateCheck(NoUpdate)
 	}
 }
 
-func fillUpdate(u *UpdateResponse, update *Update, httpReq *http.Request) {
+// urlPrefixes returns where clients should download payloads from.
+func (o *OmahaHandler) urlPrefixes(httpReq *http.Request) []string {
+	u := findUpdater(o.Updater, func(u Updater) bool {
+		_, ok := u.(URLPrefixer)
+		return ok
+	})
+	if u == nil {
+		return []string{localURL(httpReq)}
+	}
+	return u.(URLPrefixer).URLPrefixes(httpReq)
+}
+
+func fillUpdate(u *UpdateResponse, update *Update, prefixes []string) {
 	if update.PreviousVersion == "" {
 		plog.Infof("Update to %s via full update payload",
 			update.Version)
@@ -158,6 +229,6 @@ func fillUpdate(u *UpdateResponse, update *Update, httpReq *http.Request) {
 		plog.Infof("Update from %s to %s via delta update payload",
 			update.PreviousVersion, update.Version)
 	}
-	u.URLs = update.URLs([]string{"http://" + httpReq.Host})
+	u.URLs = update.URLs(prefixes)
 	u.Manifest = &update.Manifest
 }
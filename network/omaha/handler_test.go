@@ -59,7 +59,7 @@ func compareXML(a, b interface{}) error {
 }
 
 func TestHandleNilRequest(t *testing.T) {
-	handler := OmahaHandler{UpdaterStub{}}
+	handler := OmahaHandler{Updater: UpdaterStub{}}
 	response := NewResponse()
 	handler.serveApp(response, nil, nilRequest, nilRequest.Apps[0])
 	if err := compareXML(nilResponse, response); err != nil {
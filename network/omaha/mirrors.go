@@ -0,0 +1,175 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLPrefixer is implemented by Updaters that choose where clients
+// download payloads from. The update's codebase is appended to each
+// prefix, clients try them in order. By default clients are sent to the
+// Omaha server itself.
+type URLPrefixer interface {
+	URLPrefixes(httpReq *http.Request) []string
+}
+
+// Mirror is a server hosting update payloads under the same paths as
+// the Omaha server.
+type Mirror struct {
+	// URL prefix such as https://cdn.example.com, or empty for the
+	// Omaha server itself.
+	URL string `json:"url"`
+	// Weight makes a mirror proportionally more likely to be tried
+	// first. Zero is the same as one.
+	Weight int `json:"weight,omitempty"`
+	// Region limits the mirror to clients in that region, if set.
+	Region string `json:"region,omitempty"`
+}
+
+// ParseMirror reads a Mirror from [REGION=]URL[,WEIGHT], for example
+// "US=https://us.example.com,2".
+func ParseMirror(spec string) (Mirror, error) {
+	var m Mirror
+	if i := strings.Index(spec, "="); i >= 0 && !strings.ContainsAny(spec[:i], ":/") {
+		if i == 0 {
+			return m, fmt.Errorf("empty mirror region in %q", spec)
+		}
+		m.Region, spec = spec[:i], spec[i+1:]
+	}
+	if i := strings.LastIndex(spec, ","); i >= 0 {
+		n, err := strconv.Atoi(spec[i+1:])
+		if err != nil || n <= 0 {
+			return m, fmt.Errorf("invalid mirror weight %q", spec[i+1:])
+		}
+		m.Weight, spec = n, spec[:i]
+	}
+	if spec == "" {
+		return m, fmt.Errorf("mirror URL is empty")
+	}
+	m.URL = spec
+	return m, nil
+}
+
+// MirrorList orders mirrors for each request. Mirrors in the client's
+// region come first, then mirrors for all regions, each group in a
+// random order weighted by Weight.
+type MirrorList struct {
+	Mirrors []Mirror `json:"mirrors"`
+	// RegionHeader names the HTTP request header holding the client's
+	// region, as set by a load balancer or CDN, e.g. CF-IPCountry.
+	RegionHeader string `json:"region_header,omitempty"`
+	// Fallback offers the Omaha server itself after all mirrors.
+	Fallback bool `json:"fallback,omitempty"`
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// localURL returns the address of the server handling httpReq.
+func localURL(httpReq *http.Request) string {
+	if httpReq.TLS != nil {
+		return "https://" + httpReq.Host
+	}
+	return "http://" + httpReq.Host
+}
+
+// shuffle orders mirrors randomly, weighted by Weight.
+func (m *MirrorList) shuffle(mirrors []Mirror) []Mirror {
+	weight := func(mirror Mirror) int {
+		if mirror.Weight <= 0 {
+			return 1
+		}
+		return mirror.Weight
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rand == nil {
+		m.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	mirrors = append([]Mirror(nil), mirrors...)
+	for i := range mirrors {
+		total := 0
+		for _, mirror := range mirrors[i:] {
+			total += weight(mirror)
+		}
+		pick := m.rand.Intn(total)
+		for j := i; j < len(mirrors); j++ {
+			if pick -= weight(mirrors[j]); pick < 0 {
+				mirrors[i], mirrors[j] = mirrors[j], mirrors[i]
+				break
+			}
+		}
+	}
+	return mirrors
+}
+
+// URLPrefixes returns the mirrors to offer the client making httpReq.
+func (m *MirrorList) URLPrefixes(httpReq *http.Request) []string {
+	region := ""
+	if m.RegionHeader != "" {
+		region = httpReq.Header.Get(m.RegionHeader)
+	}
+
+	var regional, global []Mirror
+	for _, mirror := range m.Mirrors {
+		switch mirror.Region {
+		case "":
+			global = append(global, mirror)
+		case region:
+			regional = append(regional, mirror)
+		}
+	}
+
+	var prefixes []string
+	for _, mirror := range append(m.shuffle(regional), m.shuffle(global)...) {
+		if mirror.URL == "" {
+			prefixes = append(prefixes, localURL(httpReq))
+		} else {
+			prefixes = append(prefixes, mirror.URL)
+		}
+	}
+	if len(prefixes) == 0 || m.Fallback {
+		prefixes = append(prefixes, localURL(httpReq))
+	}
+	return prefixes
+}
+
+// MirrorUpdater offers another Updater's updates from mirrors.
+type MirrorUpdater struct {
+	Updater
+	*MirrorList
+}
+
+// NewMirrorUpdater wraps updater, offering its updates from mirrors.
+func NewMirrorUpdater(updater Updater, mirrors ...Mirror) *MirrorUpdater {
+	return &MirrorUpdater{
+		Updater:    updater,
+		MirrorList: &MirrorList{Mirrors: mirrors},
+	}
+}
+
+// Unwrap returns the Updater whose updates are offered from mirrors.
+func (m *MirrorUpdater) Unwrap() Updater {
+	return m.Updater
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMirrorOrder(t *testing.T) {
+	m := &MirrorList{
+		Mirrors: []Mirror{
+			{URL: "https://heavy", Weight: 3},
+			{URL: "https://light"},
+			{URL: "https://eu", Region: "EU"},
+			{URL: "https://us", Region: "US"},
+			{URL: ""},
+		},
+		RegionHeader: "X-Region",
+		rand:         rand.New(rand.NewSource(1)),
+	}
+
+	req, err := http.NewRequest("GET", "http://omaha:8080/v1/update/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Region", "EU")
+
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		prefixes := m.URLPrefixes(req)
+		if len(prefixes) != 4 || prefixes[0] != "https://eu" {
+			t.Fatalf("unexpected mirrors %v", prefixes)
+		}
+		first[prefixes[1]]++
+	}
+	// heavy has weight 3 of 5
+	if n := first["https://heavy"]; n < 500 || n > 700 {
+		t.Errorf("heavy mirror first %d times of 1000: %v", n, first)
+	}
+	if n := first["http://omaha:8080"]; n < 100 || n > 300 {
+		t.Errorf("local mirror first %d times of 1000: %v", n, first)
+	}
+
+	req.Header.Del("X-Region")
+	for _, prefix := range m.URLPrefixes(req) {
+		if prefix == "https://eu" || prefix == "https://us" {
+			t.Errorf("regional mirror %s offered without a region", prefix)
+		}
+	}
+
+	m.Mirrors = []Mirror{{URL: "https://heavy", Weight: 3}, {URL: "https://light"}}
+	m.Fallback = true
+	for i := 0; i < 10; i++ {
+		prefixes := m.URLPrefixes(req)
+		if len(prefixes) != 3 || prefixes[2] != "http://omaha:8080" {
+			t.Fatalf("unexpected mirrors with fallback %v", prefixes)
+		}
+	}
+
+	m.Mirrors = nil
+	if prefixes := m.URLPrefixes(req); !reflect.DeepEqual(prefixes, []string{"http://omaha:8080"}) {
+		t.Errorf("unexpected default mirrors %v", prefixes)
+	}
+}
+
+func TestMirrorServer(t *testing.T) {
+	u := NewMirrorUpdater(&trivialUpdater{
+		update: &Update{
+			URL: URL{CodeBase: "/packages/"},
+			Manifest: Manifest{
+				Version:  "1.1.0",
+				Packages: []*Package{{Name: "update.gz"}},
+			},
+		},
+	}, Mirror{URL: "https://us.example.com", Region: "US"}, Mirror{})
+	u.RegionHeader = "X-Region"
+
+	s, err := NewServer("127.0.0.1:0", u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	s.EnableAdmin()
+	go s.Serve()
+
+	c := NewClient(fmt.Sprintf("http://%s/v1/update/", s.Addr()), testAppId, testAppVer)
+	c.HTTPClient = &http.Client{Transport: headerTransport{"X-Region", "US"}}
+	resp, err := c.CheckUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*URL{
+		{CodeBase: "https://us.example.com/packages/"},
+		{CodeBase: fmt.Sprintf("http://%s/packages/", s.Addr())},
+	}
+	if !reflect.DeepEqual(resp.URLs, expected) {
+		t.Errorf("unexpected URLs %v", resp.URLs)
+	}
+}
+
+// headerTransport adds a header to every request.
+type headerTransport struct {
+	key, value string
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestParseMirror(t *testing.T) {
+	for _, tt := range []struct {
+		spec   string
+		mirror Mirror
+		ok     bool
+	}{
+		{"https://cdn.example.com", Mirror{URL: "https://cdn.example.com"}, true},
+		{"https://cdn.example.com,3", Mirror{URL: "https://cdn.example.com", Weight: 3}, true},
+		{"US=https://us.example.com", Mirror{URL: "https://us.example.com", Region: "US"}, true},
+		{"US=https://us.example.com,2", Mirror{URL: "https://us.example.com", Region: "US", Weight: 2}, true},
+		{"https://example.com/?a=b", Mirror{URL: "https://example.com/?a=b"}, true},
+		{"", Mirror{}, false},
+		{"US=", Mirror{}, false},
+		{"=https://example.com", Mirror{}, false},
+		{"https://example.com,0", Mirror{}, false},
+		{"https://example.com,x", Mirror{}, false},
+	} {
+		m, err := ParseMirror(tt.spec)
+		if tt.ok && (err != nil || m != tt.mirror) {
+			t.Errorf("%q: got %+v %v wanted %+v", tt.spec, m, err, tt.mirror)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%q: expected an error, got %+v", tt.spec, m)
+		}
+	}
+}
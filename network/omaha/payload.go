@@ -0,0 +1,315 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDropped = errors.New("connection dropped by fault injection")
+
+// Fault makes a PayloadHandler misbehave. Several faults may be combined.
+type Fault struct {
+	// Status is returned instead of the payload if non-zero.
+	Status int
+	// DropAfter closes the connection after sending this many bytes
+	// of the response body if positive.
+	DropAfter int64
+	// Bandwidth limits the transfer rate in bytes per second if positive.
+	Bandwidth int64
+	// Corrupt flips the bits of the payload byte at CorruptOffset.
+	Corrupt       bool
+	CorruptOffset int64
+	// Times is the number of requests the fault applies to, or zero
+	// to apply to all further requests.
+	Times int
+}
+
+func (f *Fault) String() string {
+	var s []string
+	if f.Status != 0 {
+		s = append(s, fmt.Sprintf("status %d", f.Status))
+	}
+	if f.DropAfter > 0 {
+		s = append(s, fmt.Sprintf("drop after %d bytes", f.DropAfter))
+	}
+	if f.Bandwidth > 0 {
+		s = append(s, fmt.Sprintf("%d bytes/s", f.Bandwidth))
+	}
+	if f.Corrupt {
+		s = append(s, fmt.Sprintf("corrupt offset %d", f.CorruptOffset))
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+// ParseFault reads a Fault from colon separated fields: status=CODE,
+// drop=BYTES, bandwidth=BYTES_PER_SECOND, corrupt=OFFSET and times=N.
+// For example "drop=1048576:times=2" cuts off the first two downloads
+// after 1MiB.
+func ParseFault(spec string) (Fault, error) {
+	var f Fault
+	for _, field := range strings.Split(spec, ":") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return f, fmt.Errorf("invalid fault field %q", field)
+		}
+		n, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid fault value %q", field)
+		}
+		switch kv[0] {
+		case "status":
+			if n < 100 || n > 599 {
+				return f, fmt.Errorf("invalid HTTP status %q", field)
+			}
+			f.Status = int(n)
+		case "drop":
+			f.DropAfter = n
+		case "bandwidth":
+			f.Bandwidth = n
+		case "corrupt":
+			f.Corrupt = true
+			f.CorruptOffset = n
+		case "times":
+			f.Times = int(n)
+		default:
+			return f, fmt.Errorf("unknown fault %q", kv[0])
+		}
+	}
+	return f, nil
+}
+
+// PayloadRequest records a request for a payload.
+type PayloadRequest struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Range      string    `json:"range,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Fault      string    `json:"fault,omitempty"`
+}
+
+// PayloadHandler serves an update payload, including range requests
+// for resumed downloads, injecting faults to exercise the retry and
+// verification logic of clients. All requests are logged.
+type PayloadHandler struct {
+	mu       sync.Mutex
+	path     string
+	faults   []Fault
+	requests []PayloadRequest
+}
+
+// SetPath changes the file served.
+func (p *PayloadHandler) SetPath(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.path = path
+}
+
+// SetFaults replaces the faults to inject. Each applies to the number of
+// requests given by its Times before moving on to the next.
+func (p *PayloadHandler) SetFaults(faults ...Fault) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = append([]Fault(nil), faults...)
+}
+
+// Requests returns the log of requests served.
+func (p *PayloadHandler) Requests() []PayloadRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PayloadRequest(nil), p.requests...)
+}
+
+// next returns the file to serve and the fault to inject, if any.
+func (p *PayloadHandler) next() (string, *Fault) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.faults) == 0 {
+		return p.path, nil
+	}
+	f := p.faults[0]
+	if f.Times > 0 {
+		if p.faults[0].Times--; p.faults[0].Times == 0 {
+			p.faults = p.faults[1:]
+		}
+	}
+	return p.path, &f
+}
+
+func (p *PayloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, fault := p.next()
+	fw := &faultWriter{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		req := PayloadRequest{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Range:      r.Header.Get("Range"),
+			Status:     fw.status,
+			Bytes:      fw.written,
+		}
+		if fault != nil {
+			req.Fault = fault.String()
+		}
+		plog.Infof("Payload %s from %s range %q: %d, %d bytes, fault: %s",
+			path, req.RemoteAddr, req.Range, req.Status, req.Bytes, req.Fault)
+		p.mu.Lock()
+		p.requests = append(p.requests, req)
+		p.mu.Unlock()
+	}()
+
+	if path == "" {
+		http.NotFound(fw, r)
+		return
+	}
+	if fault != nil && fault.Status != 0 {
+		http.Error(fw, http.StatusText(fault.Status), fault.Status)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(fw, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(fw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var content io.ReadSeeker = f
+	if fault != nil {
+		fw.fault = fault
+		if fault.Corrupt {
+			content = &corruptReader{ReadSeeker: f, offset: fault.CorruptOffset}
+		}
+	}
+	http.ServeContent(fw, r, fi.Name(), fi.ModTime(), content)
+}
+
+// faultWriter counts, throttles and truncates a response body.
+type faultWriter struct {
+	http.ResponseWriter
+	fault   *Fault
+	status  int
+	written int64
+	dropped bool
+}
+
+func (fw *faultWriter) WriteHeader(status int) {
+	fw.status = status
+	fw.ResponseWriter.WriteHeader(status)
+}
+
+func (fw *faultWriter) Write(b []byte) (int, error) {
+	if fw.dropped {
+		return 0, errDropped
+	}
+	if fw.fault == nil {
+		n, err := fw.ResponseWriter.Write(b)
+		fw.written += int64(n)
+		return n, err
+	}
+
+	total := 0
+	for len(b) > 0 {
+		chunk := b
+		if fw.fault.DropAfter > 0 {
+			if left := fw.fault.DropAfter - fw.written; int64(len(chunk)) > left {
+				chunk = chunk[:left]
+			}
+		}
+		if bw := fw.fault.Bandwidth; bw > 0 {
+			if max := bw/10 + 1; int64(len(chunk)) > max {
+				chunk = chunk[:max]
+			}
+			time.Sleep(time.Duration(len(chunk)) * time.Second / time.Duration(bw))
+		}
+
+		n, err := fw.ResponseWriter.Write(chunk)
+		fw.written += int64(n)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		b = b[n:]
+
+		if fw.fault.DropAfter > 0 && fw.written >= fw.fault.DropAfter {
+			fw.drop()
+			return total, errDropped
+		}
+		if fw.fault.Bandwidth > 0 {
+			if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+	return total, nil
+}
+
+// drop closes the connection without completing the response.
+func (fw *faultWriter) drop() {
+	fw.dropped = true
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	h, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := h.Hijack()
+	if err != nil {
+		plog.Errorf("Dropping connection failed: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+// corruptReader flips the bits of the byte at offset.
+type corruptReader struct {
+	io.ReadSeeker
+	offset int64
+	pos    int64
+}
+
+func (c *corruptReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		c.pos = pos
+	}
+	return pos, err
+}
+
+func (c *corruptReader) Read(b []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(b)
+	if c.offset >= c.pos && c.offset < c.pos+int64(n) {
+		b[c.offset-c.pos] ^= 0xff
+	}
+	c.pos += int64(n)
+	return n, err
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getPayload(t *testing.T, url, rangeHeader string) (int, []byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, data, err
+}
+
+func TestPayloadFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	payload := filepath.Join(dir, "payload")
+	if err := ioutil.WriteFile(payload, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewTrivialServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	if err := s.SetPackage(payload); err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	url := fmt.Sprintf("http://%s/packages/update.gz", s.Addr())
+
+	// error once, then drop, then serve the rest with a range request
+	s.Payload.SetFaults(
+		Fault{Status: http.StatusServiceUnavailable, Times: 1},
+		Fault{DropAfter: 300, Times: 1})
+
+	if status, _, err := getPayload(t, url, ""); err != nil || status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d %v", status, err)
+	}
+	status, data, err := getPayload(t, url, "")
+	if err == nil || status != http.StatusOK || len(data) != 300 {
+		t.Errorf("expected truncated download, got %d bytes %v", len(data), err)
+	}
+	status, rest, err := getPayload(t, url, fmt.Sprintf("bytes=%d-", len(data)))
+	if err != nil || status != http.StatusPartialContent {
+		t.Fatalf("range request failed: %d %v", status, err)
+	}
+	if !bytes.Equal(append(data, rest...), content) {
+		t.Errorf("resumed download does not match")
+	}
+
+	// corruption is detected by the client
+	s.Payload.SetFaults(Fault{Corrupt: true, CorruptOffset: 500})
+	c := NewClient(fmt.Sprintf("http://%s/v1/update/", s.Addr()), testAppId, testAppVer)
+	u, err := c.CheckUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Download(u, dir); err == nil || !strings.Contains(err.Error(), PackageHashMismatchError.Error()) {
+		t.Errorf("expected hash mismatch, got %v", err)
+	}
+	if _, data, _ := getPayload(t, url, "bytes=500-500"); len(data) != 1 || data[0] != content[500]^0xff {
+		t.Errorf("range not corrupted: %q", data)
+	}
+
+	// 1000 bytes at 5000 bytes/s
+	s.Payload.SetFaults(Fault{Bandwidth: 5000})
+	start := time.Now()
+	if _, data, err := getPayload(t, url, ""); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("throttled download failed: %v", err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("throttled download took only %s", d)
+	}
+
+	s.Payload.SetFaults()
+	if _, data, err := getPayload(t, url, ""); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("download failed: %v", err)
+	}
+
+	log := s.Payload.Requests()
+	if len(log) != 7 {
+		t.Fatalf("logged %d requests: %+v", len(log), log)
+	}
+	if log[0].Status != http.StatusServiceUnavailable || log[1].Bytes != 300 ||
+		log[2].Range != "bytes=300-" || log[2].Status != http.StatusPartialContent ||
+		log[6].Fault != "" || log[6].Bytes != int64(len(content)) {
+		t.Errorf("unexpected log %+v", log)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		fault Fault
+		ok    bool
+	}{
+		{"status=503", Fault{Status: 503}, true},
+		{"drop=1048576:times=2", Fault{DropAfter: 1048576, Times: 2}, true},
+		{"bandwidth=1000:corrupt=0", Fault{Bandwidth: 1000, Corrupt: true}, true},
+		{"corrupt=42:times=1", Fault{Corrupt: true, CorruptOffset: 42, Times: 1}, true},
+		{"", Fault{}, false},
+		{"drop", Fault{}, false},
+		{"drop=-1", Fault{}, false},
+		{"slow=1", Fault{}, false},
+		{"status=42", Fault{}, false},
+		{"status=1000", Fault{}, false},
+	} {
+		f, err := ParseFault(tt.spec)
+		if tt.ok && (err != nil || f != tt.fault) {
+			t.Errorf("%q: got %+v %v wanted %+v", tt.spec, f, err, tt.fault)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%q: expected an error, got %+v", tt.spec, f)
+		}
+	}
+}
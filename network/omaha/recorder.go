@@ -0,0 +1,335 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type RecordKind string
+
+const (
+	RecordUpdateCheck RecordKind = "updatecheck"
+	RecordPing        RecordKind = "ping"
+	RecordEvent       RecordKind = "event"
+)
+
+// Record is an update check, ping or event received from a machine.
+type Record struct {
+	Time      time.Time  `json:"time"`
+	Kind      RecordKind `json:"kind"`
+	MachineID string     `json:"machine_id,omitempty"`
+	BootId    string     `json:"boot_id,omitempty"`
+	AppId     string     `json:"app_id"`
+	Version   string     `json:"version"`
+	Track     string     `json:"track,omitempty"`
+	Board     string     `json:"board,omitempty"`
+
+	// Update checks record the result and the version offered, if any.
+	Status UpdateStatus `json:"status,omitempty"`
+	Update string       `json:"update,omitempty"`
+
+	Event *EventRequest `json:"event,omitempty"`
+}
+
+func (r *Record) String() string {
+	s := fmt.Sprintf("%s %s", r.MachineID, r.Kind)
+	switch {
+	case r.Event != nil:
+		s += fmt.Sprintf(" %s: %s", r.Event.Type, r.Event.Result)
+		if r.Event.ErrorCode != "" {
+			s += " (error code " + r.Event.ErrorCode + ")"
+		}
+	case r.Status != "":
+		s += fmt.Sprintf(": %s %s", r.Status, r.Update)
+	}
+	return s
+}
+
+// EventMatch selects events by type, result and, if set, the version
+// the machine was running when it sent the event.
+type EventMatch struct {
+	Type    EventType
+	Result  EventResult
+	Version string
+}
+
+func (m EventMatch) String() string {
+	s := fmt.Sprintf("%s: %s", m.Type, m.Result)
+	if m.Version != "" {
+		s += " from " + m.Version
+	}
+	return s
+}
+
+func (m EventMatch) matches(r *Record) bool {
+	return r.Event != nil &&
+		r.Event.Type == m.Type &&
+		r.Event.Result == m.Result &&
+		(m.Version == "" || m.Version == r.Version)
+}
+
+// Events reported by update_engine as it applies an update.
+var (
+	DownloadStarted  = EventMatch{Type: EventTypeUpdateDownloadStarted, Result: EventResultSuccess}
+	DownloadFinished = EventMatch{Type: EventTypeUpdateDownloadFinished, Result: EventResultSuccess}
+	UpdateInstalled  = EventMatch{Type: EventTypeUpdateComplete, Result: EventResultSuccess}
+	UpdateRebooted   = EventMatch{Type: EventTypeUpdateComplete, Result: EventResultSuccessReboot}
+)
+
+// DefaultMaxRecords is the number of records a RecordingUpdater keeps
+// in memory by default.
+const DefaultMaxRecords = 10000
+
+// RecordingUpdater records every update check, ping and event handled
+// by another Updater so tests can inspect and wait for them.
+type RecordingUpdater struct {
+	Updater
+
+	// MaxRecords limits the records kept in memory, dropping the
+	// oldest. Zero keeps everything. A Store still has them all.
+	MaxRecords int
+
+	mu      sync.Mutex
+	records []*Record
+	changed chan struct{} // closed when a record is added
+	store   Store
+}
+
+// NewRecordingUpdater wraps updater.
+func NewRecordingUpdater(updater Updater) *RecordingUpdater {
+	return &RecordingUpdater{
+		Updater:    updater,
+		MaxRecords: DefaultMaxRecords,
+		changed:    make(chan struct{}),
+	}
+}
+
+// Unwrap returns the Updater being recorded.
+func (r *RecordingUpdater) Unwrap() Updater {
+	return r.Updater
+}
+
+func (r *RecordingUpdater) record(kind RecordKind, app *AppRequest) *Record {
+	return &Record{
+		Time:      time.Now(),
+		Kind:      kind,
+		MachineID: app.MachineID,
+		BootId:    app.BootId,
+		AppId:     app.Id,
+		Version:   app.Version,
+		Track:     app.Track,
+		Board:     app.Board,
+	}
+}
+
+// trim drops the oldest records over MaxRecords.
+func (r *RecordingUpdater) trim() {
+	if over := len(r.records) - r.MaxRecords; r.MaxRecords > 0 && over > 0 {
+		r.records = r.records[over:]
+	}
+}
+
+func (r *RecordingUpdater) add(rec *Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plog.Debugf("Recorded %s", rec)
+	r.records = append(r.records, rec)
+	r.trim()
+	if r.store != nil {
+		if err := r.store.AddRecord(rec); err != nil {
+			plog.Errorf("Failed storing record: %v", err)
+		}
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *RecordingUpdater) CheckUpdate(req *Request, app *AppRequest) (*Update, error) {
+	update, err := r.Updater.CheckUpdate(req, app)
+	rec := r.record(RecordUpdateCheck, app)
+	switch status := err.(type) {
+	case nil:
+		if update != nil {
+			rec.Status = UpdateOK
+			rec.Update = update.Version
+		} else {
+			rec.Status = NoUpdate
+		}
+	case UpdateStatus:
+		rec.Status = status
+	default:
+		rec.Status = UpdateInternalError
+	}
+	r.add(rec)
+	return update, err
+}
+
+func (r *RecordingUpdater) Event(req *Request, app *AppRequest, event *EventRequest) {
+	rec := r.record(RecordEvent, app)
+	ev := *event
+	rec.Event = &ev
+	r.add(rec)
+	r.Updater.Event(req, app, event)
+}
+
+func (r *RecordingUpdater) Ping(req *Request, app *AppRequest) {
+	r.add(r.record(RecordPing, app))
+	r.Updater.Ping(req, app)
+}
+
+// SetStore loads the history kept in a Store, up to MaxRecords and
+// ahead of anything already recorded, and adds new records to it.
+func (r *RecordingUpdater) SetStore(s Store) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := s.Records(r.MaxRecords)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range r.records {
+		if err := s.AddRecord(rec); err != nil {
+			return err
+		}
+	}
+	r.records = append(stored, r.records...)
+	r.trim()
+	r.store = s
+	return nil
+}
+
+// Records returns everything recorded from a machine, or from all
+// machines if machineID is empty, in the order received.
+func (r *RecordingUpdater) Records(machineID string) []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var records []Record
+	for _, rec := range r.records {
+		if machineID == "" || rec.MachineID == machineID {
+			records = append(records, *rec)
+		}
+	}
+	return records
+}
+
+// Machines returns the ids of all machines seen, in order of appearance.
+func (r *RecordingUpdater) Machines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	var ids []string
+	for _, rec := range r.records {
+		if !seen[rec.MachineID] {
+			seen[rec.MachineID] = true
+			ids = append(ids, rec.MachineID)
+		}
+	}
+	return ids
+}
+
+// Reset discards all records. Records already saved in a Store are kept.
+func (r *RecordingUpdater) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = nil
+}
+
+// Wait blocks until done returns true for the records of a machine, or
+// all machines if machineID is empty.
+func (r *RecordingUpdater) Wait(machineID string, timeout time.Duration, done func([]Record) bool) error {
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		changed := r.changed
+		r.mu.Unlock()
+
+		if done(r.Records(machineID)) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+}
+
+// WaitForPing waits for a ping from a machine, or any machine if
+// machineID is empty.
+func (r *RecordingUpdater) WaitForPing(machineID string, timeout time.Duration) error {
+	err := r.Wait(machineID, timeout, func(records []Record) bool {
+		for _, rec := range records {
+			if rec.Kind == RecordPing {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for ping: %v", err)
+	}
+	return nil
+}
+
+// WaitForEvents waits for a machine to send events matching seq, in
+// order but not necessarily consecutively. Events recorded before the
+// call count, use Reset to ignore them.
+func (r *RecordingUpdater) WaitForEvents(machineID string, timeout time.Duration, seq ...EventMatch) error {
+	next := 0
+	var last *Record
+	err := r.Wait(machineID, timeout, func(records []Record) bool {
+		next = 0
+		last = nil
+		for i := range records {
+			if records[i].Event == nil {
+				continue
+			}
+			last = &records[i]
+			if next < len(seq) && seq[next].matches(last) {
+				next++
+			}
+		}
+		return next == len(seq)
+	})
+	if err != nil {
+		err = fmt.Errorf("waiting for event %q: %v", seq[next], err)
+		if last != nil {
+			err = fmt.Errorf("%v, last event was %q", err, last.String())
+		}
+	}
+	return err
+}
+
+// WriteJSON writes all records to w as a JSON array.
+func (r *RecordingUpdater) WriteJSON(w io.Writer) error {
+	records := r.Records("")
+	if records == nil {
+		records = []Record{}
+	}
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sendTestEvent(r *RecordingUpdater, machineID, version string, m EventMatch) {
+	req := NewRequest()
+	app := req.AddApp(testAppId, version)
+	app.MachineID = machineID
+	event := app.AddEvent()
+	event.Type = m.Type
+	event.Result = m.Result
+	r.Event(req, app, event)
+}
+
+func TestRecordingUpdater(t *testing.T) {
+	r := NewRecordingUpdater(&trivialUpdater{
+		update: &Update{Manifest: Manifest{Version: "1.1.0"}},
+	})
+
+	req := NewRequest()
+	app := req.AddApp(testAppId, testAppVer)
+	app.MachineID = "a"
+	r.Ping(req, app)
+	if _, err := r.CheckUpdate(req, app); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.WaitForPing("a", time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := r.WaitForPing("b", 10*time.Millisecond); err == nil {
+		t.Error("unexpected ping from b")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- r.WaitForEvents("a", 5*time.Second,
+			DownloadStarted, UpdateInstalled,
+			EventMatch{Type: EventTypeUpdateComplete, Result: EventResultSuccessReboot, Version: "1.1.0"})
+	}()
+
+	sendTestEvent(r, "a", testAppVer, DownloadStarted)
+	sendTestEvent(r, "b", testAppVer, UpdateInstalled)
+	sendTestEvent(r, "a", testAppVer, DownloadFinished)
+	sendTestEvent(r, "a", testAppVer, UpdateInstalled)
+	sendTestEvent(r, "a", testAppVer, UpdateRebooted)
+	select {
+	case err := <-done:
+		t.Fatalf("finished before reboot into 1.1.0: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	sendTestEvent(r, "a", "1.1.0", UpdateRebooted)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	records := r.Records("a")
+	if len(records) != 7 {
+		t.Fatalf("recorded %d requests from a: %v", len(records), records)
+	}
+	if records[1].Kind != RecordUpdateCheck || records[1].Status != UpdateOK || records[1].Update != "1.1.0" {
+		t.Errorf("unexpected update check record %+v", records[1])
+	}
+	if ids := r.Machines(); len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("unexpected machines %v", ids)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var exported []Record
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 8 || exported[7].Event == nil || exported[7].Event.Result != EventResultSuccessReboot {
+		t.Errorf("unexpected export %s", buf.String())
+	}
+
+	r.Reset()
+	err := r.WaitForEvents("a", 10*time.Millisecond, DownloadStarted)
+	if err == nil || !strings.Contains(err.Error(), "download started") {
+		t.Errorf("unexpected error after reset: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// RolloutPolicy limits which clients are offered a release.
+type RolloutPolicy struct {
+	// Percent of machines, selected by machine id, that may update.
+	// Machines that do not send an id are only included at 100.
+	Percent float64 `json:"percent"`
+	// Limit is the number of machines that may start updating within
+	// each Window, or in total if Window is zero. Zero means no limit.
+	Limit  int           `json:"limit,omitempty"`
+	Window time.Duration `json:"window,omitempty"`
+	// Paused withholds the release from machines not yet granted it.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// FullRollout offers a release to every machine.
+var FullRollout = RolloutPolicy{Percent: 100}
+
+// RolloutState is the policy of a release and the machines granted it.
+type RolloutState struct {
+	Policy  RolloutPolicy        `json:"policy"`
+	Granted map[string]time.Time `json:"granted,omitempty"`
+	// Recent grants are counted against the policy's limit. They are
+	// only kept while the policy has a limit.
+	Recent []time.Time `json:"recent,omitempty"`
+}
+
+// RolloutUpdater applies rollout policies to the updates offered by
+// another Updater. Policies are set per release version, releases
+// without a policy use Default. Machines granted a release keep being
+// offered it, even if later paused, so retries do not count twice.
+type RolloutUpdater struct {
+	Updater
+
+	// Default applies to versions without a policy.
+	Default RolloutPolicy
+
+	mu       sync.Mutex
+	releases map[string]*RolloutState
+	now      func() time.Time
+	store    Store
+}
+
+// NewRolloutUpdater wraps updater, offering all releases by default.
+func NewRolloutUpdater(updater Updater) *RolloutUpdater {
+	return &RolloutUpdater{
+		Updater:  updater,
+		Default:  FullRollout,
+		releases: make(map[string]*RolloutState),
+		now:      time.Now,
+	}
+}
+
+// Unwrap returns the Updater whose releases are rolled out.
+func (r *RolloutUpdater) Unwrap() Updater {
+	return r.Updater
+}
+
+func (r *RolloutUpdater) state(version string) *RolloutState {
+	s, ok := r.releases[version]
+	if !ok {
+		s = &RolloutState{
+			Policy:  r.Default,
+			Granted: make(map[string]time.Time),
+		}
+		r.releases[version] = s
+	}
+	return s
+}
+
+// save writes the policy and recent grants of a release version to the
+// Store, if any.
+func (r *RolloutUpdater) save(version string) {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.PutRollout(version, r.releases[version]); err != nil {
+		plog.Errorf("Failed storing rollout of %s: %v", version, err)
+	}
+}
+
+// saveGrant writes a machine granted a release version to the Store, if
+// any.
+func (r *RolloutUpdater) saveGrant(version, machineID string) {
+	if r.store == nil {
+		return
+	}
+	t := r.releases[version].Granted[machineID]
+	if err := r.store.PutGrant(version, machineID, t); err != nil {
+		plog.Errorf("Failed storing grant of %s to %q: %v", version, machineID, err)
+	}
+}
+
+// SetStore replaces the state of releases with any kept in a Store and
+// saves later changes to it.
+func (r *RolloutUpdater) SetStore(s Store) error {
+	stored, err := s.Rollouts()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for version, state := range stored {
+		if state.Granted == nil {
+			state.Granted = make(map[string]time.Time)
+		}
+		r.releases[version] = state
+	}
+	r.store = s
+	for version, state := range r.releases {
+		if _, ok := stored[version]; !ok {
+			r.save(version)
+			for machineID := range state.Granted {
+				r.saveGrant(version, machineID)
+			}
+		}
+	}
+	return nil
+}
+
+// SetPolicy changes the rollout policy of a release version.
+func (r *RolloutUpdater) SetPolicy(version string, policy RolloutPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.state(version)
+	s.Policy = policy
+	if policy.Limit == 0 {
+		s.Recent = nil
+	}
+	r.save(version)
+}
+
+// Policy returns the rollout policy of a release version.
+func (r *RolloutUpdater) Policy(version string) RolloutPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state(version).Policy
+}
+
+// Pause stops offering a release to machines not already granted it.
+func (r *RolloutUpdater) Pause(version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state(version).Policy.Paused = true
+	r.save(version)
+}
+
+// Resume continues a paused release.
+func (r *RolloutUpdater) Resume(version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state(version).Policy.Paused = false
+	r.save(version)
+}
+
+// Granted returns the number of machines granted a release version.
+func (r *RolloutUpdater) Granted(version string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.state(version).Granted)
+}
+
+// CheckUpdate offers the wrapped Updater's update if the release's
+// policy allows it.
+func (r *RolloutUpdater) CheckUpdate(req *Request, app *AppRequest) (*Update, error) {
+	update, err := r.Updater.CheckUpdate(req, app)
+	if err != nil || update == nil {
+		return update, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.state(update.Version)
+	if _, ok := s.Granted[app.MachineID]; ok && app.MachineID != "" {
+		return update, nil
+	}
+
+	if s.Policy.Paused || !inRollout(update.Version, app.MachineID, s.Policy.Percent) {
+		return nil, NoUpdate
+	}
+
+	now := r.now()
+	if s.Policy.Limit > 0 {
+		if s.Policy.Window > 0 {
+			start := now.Add(-s.Policy.Window)
+			for len(s.Recent) > 0 && !s.Recent[0].After(start) {
+				s.Recent = s.Recent[1:]
+			}
+		}
+		if len(s.Recent) >= s.Policy.Limit {
+			plog.Infof("Rate limiting update to %s for %q", update.Version, app.MachineID)
+			return nil, NoUpdate
+		}
+		s.Recent = append(s.Recent, now)
+		r.save(update.Version)
+	}
+
+	if app.MachineID != "" {
+		s.Granted[app.MachineID] = now
+		r.saveGrant(update.Version, app.MachineID)
+	}
+	return update, nil
+}
+
+// inRollout reports whether a machine falls within the given percentage
+// of a release. Machines are spread evenly and independently of other
+// releases by hashing the version and machine id together.
+func inRollout(version, machineID string, percent float64) bool {
+	if percent >= 100 {
+		return true
+	}
+	if machineID == "" || percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(machineID))
+	return float64(h.Sum32()%10000) < percent*100
+}
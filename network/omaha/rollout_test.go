@@ -0,0 +1,116 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestRollout() (*RolloutUpdater, *time.Time) {
+	now := time.Unix(1000, 0)
+	r := NewRolloutUpdater(&trivialUpdater{
+		update: &Update{Manifest: Manifest{Version: "1.1.0"}},
+	})
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+func checkRollout(r *RolloutUpdater, machineID string) bool {
+	req := NewRequest()
+	app := req.AddApp(testAppId, testAppVer)
+	app.MachineID = machineID
+	u, err := r.CheckUpdate(req, app)
+	return err == nil && u != nil
+}
+
+func TestRolloutPercent(t *testing.T) {
+	r, _ := newTestRollout()
+	r.SetPolicy("1.1.0", RolloutPolicy{Percent: 25})
+
+	granted := 0
+	for i := 0; i < 1000; i++ {
+		if checkRollout(r, fmt.Sprintf("machine%d", i)) {
+			granted++
+		}
+	}
+	if granted < 200 || granted > 300 {
+		t.Errorf("granted %d of 1000 machines at 25%%", granted)
+	}
+	if r.Granted("1.1.0") != granted {
+		t.Errorf("recorded %d grants, expected %d", r.Granted("1.1.0"), granted)
+	}
+
+	// selection is stable
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("machine%d", i)
+		if checkRollout(r, id) != inRollout("1.1.0", id, 25) {
+			t.Fatalf("%s: selection changed", id)
+		}
+	}
+
+	if checkRollout(r, "") {
+		t.Errorf("machine without id granted a partial rollout")
+	}
+	r.SetPolicy("1.1.0", FullRollout)
+	if !checkRollout(r, "") {
+		t.Errorf("machine without id denied a full rollout")
+	}
+
+	// without a limit there is nothing to count
+	if n := len(r.releases["1.1.0"].Recent); n != 0 {
+		t.Errorf("kept %d recent grants without a limit", n)
+	}
+}
+
+func TestRolloutLimit(t *testing.T) {
+	r, now := newTestRollout()
+	r.SetPolicy("1.1.0", RolloutPolicy{Percent: 100, Limit: 2, Window: time.Hour})
+
+	if !checkRollout(r, "a") || !checkRollout(r, "b") {
+		t.Fatalf("first machines denied")
+	}
+	if checkRollout(r, "c") {
+		t.Errorf("limit exceeded")
+	}
+	if !checkRollout(r, "a") {
+		t.Errorf("granted machine denied on retry")
+	}
+
+	*now = now.Add(time.Hour)
+	if !checkRollout(r, "c") {
+		t.Errorf("machine denied in new window")
+	}
+}
+
+func TestRolloutPause(t *testing.T) {
+	r, _ := newTestRollout()
+
+	if !checkRollout(r, "a") {
+		t.Fatalf("machine denied by default policy")
+	}
+	r.Pause("1.1.0")
+	if checkRollout(r, "b") {
+		t.Errorf("paused release granted")
+	}
+	if !checkRollout(r, "a") {
+		t.Errorf("granted machine denied after pause")
+	}
+	r.Resume("1.1.0")
+	if !checkRollout(r, "b") {
+		t.Errorf("resumed release denied")
+	}
+}
@@ -15,6 +15,7 @@
 package omaha
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 
@@ -41,27 +42,50 @@ func NewServer(addr string, updater Updater) (*Server, error) {
 		srv:     srv,
 	}
 
-	mux.Handle("/v1/update/", &OmahaHandler{s})
+	s.handler = &OmahaHandler{Updater: s}
+	mux.Handle("/v1/update/", s.handler)
 
 	return s, nil
 }
 
+// Unwrap returns the Updater answering requests.
+func (s *Server) Unwrap() Updater {
+	return s.Updater
+}
+
 type Server struct {
 	Updater
 
 	Mux *http.ServeMux
 
-	l   net.Listener
-	srv *http.Server
+	l       net.Listener
+	srv     *http.Server
+	handler *OmahaHandler
+}
+
+// SetStrict enables strict validation of requests, see OmahaHandler.
+// It should be called before Serve.
+func (s *Server) SetStrict(strict bool) {
+	s.handler.Strict = strict
 }
 
 func (s *Server) Serve() error {
-	err := s.srv.Serve(s.l)
+	return s.serve(s.l)
+}
+
+// ServeTLS is like Serve but accepts HTTPS connections using config,
+// which must include a certificate.
+func (s *Server) ServeTLS(config *tls.Config) error {
+	return s.serve(tls.NewListener(s.l, config))
+}
+
+func (s *Server) serve(l net.Listener) error {
+	err := s.srv.Serve(l)
 	if network.IsClosed(err) {
 		// gracefully quit
 		err = nil
 	}
-	return nil
+	return err
 }
 
 func (s *Server) Destroy() error {
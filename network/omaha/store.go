@@ -0,0 +1,407 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Store persists server state so it survives restarts: the releases
+// offered by a Catalog, the state of a RolloutUpdater and the client
+// history of a RecordingUpdater. Rollouts and history change with every
+// request so they may be written in the background, Close waits for
+// them to be saved.
+type Store interface {
+	// PutRelease adds or replaces a release, identified by its updates.
+	PutRelease(r *Release) error
+	Releases() ([]*Release, error)
+
+	// PutRollout replaces the policy and recent grants of a release
+	// version, PutGrant records a single machine granted it.
+	PutRollout(version string, s *RolloutState) error
+	PutGrant(version, machineID string, t time.Time) error
+	Rollouts() (map[string]*RolloutState, error)
+
+	// AddRecord appends to the client history. Records returns the
+	// last limit records in order, or all of them if limit is zero.
+	AddRecord(rec *Record) error
+	Records(limit int) ([]*Record, error)
+
+	Close() error
+}
+
+// StoreUser is implemented by Updaters that can persist their state.
+// SetStore loads any state already in the store and saves later changes.
+type StoreUser interface {
+	SetStore(s Store) error
+}
+
+// UseStore calls SetStore on every StoreUser in a chain of Updaters, such
+// as a Server wrapping a RecordingUpdater wrapping a Catalog.
+func UseStore(u Updater, s Store) error {
+	found := false
+	for ; u != nil; u = unwrapUpdater(u) {
+		if su, ok := u.(StoreUser); ok {
+			if err := su.SetStore(s); err != nil {
+				return err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no Updater supports persistent storage")
+	}
+	return nil
+}
+
+var (
+	releasesBucket = []byte("releases")
+	rolloutsBucket = []byte("rollouts")
+	grantsBucket   = []byte("grants")
+	recordsBucket  = []byte("records")
+)
+
+// BoltStore is a Store in a single bolt database file. Values are stored
+// as JSON so the file can be inspected offline with ore omaha inspect.
+// Rollouts, grants and records are queued and written in batches by a
+// background goroutine, failures are logged.
+type BoltStore struct {
+	db *bolt.DB
+
+	mu      sync.Mutex
+	queue   []boltWrite
+	wake    chan struct{} // nil for read only stores
+	stopped chan struct{}
+	closed  bool
+}
+
+// boltWrite is a queued change. done, if set, receives the result once
+// the change is committed.
+type boltWrite struct {
+	f    func(tx *bolt.Tx) error
+	done chan error
+}
+
+// OpenBoltStore opens or creates a bolt database. Only one process may
+// have it open for writing at a time.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{releasesBucket, rolloutsBucket, grantsBucket, recordsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing %s: %v", path, err)
+	}
+
+	b := &BoltStore{
+		db:      db,
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	go b.writer()
+	return b, nil
+}
+
+// OpenBoltStoreReadOnly opens an existing bolt database for reading.
+// Opening fails while a server has the database open for writing.
+func OpenBoltStoreReadOnly(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// writer commits queued changes until the store is closed. Everything
+// queued while a transaction is written goes into the next one.
+func (b *BoltStore) writer() {
+	defer close(b.stopped)
+	for {
+		_, ok := <-b.wake
+		b.mu.Lock()
+		queue := b.queue
+		b.queue = nil
+		b.mu.Unlock()
+
+		if len(queue) > 0 {
+			b.commit(queue)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func (b *BoltStore) commit(queue []boltWrite) {
+	errs := make([]error, len(queue))
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for i, w := range queue {
+			errs[i] = w.f(tx)
+			if errs[i] != nil && w.done == nil {
+				plog.Errorf("Failed storing server state: %v", errs[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		plog.Errorf("Failed storing server state: %v", err)
+	}
+	for i, w := range queue {
+		if w.done == nil {
+			continue
+		}
+		if errs[i] == nil {
+			errs[i] = err
+		}
+		w.done <- errs[i]
+	}
+}
+
+// enqueue adds a change for the writer. Read only stores try to write
+// directly so the error is reported.
+func (b *BoltStore) enqueue(w boltWrite) error {
+	if b.wake == nil {
+		return b.db.Update(w.f)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return fmt.Errorf("store is closed")
+	}
+	b.queue = append(b.queue, w)
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// update makes a change and waits for it to be committed, after any
+// changes queued before it.
+func (b *BoltStore) update(f func(tx *bolt.Tx) error) error {
+	if b.wake == nil {
+		return b.db.Update(f)
+	}
+	done := make(chan error, 1)
+	if err := b.enqueue(boltWrite{f: f, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// flush waits for all queued changes to be committed.
+func (b *BoltStore) flush() error {
+	if b.wake == nil {
+		return nil
+	}
+	return b.update(func(*bolt.Tx) error { return nil })
+}
+
+// put queues a JSON value, encoded now so later changes to v are not
+// included.
+func (b *BoltStore) put(bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.enqueue(boltWrite{f: func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	}})
+}
+
+// forEach decodes each value in a bucket with decode, after any queued
+// changes have been written.
+func (b *BoltStore) forEach(bucket []byte, decode func(k, v []byte) error) error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			if err := decode(k, v); err != nil {
+				return fmt.Errorf("%s/%q: %v", bucket, k, err)
+			}
+			return nil
+		})
+	})
+}
+
+func (b *BoltStore) PutRelease(r *Release) error {
+	if len(r.Updates) == 0 {
+		return fmt.Errorf("release has no updates")
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// releases are only offered once saved, so wait for them
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(releasesBucket).Put([]byte(strings.Join(r.Updates, "\n")), data)
+	})
+}
+
+func (b *BoltStore) Releases() ([]*Release, error) {
+	var releases []*Release
+	err := b.forEach(releasesBucket, func(k, v []byte) error {
+		r := &Release{}
+		if err := json.Unmarshal(v, r); err != nil {
+			return err
+		}
+		releases = append(releases, r)
+		return nil
+	})
+	return releases, err
+}
+
+// PutRollout saves the policy and recent grants, the machines granted
+// a release are saved separately by PutGrant.
+func (b *BoltStore) PutRollout(version string, s *RolloutState) error {
+	return b.put(rolloutsBucket, []byte(version), &RolloutState{
+		Policy: s.Policy,
+		Recent: s.Recent,
+	})
+}
+
+// grantKey joins a version and machine id. Neither contain NUL bytes.
+func grantKey(version, machineID string) []byte {
+	return []byte(version + "\x00" + machineID)
+}
+
+func (b *BoltStore) PutGrant(version, machineID string, t time.Time) error {
+	return b.put(grantsBucket, grantKey(version, machineID), t)
+}
+
+func (b *BoltStore) Rollouts() (map[string]*RolloutState, error) {
+	rollouts := make(map[string]*RolloutState)
+	state := func(version string) *RolloutState {
+		s, ok := rollouts[version]
+		if !ok {
+			s = &RolloutState{}
+			rollouts[version] = s
+		}
+		if s.Granted == nil {
+			s.Granted = make(map[string]time.Time)
+		}
+		return s
+	}
+
+	err := b.forEach(rolloutsBucket, func(k, v []byte) error {
+		s := state(string(k))
+		return json.Unmarshal(v, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.forEach(grantsBucket, func(k, v []byte) error {
+		i := bytes.IndexByte(k, 0)
+		if i < 0 {
+			return fmt.Errorf("invalid grant key")
+		}
+		var t time.Time
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		state(string(k[:i])).Granted[string(k[i+1:])] = t
+		return nil
+	})
+	return rollouts, err
+}
+
+func (b *BoltStore) AddRecord(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.enqueue(boltWrite{f: func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(recordsBucket)
+		seq, err := bkt.NextSequence()
+		if err != nil {
+			return err
+		}
+		// big endian keys keep records in order
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bkt.Put(key, data)
+	}})
+}
+
+func (b *BoltStore) Records(limit int) ([]*Record, error) {
+	if err := b.flush(); err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(recordsBucket)
+		if bkt == nil {
+			return nil
+		}
+		// walk back from the newest record
+		c := bkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(records) == limit {
+				break
+			}
+			rec := &Record{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return fmt.Errorf("%s/%q: %v", recordsBucket, k, err)
+			}
+			records = append(records, rec)
+		}
+		return nil
+	})
+
+	// oldest first
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, err
+}
+
+// Close writes any queued changes and closes the database.
+func (b *BoltStore) Close() error {
+	if b.wake != nil {
+		b.mu.Lock()
+		if !b.closed {
+			b.closed = true
+			close(b.wake)
+		}
+		b.mu.Unlock()
+		<-b.stopped
+	}
+	return b.db.Close()
+}
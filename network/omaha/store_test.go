@@ -0,0 +1,169 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newStoredServer builds a recorded, rolled out catalog backed by the
+// bolt database at path.
+func newStoredServer(t *testing.T, c *Catalog, path string) (*RecordingUpdater, *RolloutUpdater, Store) {
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro := NewRolloutUpdater(c)
+	rec := NewRecordingUpdater(ro)
+	if err := UseStore(rec, store); err != nil {
+		store.Close()
+		t.Fatal(err)
+	}
+	return rec, ro, store
+}
+
+func checkStored(t *testing.T, u Updater, machineID, version string) string {
+	req := NewRequest()
+	app := req.AddApp(testAppId, version)
+	app.MachineID = machineID
+	app.Track = "stable"
+	app.Board = "amd64-usr"
+	update, err := u.CheckUpdate(req, app)
+	if err == NoUpdate {
+		return ""
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return update.Version
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "omaha.db")
+
+	rec, ro, store := newStoredServer(t, newTestCatalog(t, dir), path)
+	ro.SetPolicy("1.1.0", RolloutPolicy{Percent: 100, Limit: 1})
+	if v := checkStored(t, rec, "machine1", "1.0.0"); v != "1.1.0" {
+		t.Errorf("machine1 offered %q", v)
+	}
+	if v := checkStored(t, rec, "machine2", "1.0.0"); v != "" {
+		t.Errorf("machine2 offered %q beyond the limit", v)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted server with an empty catalog picks up where it left off
+	rec, ro, store = newStoredServer(t, &Catalog{DefaultTrack: "stable"}, path)
+	if v := checkStored(t, rec, "machine1", "1.0.0"); v != "1.1.0" {
+		t.Errorf("machine1 offered %q after restart", v)
+	}
+	if v := checkStored(t, rec, "machine2", "1.0.0"); v != "" {
+		t.Errorf("machine2 offered %q after restart", v)
+	}
+	if ro.Policy("1.1.0").Limit != 1 || ro.Granted("1.1.0") != 1 {
+		t.Errorf("rollout not restored: %+v, %d granted", ro.Policy("1.1.0"), ro.Granted("1.1.0"))
+	}
+	if n := len(rec.Records("")); n != 4 {
+		t.Errorf("expected 4 records, got %d", n)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ro2, err := OpenBoltStoreReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro2.Close()
+	releases, err := ro2.Releases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 3 {
+		t.Errorf("expected 3 releases, got %d", len(releases))
+	}
+	records, err := ro2.Records(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0].MachineID != "machine1" || records[0].Update != "1.1.0" {
+		t.Errorf("unexpected records %v", records)
+	}
+	last, err := ro2.Records(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 1 || last[0].MachineID != "machine2" {
+		t.Errorf("unexpected last record %v", last)
+	}
+	rollouts, err := ro2.Rollouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rollouts["1.1.0"]; s == nil || s.Policy.Limit != 1 || len(s.Recent) != 1 || !s.Granted["machine1"].Equal(s.Recent[0]) {
+		t.Errorf("unexpected rollout %+v", s)
+	}
+}
+
+func TestRecordingUpdaterMaxRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "omaha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "omaha.db")
+
+	rec, _, store := newStoredServer(t, newTestCatalog(t, dir), path)
+	rec.MaxRecords = 2
+	for _, id := range []string{"machine1", "machine2", "machine3"} {
+		checkStored(t, rec, id, "1.0.0")
+	}
+	if records := rec.Records(""); len(records) != 2 || records[0].MachineID != "machine2" {
+		t.Errorf("unexpected records %v", records)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store keeps everything but only the newest are loaded
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	all, err := store.Records(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("expected 3 stored records, got %d", len(all))
+	}
+	rec = NewRecordingUpdater(&Catalog{})
+	rec.MaxRecords = 2
+	if err := rec.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if records := rec.Records(""); len(records) != 2 || records[1].MachineID != "machine3" {
+		t.Errorf("unexpected loaded records %v", records)
+	}
+}
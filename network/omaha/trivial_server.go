@@ -15,61 +15,83 @@
 package omaha
 
 import (
-	"net/http"
+	"sync"
 )
 
+// trivialUpdater offers a single full update to every client.
 type trivialUpdater struct {
 	UpdaterStub
-	Update
+
+	mu      sync.Mutex
+	update  *Update
+	payload *PayloadHandler
 }
 
 func (tu *trivialUpdater) CheckUpdate(req *Request, app *AppRequest) (*Update, error) {
-	return &tu.Update, nil
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	if tu.update == nil {
+		return nil, NoUpdate
+	}
+	update := *tu.update
+	return &update, nil
 }
 
-type trivialHandler struct {
-	Path string
+// Updates returns the update offered, if any.
+func (tu *trivialUpdater) Updates() []Update {
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	if tu.update == nil {
+		return nil
+	}
+	return []Update{*tu.update}
 }
 
-func (th *trivialHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if th.Path == "" {
-		http.NotFound(w, r)
+// SetPackage offers the update payload at path.
+func (tu *trivialUpdater) SetPackage(path string) error {
+	update := &Update{
+		URL: URL{CodeBase: "/packages/"},
+	}
+
+	pkg, err := update.Manifest.AddPackageFromPath(path)
+	if err != nil {
+		return err
 	}
-	http.ServeFile(w, r, th.Path)
+	pkg.Name = "update.gz"
+	act := update.Manifest.AddAction("postinstall")
+	act.DisablePayloadBackoff = true
+	act.Sha256 = pkg.Sha256
+
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	tu.update = update
+	tu.payload.SetPath(path)
+	return nil
 }
 
+// TrivialServer is a Server offering a single update payload.
 type TrivialServer struct {
 	*Server
-	th trivialHandler
+
+	// Payload serves the update payload, faults may be injected.
+	Payload *PayloadHandler
+
+	tu *trivialUpdater
 }
 
 func NewTrivialServer(addr string) (*TrivialServer, error) {
-	s, err := NewServer(addr, &UpdaterStub{})
+	tu := &trivialUpdater{payload: &PayloadHandler{}}
+	s, err := NewServer(addr, tu)
 	if err != nil {
 		return nil, err
 	}
-	ts := TrivialServer{Server: s}
-	ts.Mux.Handle("/packages/update.gz", &ts.th)
+	ts := TrivialServer{Server: s, Payload: tu.payload, tu: tu}
+	ts.Mux.Handle("/packages/update.gz", ts.Payload)
 	return &ts, nil
 }
 
+// SetPackage serves the update payload at path to all clients. If the
+// server's Updater has been replaced it is not affected.
 func (ts *TrivialServer) SetPackage(path string) error {
-	tu := trivialUpdater{
-		Update: Update{
-			URL: URL{CodeBase: "/packages/"},
-		},
-	}
-
-	pkg, err := tu.Manifest.AddPackageFromPath(path)
-	if err != nil {
-		return err
-	}
-	pkg.Name = "update.gz"
-	act := tu.Manifest.AddAction("postinstall")
-	act.DisablePayloadBackoff = true
-	act.Sha256 = pkg.Sha256
-
-	ts.th.Path = path
-	ts.Updater = &tu
-	return nil
+	return ts.tu.SetPackage(path)
 }
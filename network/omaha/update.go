@@ -71,3 +71,29 @@ func (u UpdaterStub) Event(req *Request, app *AppRequest, event *EventRequest) {
 func (u UpdaterStub) Ping(req *Request, app *AppRequest) {
 	return
 }
+
+// Wrapper is implemented by Updaters that add to the behavior of another
+// Updater, so features of the wrapped Updater such as persistent storage
+// or rollout controls can still be found.
+type Wrapper interface {
+	Unwrap() Updater
+}
+
+// unwrapUpdater returns the Updater wrapped by u, or nil.
+func unwrapUpdater(u Updater) Updater {
+	if w, ok := u.(Wrapper); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
+// findUpdater looks for an Updater implementing the interface tested by
+// match, unwrapping any Wrappers.
+func findUpdater(u Updater, match func(Updater) bool) Updater {
+	for ; u != nil; u = unwrapUpdater(u) {
+		if match(u) {
+			return u
+		}
+	}
+	return nil
+}
@@ -40,3 +40,33 @@ func TestUpdateURLs(t *testing.T) {
 		t.Error("Unexpected URL", urls[0].CodeBase)
 	}
 }
+
+// customWrapper is a Wrapper from outside this package.
+type customWrapper struct {
+	Updater
+}
+
+func (w customWrapper) Unwrap() Updater {
+	return w.Updater
+}
+
+func TestFindUpdater(t *testing.T) {
+	ro := NewRolloutUpdater(UpdaterStub{})
+	u := NewRecordingUpdater(customWrapper{ro})
+
+	found := findUpdater(u, func(u Updater) bool {
+		_, ok := u.(*RolloutUpdater)
+		return ok
+	})
+	if found != ro {
+		t.Errorf("found %#v wanted the rollout updater", found)
+	}
+
+	found = findUpdater(u, func(u Updater) bool {
+		_, ok := u.(*MirrorUpdater)
+		return ok
+	})
+	if found != nil {
+		t.Errorf("found %#v wanted nothing", found)
+	}
+}
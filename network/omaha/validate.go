@@ -0,0 +1,114 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"regexp"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// App ids are GUIDs in braces.
+var appIdRegexp = regexp.MustCompile(`^\{[[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12}\}$`)
+
+func validEventType(t EventType) bool {
+	switch t {
+	case EventTypeUnknown,
+		EventTypeDownloadComplete,
+		EventTypeInstallComplete,
+		EventTypeUpdateComplete,
+		EventTypeUninstall,
+		EventTypeDownloadStarted,
+		EventTypeInstallStarted,
+		EventTypeNewApplicationInstallStarted,
+		EventTypeSetupStarted,
+		EventTypeSetupFinished,
+		EventTypeUpdateApplicationStarted,
+		EventTypeUpdateDownloadStarted,
+		EventTypeUpdateDownloadFinished,
+		EventTypeUpdateInstallerStarted,
+		EventTypeSetupUpdateBegin,
+		EventTypeSetupUpdateComplete,
+		EventTypeRegisterProductComplete,
+		EventTypeOEMInstallFirstCheck,
+		EventTypeAppSpecificCommandStarted,
+		EventTypeAppSpecificCommandEnded,
+		EventTypeSetupFailure,
+		EventTypeComServerFailure,
+		EventTypeSetupUpdateFailure:
+		return true
+	}
+	return false
+}
+
+func validEventResult(r EventResult) bool {
+	return r >= EventResultError && r <= EventResultHandoffError
+}
+
+func validVersion(v string) bool {
+	_, err := semver.NewVersion(v)
+	return err == nil
+}
+
+// ValidateApp checks an app request in detail, returning the AppStatus
+// describing the first problem found:
+//
+//	AppInvalidId       missing or malformed app id
+//	AppInvalidVersion  version or event versions that are not semver
+//	AppInvalidEvent    unknown event types or results
+//	AppInvalidRequest  nothing requested or negative ping counts
+func ValidateApp(app *AppRequest) error {
+	if !appIdRegexp.MatchString(app.Id) {
+		return AppInvalidId
+	}
+	if !validVersion(app.Version) {
+		return AppInvalidVersion
+	}
+	if app.NextVersion != "" && !validVersion(app.NextVersion) {
+		return AppInvalidVersion
+	}
+
+	if app.Ping == nil && app.UpdateCheck == nil && len(app.Events) == 0 {
+		return AppInvalidRequest
+	}
+	if p := app.Ping; p != nil {
+		if p.Active < 0 || p.LastActiveReportDays < -1 || p.LastReportDays < -1 {
+			return AppInvalidRequest
+		}
+	}
+
+	for _, event := range app.Events {
+		if !validEventType(event.Type) || !validEventResult(event.Result) {
+			return AppInvalidEvent
+		}
+		if event.NextVersion != "" && !validVersion(event.NextVersion) {
+			return AppInvalidVersion
+		}
+		if event.PreviousVersion != "" && !validVersion(event.PreviousVersion) {
+			return AppInvalidVersion
+		}
+	}
+
+	return nil
+}
+
+// ValidateUpdateCheck checks the parts of a request only needed to
+// answer an update check, returning the UpdateStatus for the problem.
+func ValidateUpdateCheck(req *Request, app *AppRequest) error {
+	if req.OS == nil || req.OS.Platform == "" {
+		return UpdateOSNotSupported
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package omaha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateApp(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(app *AppRequest)
+		status error
+	}{
+		{"valid", func(app *AppRequest) {}, nil},
+		{"missing appid", func(app *AppRequest) { app.Id = "" }, AppInvalidId},
+		{"malformed appid", func(app *AppRequest) { app.Id = "coreos" }, AppInvalidId},
+		{"missing version", func(app *AppRequest) { app.Version = "" }, AppInvalidVersion},
+		{"bad version", func(app *AppRequest) { app.Version = "1.0" }, AppInvalidVersion},
+		{"bad next version", func(app *AppRequest) { app.NextVersion = "next" }, AppInvalidVersion},
+		{"empty", func(app *AppRequest) { app.UpdateCheck = nil }, AppInvalidRequest},
+		{"bad ping", func(app *AppRequest) { app.AddPing().LastReportDays = -2 }, AppInvalidRequest},
+		{"unknown event type", func(app *AppRequest) { app.AddEvent().Type = 7 }, AppInvalidEvent},
+		{"unknown event result", func(app *AppRequest) { app.AddEvent().Result = 11 }, AppInvalidEvent},
+		{"bad event version", func(app *AppRequest) { app.AddEvent().PreviousVersion = "x" }, AppInvalidVersion},
+	} {
+		app := &AppRequest{Id: testAppId, Version: testAppVer}
+		app.AddUpdateCheck()
+		tt.modify(app)
+		if err := ValidateApp(app); err != tt.status {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.status, err)
+		}
+	}
+}
+
+func postStrict(t *testing.T, body string) (int, *Response) {
+	handler := &OmahaHandler{Updater: UpdaterStub{}, Strict: true}
+	httpReq, err := http.NewRequest("POST", "/v1/update/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &fuzzWriter{header: make(http.Header)}
+	rec := &statusWriter{fuzzWriter: w}
+	handler.ServeHTTP(rec, httpReq)
+	if w.header.Get("Content-Type") != "text/xml; charset=utf-8" {
+		return rec.status, nil
+	}
+	resp := &Response{}
+	if err := xml.Unmarshal(w.body.Bytes(), resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return rec.status, resp
+}
+
+type statusWriter struct {
+	*fuzzWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func TestStrictHandler(t *testing.T) {
+	req := NewRequest()
+	req.AddApp(testAppId, testAppVer).AddUpdateCheck()
+	req.AddApp(testAppId, testAppVer).AddPing()
+	req.AddApp("{00000000-0000-0000-0000-000000000000}", "bad").AddPing()
+	var buf bytes.Buffer
+	if err := xml.NewEncoder(&buf).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp := postStrict(t, buf.String())
+	if status != http.StatusOK || resp == nil || len(resp.Apps) != 3 {
+		t.Fatalf("unexpected response %d %#v", status, resp)
+	}
+	if resp.Apps[0].Status != AppOK || resp.Apps[0].UpdateCheck.Status != NoUpdate {
+		t.Errorf("unexpected response to valid app: %#v", resp.Apps[0])
+	}
+	if resp.Apps[1].Status != AppInvalidId {
+		t.Errorf("duplicate app not rejected: %#v", resp.Apps[1])
+	}
+	if resp.Apps[2].Status != AppInvalidVersion {
+		t.Errorf("bad version not rejected: %#v", resp.Apps[2])
+	}
+
+	// update checks require the OS
+	req.OS = nil
+	req.Apps = req.Apps[:1]
+	buf.Reset()
+	if err := xml.NewEncoder(&buf).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp := postStrict(t, buf.String()); resp == nil || resp.Apps[0].UpdateCheck.Status != UpdateOSNotSupported {
+		t.Errorf("missing OS not rejected: %#v", resp)
+	}
+
+	// trailing junk
+	if status, _ := postStrict(t, buf.String()+"<request/>"); status != http.StatusBadRequest {
+		t.Errorf("trailing element not rejected: %d", status)
+	}
+	if status, resp := postStrict(t, buf.String()+"\n<!-- end -->\n"); status != http.StatusOK || resp == nil {
+		t.Errorf("trailing comment rejected: %d", status)
+	}
+}
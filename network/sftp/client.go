@@ -0,0 +1,613 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sftp implements the parts of version 3 of the SSH File Transfer
+// Protocol needed to copy files and directory trees to and from machines.
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// chunkSize is the amount of data requested or sent in one packet.
+const chunkSize = 32 * 1024
+
+// maxInflight is the number of reads or writes of a file that may be
+// waiting for a response at once. Keeping several requests in flight
+// avoids waiting a round trip for every chunk.
+const maxInflight = 16
+
+// Client is an SFTP client. It may be shared, each request holds the
+// connection until it is answered so transfers will not overlap.
+type Client struct {
+	mu      sync.Mutex
+	r       io.Reader
+	w       io.WriteCloser
+	id      uint32
+	session *ssh.Session
+
+	// responses which arrived while waiting for another request, and
+	// requests whose responses will be ignored
+	responses map[uint32]response
+	abandoned map[uint32]bool
+}
+
+// response is a received packet, the reader is positioned after the id.
+type response struct {
+	t byte
+	r *reader
+}
+
+// NewClient starts the sftp subsystem in a new session on client.
+func NewClient(client *ssh.Client) (*Client, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	c, err := NewClientPipe(r, w)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	c.session = session
+	return c, nil
+}
+
+// NewClientPipe speaks SFTP over r and w, such as the standard output and
+// input of an sftp-server process.
+func NewClientPipe(r io.Reader, w io.WriteCloser) (*Client, error) {
+	c := &Client{
+		r:         r,
+		w:         w,
+		responses: make(map[uint32]response),
+		abandoned: make(map[uint32]bool),
+	}
+
+	init := buffer{fxpInit}
+	init.uint32(protocolVersion)
+	if err := writePacket(w, init); err != nil {
+		return nil, err
+	}
+	p, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	resp := &reader{buf: p}
+	if t := resp.byte(); t != fxpVersion {
+		return nil, fmt.Errorf("sftp: unexpected packet type %d, expected version", t)
+	}
+	if v := resp.uint32(); resp.err != nil || v != protocolVersion {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", v)
+	}
+	return c, nil
+}
+
+// Close ends the SFTP session.
+func (c *Client) Close() error {
+	err := c.w.Close()
+	if c.session != nil {
+		c.session.Close()
+	}
+	return err
+}
+
+// request sends a packet built by fill and returns the type and contents
+// of the response.
+func (c *Client) request(t byte, fill func(b *buffer)) (byte, *reader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.send(t, fill)
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.wait(id)
+}
+
+// send writes a request without waiting for the response, returning its
+// id. It must be called with c.mu held.
+func (c *Client) send(t byte, fill func(b *buffer)) (uint32, error) {
+	c.id++
+	b := buffer{t}
+	b.uint32(c.id)
+	fill(&b)
+	return c.id, writePacket(c.w, b)
+}
+
+// wait returns the type and contents of the response to request id,
+// keeping any responses to other requests received in the meantime. It
+// must be called with c.mu held.
+func (c *Client) wait(id uint32) (byte, *reader, error) {
+	for {
+		if resp, ok := c.responses[id]; ok {
+			delete(c.responses, id)
+			return resp.t, resp.r, nil
+		}
+
+		p, err := readPacket(c.r)
+		if err != nil {
+			return 0, nil, err
+		}
+		r := &reader{buf: p}
+		t := r.byte()
+		rid := r.uint32()
+		if r.err != nil || rid > c.id {
+			return 0, nil, fmt.Errorf("sftp: response to unknown request %d", rid)
+		}
+		if c.abandoned[rid] {
+			delete(c.abandoned, rid)
+			continue
+		}
+		c.responses[rid] = response{t, r}
+	}
+}
+
+// abandon discards the response to request id. It must be called with
+// c.mu held.
+func (c *Client) abandon(id uint32) {
+	if _, ok := c.responses[id]; ok {
+		delete(c.responses, id)
+	} else {
+		c.abandoned[id] = true
+	}
+}
+
+// status interprets a response that should be a status packet.
+func status(op, p string, t byte, resp *reader) error {
+	if t != fxpStatus {
+		return fmt.Errorf("sftp: unexpected packet type %d for %s", t, op)
+	}
+	code := resp.uint32()
+	msg := resp.string()
+	if resp.err != nil {
+		return resp.err
+	}
+	return statusToError(op, p, code, msg)
+}
+
+// pathRequest sends a request with a single path argument.
+func (c *Client) pathRequest(t byte, p string) (byte, *reader, error) {
+	return c.request(t, func(b *buffer) {
+		b.string(p)
+	})
+}
+
+// handle interprets a response that should be a handle.
+func handle(op, p string, t byte, resp *reader) (string, error) {
+	if t != fxpHandle {
+		return "", status(op, p, t, resp)
+	}
+	h := resp.string()
+	return h, resp.err
+}
+
+func (c *Client) stat(op string, t byte, p string) (os.FileInfo, error) {
+	rt, resp, err := c.pathRequest(t, p)
+	if err != nil {
+		return nil, err
+	}
+	if rt != fxpAttrs {
+		return nil, status(op, p, rt, resp)
+	}
+	a := resp.attrs()
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return &fileInfo{name: path.Base(p), attrs: a}, nil
+}
+
+// Stat returns information about a file, following symbolic links.
+func (c *Client) Stat(p string) (os.FileInfo, error) {
+	return c.stat("stat", fxpStat, p)
+}
+
+// Lstat returns information about a file without following symbolic links.
+func (c *Client) Lstat(p string) (os.FileInfo, error) {
+	return c.stat("lstat", fxpLstat, p)
+}
+
+// ReadDir lists a directory sorted by name.
+func (c *Client) ReadDir(dir string) ([]os.FileInfo, error) {
+	t, resp, err := c.pathRequest(fxpOpendir, dir)
+	if err != nil {
+		return nil, err
+	}
+	h, err := handle("opendir", dir, t, resp)
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(h)
+
+	var infos []os.FileInfo
+	for {
+		t, resp, err := c.request(fxpReaddir, func(b *buffer) {
+			b.string(h)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if t != fxpName {
+			err := status("readdir", dir, t, resp)
+			if err == io.EOF {
+				break
+			} else if err == nil {
+				err = fmt.Errorf("sftp: readdir %s: unexpected success", dir)
+			}
+			return nil, err
+		}
+		for n := resp.uint32(); n > 0 && resp.err == nil; n-- {
+			name := resp.string()
+			resp.string() // long name
+			a := resp.attrs()
+			if name != "." && name != ".." {
+				infos = append(infos, &fileInfo{name: name, attrs: a})
+			}
+		}
+		if resp.err != nil {
+			return nil, resp.err
+		}
+	}
+
+	sort.Sort(byName(infos))
+	return infos, nil
+}
+
+type byName []os.FileInfo
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Mkdir creates a directory.
+func (c *Client) Mkdir(p string, perm os.FileMode) error {
+	t, resp, err := c.request(fxpMkdir, func(b *buffer) {
+		b.string(p)
+		b.attrs(&attrs{flags: attrPermissions, perm: uint32(perm.Perm())})
+	})
+	if err != nil {
+		return err
+	}
+	return status("mkdir", p, t, resp)
+}
+
+// MkdirAll creates a directory and any missing parents.
+func (c *Client) MkdirAll(p string, perm os.FileMode) error {
+	if fi, err := c.Stat(p); err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: p, Err: fmt.Errorf("not a directory")}
+		}
+		return nil
+	}
+
+	if parent := path.Dir(p); parent != p {
+		if err := c.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mkdir(p, perm); err != nil {
+		// tolerate a directory appearing in the meantime
+		if fi, err2 := c.Stat(p); err2 == nil && fi.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) setstat(op, p string, a *attrs) error {
+	t, resp, err := c.request(fxpSetstat, func(b *buffer) {
+		b.string(p)
+		b.attrs(a)
+	})
+	if err != nil {
+		return err
+	}
+	return status(op, p, t, resp)
+}
+
+// Chmod changes the mode of a file.
+func (c *Client) Chmod(p string, mode os.FileMode) error {
+	return c.setstat("chmod", p, &attrs{
+		flags: attrPermissions,
+		perm:  fileModeToPerm(mode) &^ modeTypeMask,
+	})
+}
+
+// Chown changes the owner of a file.
+func (c *Client) Chown(p string, uid, gid int) error {
+	return c.setstat("chown", p, &attrs{
+		flags: attrUIDGID,
+		uid:   uint32(uid),
+		gid:   uint32(gid),
+	})
+}
+
+// Remove deletes a file or empty directory.
+func (c *Client) Remove(p string) error {
+	t, resp, err := c.pathRequest(fxpRemove, p)
+	if err != nil {
+		return err
+	}
+	err = status("remove", p, t, resp)
+	if err == nil {
+		return nil
+	}
+
+	if fi, err2 := c.Lstat(p); err2 == nil && fi.IsDir() {
+		t, resp, err = c.pathRequest(fxpRmdir, p)
+		if err != nil {
+			return err
+		}
+		return status("remove", p, t, resp)
+	}
+	return err
+}
+
+// Open opens a file for reading.
+func (c *Client) Open(p string) (*File, error) {
+	return c.open(p, fxfRead, nil)
+}
+
+// Create creates or truncates a file for writing. The permissions only
+// apply to new files.
+func (c *Client) Create(p string, perm os.FileMode) (*File, error) {
+	return c.open(p, fxfWrite|fxfCreat|fxfTrunc, &attrs{
+		flags: attrPermissions,
+		perm:  uint32(perm.Perm()),
+	})
+}
+
+func (c *Client) open(p string, flags uint32, a *attrs) (*File, error) {
+	if a == nil {
+		a = &attrs{}
+	}
+	t, resp, err := c.request(fxpOpen, func(b *buffer) {
+		b.string(p)
+		b.uint32(flags)
+		b.attrs(a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	h, err := handle("open", p, t, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &File{c: c, path: p, handle: h}, nil
+}
+
+func (c *Client) closeHandle(h string) error {
+	t, resp, err := c.request(fxpClose, func(b *buffer) {
+		b.string(h)
+	})
+	if err != nil {
+		return err
+	}
+	return status("close", "", t, resp)
+}
+
+// File is an open remote file. Reads are done ahead and writes are
+// sent without waiting for each to be acknowledged, so an error writing
+// may be returned by a later call to Write or Close.
+type File struct {
+	c      *Client
+	path   string
+	handle string
+	offset uint64
+
+	reads      []readRequest // read ahead, in order of offset
+	readOffset uint64        // offset of the next read ahead request
+	buf        []byte        // data read but not yet returned
+
+	writes []uint32 // writes waiting for a status, oldest first
+}
+
+type readRequest struct {
+	id     uint32
+	offset uint64
+}
+
+// Read reads up to len(b) bytes from the file.
+func (f *File) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if len(f.buf) == 0 {
+		if err := f.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, f.buf)
+	f.buf = f.buf[n:]
+	f.offset += uint64(n)
+	return n, nil
+}
+
+// readChunk fills f.buf with the next chunk, topping up the requests
+// read ahead.
+func (f *File) readChunk() error {
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+
+	if len(f.reads) == 0 {
+		f.readOffset = f.offset
+	}
+	for len(f.reads) < maxInflight {
+		offset := f.readOffset
+		id, err := f.c.send(fxpRead, func(pb *buffer) {
+			pb.string(f.handle)
+			pb.uint64(offset)
+			pb.uint32(chunkSize)
+		})
+		if err != nil {
+			return err
+		}
+		f.reads = append(f.reads, readRequest{id, offset})
+		f.readOffset += chunkSize
+	}
+
+	req := f.reads[0]
+	f.reads = f.reads[1:]
+	t, resp, err := f.c.wait(req.id)
+	if err != nil {
+		return err
+	}
+	if t != fxpData {
+		// the requests after the end of the file or an error are moot
+		f.dropReads()
+		err := status("read", f.path, t, resp)
+		if err == nil {
+			err = fmt.Errorf("sftp: read %s: unexpected success", f.path)
+		}
+		return err
+	}
+	data := resp.bytes()
+	if resp.err != nil {
+		return resp.err
+	}
+	if len(data) < chunkSize {
+		// the requests after a short read are at the wrong offsets
+		f.dropReads()
+	}
+	f.buf = data
+	return nil
+}
+
+// dropReads abandons the requests read ahead. It must be called with
+// f.c.mu held.
+func (f *File) dropReads() {
+	for _, req := range f.reads {
+		f.c.abandon(req.id)
+	}
+	f.reads = nil
+}
+
+// Write writes b to the file.
+func (f *File) Write(b []byte) (int, error) {
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		if len(f.writes) >= maxInflight {
+			if err := f.waitWrite(); err != nil {
+				return written, err
+			}
+		}
+
+		chunk := b
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		offset := f.offset
+		id, err := f.c.send(fxpWrite, func(pb *buffer) {
+			pb.string(f.handle)
+			pb.uint64(offset)
+			pb.bytes(chunk)
+		})
+		if err != nil {
+			return written, err
+		}
+		f.writes = append(f.writes, id)
+		f.offset += uint64(len(chunk))
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// waitWrite checks the status of the oldest write. After an error the
+// remaining writes are abandoned. It must be called with f.c.mu held.
+func (f *File) waitWrite() error {
+	id := f.writes[0]
+	f.writes = f.writes[1:]
+	t, resp, err := f.c.wait(id)
+	if err == nil {
+		err = status("write", f.path, t, resp)
+	}
+	if err != nil {
+		for _, id := range f.writes {
+			f.c.abandon(id)
+		}
+		f.writes = nil
+	}
+	return err
+}
+
+// flush waits for all writes to be acknowledged and abandons any reads.
+func (f *File) flush() error {
+	f.c.mu.Lock()
+	defer f.c.mu.Unlock()
+
+	f.dropReads()
+	for len(f.writes) > 0 {
+		if err := f.waitWrite(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stat returns information about the open file.
+func (f *File) Stat() (os.FileInfo, error) {
+	if err := f.flush(); err != nil {
+		return nil, err
+	}
+	t, resp, err := f.c.request(fxpFstat, func(b *buffer) {
+		b.string(f.handle)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t != fxpAttrs {
+		return nil, status("stat", f.path, t, resp)
+	}
+	a := resp.attrs()
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return &fileInfo{name: path.Base(f.path), attrs: a}, nil
+}
+
+// Close closes the file, reporting any failed writes.
+func (f *File) Close() error {
+	err := f.flush()
+	if err2 := f.c.closeHandle(f.handle); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,399 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Version 3 of the protocol, the one implemented by OpenSSH.
+const protocolVersion = 3
+
+// maxPacket is the largest packet accepted, servers must support at least
+// 34000 bytes.
+const maxPacket = 256 * 1024
+
+// Packet types.
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+// Flags for fxpOpen.
+const (
+	fxfRead   = 0x01
+	fxfWrite  = 0x02
+	fxfAppend = 0x04
+	fxfCreat  = 0x08
+	fxfTrunc  = 0x10
+	fxfExcl   = 0x20
+)
+
+// Status codes.
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Flags marking which attributes are present.
+const (
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+)
+
+// Unix file type bits used in the permissions attribute.
+const (
+	modeTypeMask = 0170000
+	modeFIFO     = 0010000
+	modeChar     = 0020000
+	modeDir      = 0040000
+	modeBlock    = 0060000
+	modeRegular  = 0100000
+	modeSymlink  = 0120000
+	modeSocket   = 0140000
+	modeSetuid   = 04000
+	modeSetgid   = 02000
+	modeSticky   = 01000
+)
+
+var errShortPacket = errors.New("sftp: short packet")
+
+// StatusError is a failure reported by the server.
+type StatusError struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *StatusError) Error() string {
+	if e.Msg != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", e.Msg, e.Code)
+	}
+	return fmt.Sprintf("sftp: status %d", e.Code)
+}
+
+// statusToError converts the common status codes to their os package
+// equivalents so os.IsNotExist and os.IsPermission work.
+func statusToError(op, path string, code uint32, msg string) error {
+	switch code {
+	case fxOK:
+		return nil
+	case fxEOF:
+		return io.EOF
+	case fxNoSuchFile:
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	case fxPermissionDenied:
+		return &os.PathError{Op: op, Path: path, Err: os.ErrPermission}
+	default:
+		return &os.PathError{Op: op, Path: path, Err: &StatusError{Code: code, Msg: msg}}
+	}
+}
+
+// errorToStatus is the reverse of statusToError, used by the server.
+func errorToStatus(err error) (uint32, string) {
+	switch {
+	case err == nil:
+		return fxOK, ""
+	case err == io.EOF:
+		return fxEOF, "EOF"
+	case os.IsNotExist(err):
+		return fxNoSuchFile, "No such file"
+	case os.IsPermission(err):
+		return fxPermissionDenied, "Permission denied"
+	default:
+		return fxFailure, err.Error()
+	}
+}
+
+// buffer builds a packet.
+type buffer []byte
+
+func (b *buffer) byte(v byte) {
+	*b = append(*b, v)
+}
+
+func (b *buffer) uint32(v uint32) {
+	*b = append(*b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *buffer) uint64(v uint64) {
+	b.uint32(uint32(v >> 32))
+	b.uint32(uint32(v))
+}
+
+func (b *buffer) string(s string) {
+	b.uint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *buffer) bytes(s []byte) {
+	b.uint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *buffer) attrs(a *attrs) {
+	b.uint32(a.flags)
+	if a.flags&attrSize != 0 {
+		b.uint64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		b.uint32(a.uid)
+		b.uint32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		b.uint32(a.perm)
+	}
+	if a.flags&attrACModTime != 0 {
+		b.uint32(a.atime)
+		b.uint32(a.mtime)
+	}
+}
+
+// reader parses a packet, the first error sticks.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil || len(r.buf) < 1 {
+		r.err = errShortPacket
+		return 0
+	}
+	v := r.buf[0]
+	r.buf = r.buf[1:]
+	return v
+}
+
+func (r *reader) uint32() uint32 {
+	if r.err != nil || len(r.buf) < 4 {
+		r.err = errShortPacket
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *reader) uint64() uint64 {
+	hi := r.uint32()
+	lo := r.uint32()
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.buf)) < n {
+		r.err = errShortPacket
+		return nil
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+func (r *reader) attrs() *attrs {
+	a := &attrs{flags: r.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = r.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid = r.uint32()
+		a.gid = r.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.perm = r.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime = r.uint32()
+		a.mtime = r.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	return a
+}
+
+// writePacket frames and sends a packet.
+func writePacket(w io.Writer, b buffer) error {
+	frame := make(buffer, 0, len(b)+4)
+	frame.bytes(b)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readPacket receives one framed packet.
+func readPacket(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > maxPacket {
+		return nil, fmt.Errorf("sftp: invalid packet length %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// attrs are the file attributes sent over the wire.
+type attrs struct {
+	flags uint32
+	size  uint64
+	uid   uint32
+	gid   uint32
+	perm  uint32
+	atime uint32
+	mtime uint32
+}
+
+// fileModeToPerm converts to the unix permission bits used on the wire.
+func fileModeToPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		perm |= modeDir
+	case mode&os.ModeSymlink != 0:
+		perm |= modeSymlink
+	case mode.IsRegular():
+		perm |= modeRegular
+	}
+	if mode&os.ModeSetuid != 0 {
+		perm |= modeSetuid
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= modeSetgid
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= modeSticky
+	}
+	return perm
+}
+
+// permToFileMode converts unix permission bits from the wire.
+func permToFileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0777)
+	switch perm & modeTypeMask {
+	case modeDir:
+		mode |= os.ModeDir
+	case modeSymlink:
+		mode |= os.ModeSymlink
+	case modeFIFO:
+		mode |= os.ModeNamedPipe
+	case modeChar:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case modeBlock:
+		mode |= os.ModeDevice
+	case modeSocket:
+		mode |= os.ModeSocket
+	}
+	if perm&modeSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&modeSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&modeSticky != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+func fileInfoToAttrs(fi os.FileInfo) *attrs {
+	a := &attrs{
+		flags: attrSize | attrPermissions | attrACModTime,
+		size:  uint64(fi.Size()),
+		perm:  fileModeToPerm(fi.Mode()),
+		atime: uint32(fi.ModTime().Unix()),
+		mtime: uint32(fi.ModTime().Unix()),
+	}
+	if o, ok := fi.Sys().(*Owner); ok {
+		a.flags |= attrUIDGID
+		a.uid = o.UID
+		a.gid = o.GID
+	}
+	return a
+}
+
+// Owner is the Sys() value of a FileInfo returned by Client, if the
+// server included the file's owner.
+type Owner struct {
+	UID uint32
+	GID uint32
+}
+
+// fileInfo implements os.FileInfo for attributes from the server.
+type fileInfo struct {
+	name  string
+	attrs *attrs
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return int64(fi.attrs.size) }
+func (fi *fileInfo) Mode() os.FileMode  { return permToFileMode(fi.attrs.perm) }
+func (fi *fileInfo) ModTime() time.Time { return time.Unix(int64(fi.attrs.mtime), 0) }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+
+func (fi *fileInfo) Sys() interface{} {
+	if fi.attrs.flags&attrUIDGID == 0 {
+		return nil
+	}
+	return &Owner{UID: fi.attrs.uid, GID: fi.attrs.gid}
+}
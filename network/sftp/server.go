@@ -0,0 +1,309 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+)
+
+// FileSystem is the storage used by Serve. Errors satisfying
+// os.IsNotExist or os.IsPermission are reported to the client as such.
+type FileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Mkdir(name string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Remove(name string) error
+}
+
+// serverHandle is an open file or directory. Files are read into memory
+// when opened and written back when closed.
+type serverHandle struct {
+	path    string
+	data    []byte
+	perm    os.FileMode
+	write   bool
+	entries []os.FileInfo // nil for files
+	listed  bool
+}
+
+type server struct {
+	fs      FileSystem
+	w       io.Writer
+	handles map[string]*serverHandle
+	next    int
+}
+
+// Serve answers SFTP requests read from rw until it is closed. It is a
+// simple server intended for tests, files are buffered in memory.
+func Serve(rw io.ReadWriter, fs FileSystem) error {
+	s := &server{
+		fs:      fs,
+		w:       rw,
+		handles: make(map[string]*serverHandle),
+	}
+
+	p, err := readPacket(rw)
+	if err != nil {
+		return err
+	}
+	if p[0] != fxpInit {
+		return fmt.Errorf("sftp: expected init, got packet type %d", p[0])
+	}
+	version := buffer{fxpVersion}
+	version.uint32(protocolVersion)
+	if err := writePacket(rw, version); err != nil {
+		return err
+	}
+
+	for {
+		p, err := readPacket(rw)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.handle(&reader{buf: p}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) sendStatus(id uint32, err error) error {
+	code, msg := errorToStatus(err)
+	b := buffer{fxpStatus}
+	b.uint32(id)
+	b.uint32(code)
+	b.string(msg)
+	b.string("")
+	return writePacket(s.w, b)
+}
+
+func (s *server) sendAttrs(id uint32, fi os.FileInfo) error {
+	b := buffer{fxpAttrs}
+	b.uint32(id)
+	b.attrs(fileInfoToAttrs(fi))
+	return writePacket(s.w, b)
+}
+
+func (s *server) sendHandle(id uint32, h *serverHandle) error {
+	s.next++
+	name := strconv.Itoa(s.next)
+	s.handles[name] = h
+	b := buffer{fxpHandle}
+	b.uint32(id)
+	b.string(name)
+	return writePacket(s.w, b)
+}
+
+func (s *server) handle(req *reader) error {
+	t := req.byte()
+	id := req.uint32()
+	if req.err != nil {
+		return req.err
+	}
+
+	switch t {
+	case fxpOpen:
+		p := req.string()
+		flags := req.uint32()
+		a := req.attrs()
+		if req.err != nil {
+			return req.err
+		}
+		return s.open(id, p, flags, a)
+
+	case fxpClose:
+		name := req.string()
+		h, ok := s.handles[name]
+		if !ok {
+			return s.sendStatus(id, fmt.Errorf("invalid handle"))
+		}
+		delete(s.handles, name)
+		var err error
+		if h.write {
+			err = s.fs.WriteFile(h.path, h.data, h.perm)
+		}
+		return s.sendStatus(id, err)
+
+	case fxpRead:
+		h, ok := s.handles[req.string()]
+		offset := req.uint64()
+		size := req.uint32()
+		if !ok || h.entries != nil {
+			return s.sendStatus(id, fmt.Errorf("invalid handle"))
+		}
+		if offset >= uint64(len(h.data)) {
+			return s.sendStatus(id, io.EOF)
+		}
+		end := offset + uint64(size)
+		if end > uint64(len(h.data)) {
+			end = uint64(len(h.data))
+		}
+		b := buffer{fxpData}
+		b.uint32(id)
+		b.bytes(h.data[offset:end])
+		return writePacket(s.w, b)
+
+	case fxpWrite:
+		h, ok := s.handles[req.string()]
+		offset := req.uint64()
+		data := req.bytes()
+		if req.err != nil {
+			return req.err
+		}
+		if !ok || !h.write {
+			return s.sendStatus(id, fmt.Errorf("invalid handle"))
+		}
+		if end := offset + uint64(len(data)); end > uint64(len(h.data)) {
+			h.data = append(h.data, make([]byte, end-uint64(len(h.data)))...)
+		}
+		copy(h.data[offset:], data)
+		return s.sendStatus(id, nil)
+
+	case fxpStat, fxpLstat:
+		fi, err := s.fs.Stat(req.string())
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.sendAttrs(id, fi)
+
+	case fxpFstat:
+		h, ok := s.handles[req.string()]
+		if !ok {
+			return s.sendStatus(id, fmt.Errorf("invalid handle"))
+		}
+		fi, err := s.fs.Stat(h.path)
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.sendAttrs(id, fi)
+
+	case fxpSetstat:
+		p := req.string()
+		a := req.attrs()
+		if req.err != nil {
+			return req.err
+		}
+		var err error
+		if a.flags&attrPermissions != 0 {
+			err = s.fs.Chmod(p, permToFileMode(a.perm))
+		} else {
+			_, err = s.fs.Stat(p)
+		}
+		return s.sendStatus(id, err)
+
+	case fxpOpendir:
+		p := req.string()
+		entries, err := s.fs.ReadDir(p)
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		if entries == nil {
+			entries = []os.FileInfo{}
+		}
+		return s.sendHandle(id, &serverHandle{path: p, entries: entries})
+
+	case fxpReaddir:
+		h, ok := s.handles[req.string()]
+		if !ok || h.entries == nil {
+			return s.sendStatus(id, fmt.Errorf("invalid handle"))
+		}
+		if h.listed {
+			return s.sendStatus(id, io.EOF)
+		}
+		h.listed = true
+		b := buffer{fxpName}
+		b.uint32(id)
+		b.uint32(uint32(len(h.entries)))
+		for _, fi := range h.entries {
+			b.string(fi.Name())
+			b.string(fmt.Sprintf("%v %d %s", fi.Mode(), fi.Size(), fi.Name()))
+			b.attrs(fileInfoToAttrs(fi))
+		}
+		return writePacket(s.w, b)
+
+	case fxpRemove, fxpRmdir:
+		return s.sendStatus(id, s.fs.Remove(req.string()))
+
+	case fxpMkdir:
+		p := req.string()
+		a := req.attrs()
+		if req.err != nil {
+			return req.err
+		}
+		perm := os.FileMode(0755)
+		if a.flags&attrPermissions != 0 {
+			perm = permToFileMode(a.perm).Perm()
+		}
+		return s.sendStatus(id, s.fs.Mkdir(p, perm))
+
+	case fxpRealpath:
+		p := path.Clean(req.string())
+		b := buffer{fxpName}
+		b.uint32(id)
+		b.uint32(1)
+		b.string(p)
+		b.string(p)
+		b.attrs(&attrs{})
+		return writePacket(s.w, b)
+
+	default:
+		b := buffer{fxpStatus}
+		b.uint32(id)
+		b.uint32(fxOpUnsupported)
+		b.string("Operation unsupported")
+		b.string("")
+		return writePacket(s.w, b)
+	}
+}
+
+func (s *server) open(id uint32, p string, flags uint32, a *attrs) error {
+	h := &serverHandle{path: p, perm: 0644}
+	if a.flags&attrPermissions != 0 {
+		h.perm = permToFileMode(a.perm).Perm()
+	}
+
+	fi, err := s.fs.Stat(p)
+	switch {
+	case err == nil && fi.IsDir():
+		return s.sendStatus(id, fmt.Errorf("%s is a directory", p))
+	case err == nil:
+		h.perm = fi.Mode().Perm()
+		if flags&fxfTrunc == 0 {
+			if h.data, err = s.fs.ReadFile(p); err != nil {
+				return s.sendStatus(id, err)
+			}
+		}
+	case os.IsNotExist(err) && flags&fxfCreat != 0:
+	default:
+		return s.sendStatus(id, err)
+	}
+
+	if flags&fxfWrite != 0 {
+		// report permission problems now rather than on close
+		h.write = true
+		if err := s.fs.WriteFile(p, h.data, h.perm); err != nil {
+			return s.sendStatus(id, err)
+		}
+	}
+	return s.sendHandle(id, h)
+}
@@ -0,0 +1,364 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memFS is a FileSystem kept in memory. Paths under /root are denied.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	modes map[string]os.FileMode
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		files: make(map[string][]byte),
+		modes: map[string]os.FileMode{"/": os.ModeDir | 0755},
+	}
+}
+
+type memInfo struct {
+	name string
+	mode os.FileMode
+	size int64
+}
+
+func (fi *memInfo) Name() string       { return fi.name }
+func (fi *memInfo) Size() int64        { return fi.size }
+func (fi *memInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memInfo) ModTime() time.Time { return time.Unix(0, 0) }
+func (fi *memInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memInfo) Sys() interface{}   { return nil }
+
+func (fs *memFS) check(op, name string) error {
+	if name == "/root" || strings.HasPrefix(name, "/root/") {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+func (fs *memFS) Stat(name string) (os.FileInfo, error) {
+	if err := fs.check("stat", name); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	mode, ok := fs.modes[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &memInfo{path.Base(name), mode, int64(len(fs.files[name]))}, nil
+}
+
+func (fs *memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	fi, err := fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrInvalid}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var infos []os.FileInfo
+	for p, mode := range fs.modes {
+		if p != name && path.Dir(p) == name {
+			infos = append(infos, &memInfo{path.Base(p), mode, int64(len(fs.files[p]))})
+		}
+	}
+	return infos, nil
+}
+
+func (fs *memFS) ReadFile(name string) ([]byte, error) {
+	if err := fs.check("open", name); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	data, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (fs *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := fs.check("open", name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.modes[path.Dir(name)].IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	fs.files[name] = append([]byte(nil), data...)
+	fs.modes[name] = perm
+	return nil
+}
+
+func (fs *memFS) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.check("mkdir", name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.modes[name]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if !fs.modes[path.Dir(name)].IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+	}
+	fs.modes[name] = os.ModeDir | perm
+	return nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	if err := fs.check("chmod", name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	old, ok := fs.modes[name]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	fs.modes[name] = old&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	if err := fs.check("remove", name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.modes[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.modes, name)
+	delete(fs.files, name)
+	return nil
+}
+
+// pipeConn joins the ends of two pipes.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// bufferedPipe is like io.Pipe but writes never block, like an SSH
+// channel with a large window, so the client may send several requests
+// before reading the responses.
+type bufferedPipe struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newBufferedPipe() *bufferedPipe {
+	p := &bufferedPipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *bufferedPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.buf.Read(b)
+}
+
+func (p *bufferedPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.cond.Broadcast()
+	return p.buf.Write(b)
+}
+
+func (p *bufferedPipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+func newTestClient(t *testing.T, fs FileSystem) (*Client, func()) {
+	toClient := newBufferedPipe()
+	toServer := newBufferedPipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(pipeConn{toServer, toClient}, fs)
+		toClient.Close()
+	}()
+
+	c, err := NewClientPipe(toClient, toServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("server failed: %v", err)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	fs := newMemFS()
+	c, cleanup := newTestClient(t, fs)
+	defer cleanup()
+
+	if err := c.MkdirAll("/opt/bin", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := c.Stat("/opt/bin"); err != nil || !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		t.Fatalf("unexpected directory %v %v", fi, err)
+	}
+
+	// larger than a single packet
+	data := bytes.Repeat([]byte("0123456789abcdef"), 3*chunkSize/16+1)
+	f, err := c.Create("/opt/bin/tool", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write(data); err != nil || n != len(data) {
+		t.Fatalf("write returned %d %v", n, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.modes["/opt/bin/tool"] != 0755 || !bytes.Equal(fs.files["/opt/bin/tool"], data) {
+		t.Errorf("file not written correctly: %v", fs.modes["/opt/bin/tool"])
+	}
+
+	f, err = c.Open("/opt/bin/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != int64(len(data)) {
+		t.Errorf("unexpected stat %v %v", fi, err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes, expected %d", len(got), len(data))
+	}
+
+	if err := c.Chmod("/opt/bin/tool", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := c.Lstat("/opt/bin/tool"); err != nil || fi.Mode() != 0600 {
+		t.Errorf("chmod failed: %v %v", fi, err)
+	}
+
+	infos, err := c.ReadDir("/opt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "bin" || !infos[0].IsDir() {
+		t.Errorf("unexpected directory listing %v", infos)
+	}
+
+	if err := c.Remove("/opt/bin/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat("/opt/bin/tool"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, cleanup := newTestClient(t, newMemFS())
+	defer cleanup()
+
+	if _, err := c.Open("/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	if _, err := c.Create("/missing/file", 0644); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	if _, err := c.Create("/root/file", 0644); !os.IsPermission(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+	if err := c.MkdirAll("/root/dir", 0755); !os.IsPermission(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+	if _, err := c.ReadDir("/root"); !os.IsPermission(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+}
+
+func TestReadAheadInterleaved(t *testing.T) {
+	fs := newMemFS()
+	c, cleanup := newTestClient(t, fs)
+	defer cleanup()
+
+	// enough chunks to need more than one round of read ahead
+	data := bytes.Repeat([]byte("0123456789abcdef"), 2*maxInflight*chunkSize/16+5)
+	if err := fs.WriteFile("/data", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := c.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []byte
+	b := make([]byte, 1000)
+	for {
+		n, err := f.Read(b)
+		got = append(got, b[:n]...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		// other requests are answered while reads are outstanding
+		if len(got)%(7*chunkSize) < n {
+			if _, err := c.Stat("/data"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes, expected %d", len(got), len(data))
+	}
+}
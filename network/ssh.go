@@ -15,6 +15,8 @@
 package network
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
@@ -22,7 +24,9 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -31,8 +35,30 @@ const (
 	defaultPort = 22
 	defaultUser = "core"
 	rsaKeySize  = 2048
+
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeED25519 = "ed25519"
 )
 
+// SSHOptions controls the identity used by SSHAgent.
+type SSHOptions struct {
+	// User to connect as, defaults to core.
+	User string
+
+	// KeyType of the generated key: rsa, ecdsa or ed25519. Defaults
+	// to rsa. Ignored if KeyFiles are given.
+	KeyType string
+
+	// KeyFiles are unencrypted private keys in PEM format to use
+	// instead of generating a new key.
+	KeyFiles []string
+
+	// ForwardAgent makes the keys held by the ssh-agent listening on
+	// SSH_AUTH_SOCK available in addition to the agent's own keys.
+	ForwardAgent bool
+}
+
 // Dialer is an interface for anything compatible with net.Dialer
 type Dialer interface {
 	Dial(network, address string) (net.Conn, error)
@@ -45,31 +71,77 @@ type SSHAgent struct {
 	Dialer
 	User     string
 	Socket   string
+	HostKeys *HostKeys // trusts the first key seen for each host by default
 	sockDir  string
 	listener *net.UnixListener
+	upstream net.Conn
+
+	poolMu sync.Mutex
+	pool   map[string]*poolEntry
 }
 
 // NewSSHAgent constructs a new SSHAgent using dialer to create ssh
 // connections.
 func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
-	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
-	if err != nil {
-		return nil, err
+	return NewSSHAgentWithOptions(dialer, SSHOptions{})
+}
+
+// NewSSHAgentWithOptions constructs a new SSHAgent using dialer to create
+// ssh connections and the identity described by opts.
+func NewSSHAgentWithOptions(dialer Dialer, opts SSHOptions) (*SSHAgent, error) {
+	keyring := agent.NewKeyring()
+	if len(opts.KeyFiles) == 0 {
+		key, err := generateKey(opts.KeyType)
+		if err != nil {
+			return nil, err
+		}
+		err = keyring.Add(agent.AddedKey{
+			PrivateKey: key,
+			Comment:    "core@default",
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range opts.KeyFiles {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		err = keyring.Add(agent.AddedKey{
+			PrivateKey: key,
+			Comment:    path,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
 	}
 
-	addedkey := agent.AddedKey{
-		PrivateKey: key,
-		Comment:    "core@default",
+	var keys agent.Agent = keyring
+	var upstream net.Conn
+	if opts.ForwardAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, fmt.Errorf("ssh agent forwarding requested but SSH_AUTH_SOCK is not set")
+		}
+		var err error
+		upstream, err = net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to ssh-agent: %v", err)
+		}
+		keys = &chainAgent{keyring, agent.NewClient(upstream)}
 	}
 
-	keyring := agent.NewKeyring()
-	err = keyring.Add(addedkey)
-	if err != nil {
-		return nil, err
+	user := opts.User
+	if user == "" {
+		user = defaultUser
 	}
 
 	sockDir, err := ioutil.TempDir("", "mantle-ssh-")
 	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
 		return nil, err
 	}
 
@@ -78,17 +150,22 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	sockAddr := &net.UnixAddr{Name: sockPath, Net: "unix"}
 	listener, err := net.ListenUnix("unix", sockAddr)
 	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
 		os.RemoveAll(sockDir)
 		return nil, err
 	}
 
 	a := &SSHAgent{
-		Agent:    keyring,
+		Agent:    keys,
 		Dialer:   dialer,
-		User:     defaultUser,
+		User:     user,
 		Socket:   sockPath,
+		HostKeys: NewHostKeys(),
 		sockDir:  sockDir,
 		listener: listener,
+		upstream: upstream,
 	}
 
 	go func() {
@@ -104,12 +181,44 @@ func NewSSHAgent(dialer Dialer) (*SSHAgent, error) {
 	return a, nil
 }
 
-// Close closes the unix socket of the agent.
+// Close closes the unix socket of the agent and all pooled connections.
 func (a *SSHAgent) Close() error {
+	a.closePool()
 	a.listener.Close()
+	if a.upstream != nil {
+		a.upstream.Close()
+	}
 	return os.RemoveAll(a.sockDir)
 }
 
+// generateKey creates a new private key of the given type.
+func generateKey(keyType string) (interface{}, error) {
+	switch keyType {
+	case "", KeyTypeRSA:
+		return rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case KeyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return &key, err
+	default:
+		return nil, fmt.Errorf("unsupported ssh key type %q", keyType)
+	}
+}
+
+// loadKey reads an unencrypted private key from a PEM file.
+func loadKey(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
 // Add port to host if not already set.
 func ensurePortSuffix(host string, port int) string {
 	switch {
@@ -131,6 +240,9 @@ func (a *SSHAgent) newClient(host string, user string, auth []ssh.AuthMethod) (*
 		User: user,
 		Auth: auth,
 	}
+	if a.HostKeys != nil {
+		sshcfg.HostKeyCallback = a.HostKeys.Check
+	}
 	addr := ensurePortSuffix(host, defaultPort)
 	tcpconn, err := a.Dial("tcp", addr)
 	if err != nil {
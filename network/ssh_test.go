@@ -17,10 +17,16 @@ package network
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/coreos/mantle/network/mockssh"
 )
 
 var (
@@ -93,3 +99,173 @@ func TestSSHNewClient(t *testing.T) {
 	// Oh god... I give up for now.
 	t.Skip("Implementation incomplete")
 }
+
+// authDialer connects to mock servers that only accept the given user and
+// public key.
+type authDialer struct {
+	user string
+	key  ssh.PublicKey
+}
+
+func (d *authDialer) Dial(network, address string) (net.Conn, error) {
+	return mockssh.NewServerConn(mockssh.ServerConfig{
+		Handler: func(s *mockssh.Session) { s.Exit(0) },
+		PublicKeyCallback: func(user string, key ssh.PublicKey) bool {
+			return user == d.user && bytes.Equal(key.Marshal(), d.key.Marshal())
+		},
+	}), nil
+}
+
+func TestSSHKeyTypes(t *testing.T) {
+	for keyType, algo := range map[string]string{
+		"":             ssh.KeyAlgoRSA,
+		KeyTypeRSA:     ssh.KeyAlgoRSA,
+		KeyTypeECDSA:   ssh.KeyAlgoECDSA256,
+		KeyTypeED25519: ssh.KeyAlgoED25519,
+	} {
+		dialer := &authDialer{user: "admin"}
+		a, err := NewSSHAgentWithOptions(dialer, SSHOptions{
+			User:    "admin",
+			KeyType: keyType,
+		})
+		if err != nil {
+			t.Fatalf("%q: %v", keyType, err)
+		}
+
+		keys, err := a.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0].Type() != algo {
+			t.Errorf("%q: got keys %v wanted one %s", keyType, keys, algo)
+		} else {
+			dialer.key = keys[0]
+			client, err := a.NewClient("host")
+			if err != nil {
+				t.Errorf("%q: %v", keyType, err)
+			} else {
+				client.Close()
+			}
+		}
+		a.Close()
+	}
+
+	if _, err := NewSSHAgentWithOptions(&net.Dialer{}, SSHOptions{KeyType: "dsa"}); err == nil {
+		t.Errorf("unsupported key type accepted")
+	}
+}
+
+func TestSSHKeyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-ssh-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "id_rsa")
+	if err := ioutil.WriteFile(path, testHostKeyBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dialer := &authDialer{user: "core", key: signer.PublicKey()}
+	a, err := NewSSHAgentWithOptions(dialer, SSHOptions{KeyFiles: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Comment != path {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	client, err := a.NewClient("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if _, err := NewSSHAgentWithOptions(dialer, SSHOptions{
+		KeyFiles: []string{filepath.Join(dir, "missing")},
+	}); err == nil {
+		t.Errorf("missing key file accepted")
+	}
+}
+
+func TestSSHForwardAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-ssh-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// stand in for the user's own ssh-agent
+	signer, err := ssh.ParsePrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.ParseRawPrivateKey(testHostKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := agent.NewKeyring()
+	if err := upstream.Add(agent.AddedKey{PrivateKey: key, Comment: "user"}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(upstream, conn)
+		}
+	}()
+
+	oldSock := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", oldSock)
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	// only the user's key is accepted
+	dialer := &authDialer{user: "core", key: signer.PublicKey()}
+	a, err := NewSSHAgentWithOptions(dialer, SSHOptions{ForwardAgent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	keys, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[1].Comment != "user" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	client, err := a.NewClient("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// new keys must not end up in the user's agent
+	if err := a.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if userKeys, err := upstream.List(); err != nil || len(userKeys) != 1 {
+		t.Errorf("user's agent modified: %v %v", userKeys, err)
+	}
+}
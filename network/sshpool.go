@@ -0,0 +1,228 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keepaliveTimeout bounds how long a pooled connection may take to
+// answer a keepalive before it is considered dead. Connections to a
+// machine that rebooted without closing them would otherwise hang until
+// the TCP timeout.
+var keepaliveTimeout = 5 * time.Second
+
+// keepaliveIdle is how long a pooled connection may go unused before it
+// is checked with a keepalive. Connections which recently answered a
+// request are assumed to still be alive.
+var keepaliveIdle = time.Second
+
+var errKeepaliveTimeout = errors.New("ssh: keepalive timed out")
+
+// poolEntry holds the shared connection to a single host. The mutex
+// ensures only one connection is dialed at a time per host. Dropped
+// entries have been removed from the pool and must not be reused.
+type poolEntry struct {
+	mu       sync.Mutex
+	client   *ssh.Client
+	lastUsed time.Time
+	dropped  bool
+}
+
+// used records that the connection just answered a request.
+func (e *poolEntry) used(client *ssh.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == client {
+		e.lastUsed = time.Now()
+	}
+}
+
+// PooledSession opens a session on a connection to host that is kept
+// open and shared between callers. Stale connections, for example from
+// before a reboot, are detected with a keepalive and transparently
+// replaced. If the connection cannot accept another session, such as
+// when the server's MaxSessions limit is reached, a dedicated connection
+// is used instead. The returned function must be called to close the
+// session when finished with it.
+func (a *SSHAgent) PooledSession(host string) (*ssh.Session, func(), error) {
+	entry, client, err := a.pooledClient(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := client.NewSession()
+	if _, ok := err.(*ssh.OpenChannelError); ok {
+		return a.dedicatedSession(host)
+	} else if err != nil {
+		// The connection died since it was last used, start over.
+		a.DropClient(host)
+		if entry, client, err = a.pooledClient(host); err != nil {
+			return nil, nil, err
+		}
+		if session, err = client.NewSession(); err != nil {
+			return nil, nil, err
+		}
+	}
+	entry.used(client)
+
+	return session, func() { session.Close() }, nil
+}
+
+func (a *SSHAgent) dedicatedSession(host string) (*ssh.Session, func(), error) {
+	client, err := a.NewClient(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	return session, func() {
+		session.Close()
+		client.Close()
+	}, nil
+}
+
+// pooledClient returns the shared connection to host, dialing a new one
+// if there is none or the existing one is no longer responding.
+func (a *SSHAgent) pooledClient(host string) (*poolEntry, *ssh.Client, error) {
+	for {
+		entry := a.poolEntry(host)
+		client, ok, err := a.entryClient(entry, host)
+		if !ok {
+			// Dropped while waiting, try the replacement.
+			continue
+		}
+		return entry, client, err
+	}
+}
+
+// poolEntry returns the current pool entry for host, creating it if
+// needed.
+func (a *SSHAgent) poolEntry(host string) *poolEntry {
+	addr := ensurePortSuffix(host, defaultPort)
+
+	a.poolMu.Lock()
+	defer a.poolMu.Unlock()
+	if a.pool == nil {
+		a.pool = make(map[string]*poolEntry)
+	}
+	entry, ok := a.pool[addr]
+	if !ok {
+		entry = &poolEntry{}
+		a.pool[addr] = entry
+	}
+	return entry
+}
+
+// entryClient returns the entry's connection, dialing a new one if
+// needed. It reports false if the entry was dropped from the pool.
+func (a *SSHAgent) entryClient(entry *poolEntry, host string) (*ssh.Client, bool, error) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.dropped {
+		return nil, false, nil
+	}
+
+	if entry.client != nil {
+		if time.Since(entry.lastUsed) < keepaliveIdle {
+			return entry.client, true, nil
+		}
+		if err := keepalive(entry.client); err == nil {
+			entry.lastUsed = time.Now()
+			return entry.client, true, nil
+		}
+		entry.client.Close()
+		entry.client = nil
+	}
+
+	client, err := a.NewClient(host)
+	if err != nil {
+		return nil, true, err
+	}
+	entry.client = client
+	entry.lastUsed = time.Now()
+	return client, true, nil
+}
+
+// DropClient closes the pooled connection to host, if any. It should be
+// called when a host is rebooted or destroyed so later sessions do not
+// reach a system that is going away.
+func (a *SSHAgent) DropClient(host string) {
+	addr := ensurePortSuffix(host, defaultPort)
+
+	a.poolMu.Lock()
+	entry, ok := a.pool[addr]
+	delete(a.pool, addr)
+	a.poolMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// A connection being dialed right now is closed once it is up,
+	// callers waiting on the entry move on to a new one.
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.dropped = true
+	if entry.client != nil {
+		entry.client.Close()
+		entry.client = nil
+	}
+}
+
+// closePool closes all pooled connections.
+func (a *SSHAgent) closePool() {
+	a.poolMu.Lock()
+	pool := a.pool
+	a.pool = nil
+	a.poolMu.Unlock()
+
+	for _, entry := range pool {
+		entry.mu.Lock()
+		entry.dropped = true
+		if entry.client != nil {
+			entry.client.Close()
+			entry.client = nil
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// keepalive checks that the server is still answering requests. The
+// reply itself does not matter, OpenSSH rejects the request.
+func keepalive(client *ssh.Client) error {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(keepaliveTimeout):
+		return errKeepaliveTimeout
+	}
+}
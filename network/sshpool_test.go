@@ -0,0 +1,217 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/mockssh"
+)
+
+// mockDialer connects to mock ssh servers, keeping track of connections.
+type mockDialer struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (d *mockDialer) Dial(network, address string) (net.Conn, error) {
+	conn := mockssh.NewServerConn(mockssh.ServerConfig{
+		Handler: func(s *mockssh.Session) {
+			io.WriteString(s.Stdout, s.Exec)
+			s.Exit(0)
+		},
+		PublicKeyCallback: func(user string, key ssh.PublicKey) bool {
+			return true
+		},
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+func (d *mockDialer) dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+func (d *mockDialer) last() net.Conn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.conns[len(d.conns)-1]
+}
+
+func pooledRun(t *testing.T, a *SSHAgent, host, cmd string) {
+	session, done, err := a.PooledSession(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+
+	out, err := session.Output(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != cmd {
+		t.Errorf("got %q wanted %q", out, cmd)
+	}
+}
+
+func TestPooledSession(t *testing.T) {
+	dialer := &mockDialer{}
+	a, err := NewSSHAgent(dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for i := 0; i < 3; i++ {
+		pooledRun(t, a, "host1", "true")
+	}
+	if n := dialer.dials(); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+
+	pooledRun(t, a, "host2", "true")
+	if n := dialer.dials(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+
+	// explicitly dropped, as done for reboots.
+	a.DropClient("host1")
+	pooledRun(t, a, "host1", "true")
+	if n := dialer.dials(); n != 3 {
+		t.Errorf("expected 3 connections, got %d", n)
+	}
+
+	// connection lost without anyone noticing.
+	dialer.last().Close()
+	pooledRun(t, a, "host1", "true")
+	if n := dialer.dials(); n != 4 {
+		t.Errorf("expected 4 connections, got %d", n)
+	}
+}
+
+func TestPooledSessionConcurrent(t *testing.T) {
+	dialer := &mockDialer{}
+	a, err := NewSSHAgent(dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pooledRun(t, a, "host", "true")
+		}()
+	}
+	wg.Wait()
+
+	if n := dialer.dials(); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+// blockingDialer holds each dial until it is released.
+type blockingDialer struct {
+	mockDialer
+	dialing chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDialer) Dial(network, address string) (net.Conn, error) {
+	d.dialing <- struct{}{}
+	<-d.release
+	return d.mockDialer.Dial(network, address)
+}
+
+func TestPooledSessionDropWhileDialing(t *testing.T) {
+	dialer := &blockingDialer{
+		dialing: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	a, err := NewSSHAgent(dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	dialed := make(chan *ssh.Client)
+	go func() {
+		_, client, err := a.pooledClient("host")
+		if err != nil {
+			t.Error(err)
+		}
+		dialed <- client
+	}()
+
+	<-dialer.dialing
+	dropped := make(chan struct{})
+	go func() {
+		a.DropClient("host")
+		close(dropped)
+	}()
+	// give DropClient a chance to remove the entry and wait on it
+	time.Sleep(10 * time.Millisecond)
+	dialer.release <- struct{}{}
+	<-dialed
+	<-dropped
+
+	// the connection dialed for the dropped entry must not be reused
+	go func() {
+		<-dialer.dialing
+		dialer.release <- struct{}{}
+	}()
+	pooledRun(t, a, "host", "true")
+	if n := dialer.dials(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	keepaliveTimeout = 10 * time.Millisecond
+	defer func() { keepaliveTimeout = 5 * time.Second }()
+
+	// A server so slow it looks dead.
+	conn := mockssh.NewServerConn(mockssh.ServerConfig{
+		Handler: func(s *mockssh.Session) { s.Exit(0) },
+		Latency: 50 * time.Millisecond,
+	})
+	config := ssh.ClientConfig{
+		User: "core",
+		Auth: []ssh.AuthMethod{ssh.Password("")},
+	}
+	sshconn, chans, reqs, err := ssh.NewClientConn(conn, "slow", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ssh.NewClient(sshconn, chans, reqs)
+	defer client.Close()
+
+	if err := keepalive(client); err != errKeepaliveTimeout {
+		t.Errorf("expected %v, got %v", errKeepaliveTimeout, err)
+	}
+}
@@ -20,8 +20,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 
+	"github.com/coreos/pkg/capnslog"
 	"github.com/coreos/pkg/multierror"
 	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/ssh"
@@ -30,22 +33,29 @@ import (
 	"github.com/coreos/mantle/network"
 )
 
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform")
+
 type BaseCluster struct {
 	agent *network.SSHAgent
 
-	machlock sync.Mutex
-	machmap  map[string]Machine
+	machlock     sync.Mutex
+	machmap      map[string]Machine
+	listeners    map[int]MachineListener
+	jlisteners   map[int]JournalListener
+	nextListener int
+
+	knownHostsLock sync.Mutex
 
 	name string
 	dir  string
 }
 
-func NewBaseCluster(basename, outputDir string) (*BaseCluster, error) {
-	return NewBaseClusterWithDialer(basename, outputDir, network.NewRetryDialer())
+func NewBaseCluster(opts *Options, outputDir string) (*BaseCluster, error) {
+	return NewBaseClusterWithDialer(opts, outputDir, network.NewRetryDialer())
 }
 
-func NewBaseClusterWithDialer(basename, outputDir string, dialer network.Dialer) (*BaseCluster, error) {
-	agent, err := network.NewSSHAgent(dialer)
+func NewBaseClusterWithDialer(opts *Options, outputDir string, dialer network.Dialer) (*BaseCluster, error) {
+	agent, err := network.NewSSHAgentWithOptions(dialer, opts.SSH)
 	if err != nil {
 		return nil, err
 	}
@@ -53,9 +63,12 @@ func NewBaseClusterWithDialer(basename, outputDir string, dialer network.Dialer)
 	bc := &BaseCluster{
 		agent:   agent,
 		machmap: make(map[string]Machine),
-		name:    fmt.Sprintf("%s-%s", basename, uuid.NewV4()),
+		name:    fmt.Sprintf("%s-%s", opts.BaseName, uuid.NewV4()),
 		dir:     outputDir,
 	}
+	agent.HostKeys.Learned = func(string, ssh.PublicKey) {
+		bc.writeKnownHosts()
+	}
 
 	return bc, nil
 }
@@ -78,20 +91,15 @@ func (bc *BaseCluster) PasswordSSHClient(ip string, user string, password string
 	return sshClient, nil
 }
 
+// SSH runs a command on a connection shared with other SSH calls to the
+// same machine.
 func (bc *BaseCluster) SSH(m Machine, cmd string) ([]byte, error) {
-	client, err := bc.SSHClient(m.IP())
+	session, done, err := bc.agent.PooledSession(m.IP())
 	if err != nil {
 		return nil, err
 	}
 
-	defer client.Close()
-
-	session, err := client.NewSession()
-	if err != nil {
-		return nil, err
-	}
-
-	defer session.Close()
+	defer done()
 
 	session.Stderr = os.Stderr
 	out, err := session.Output(cmd)
@@ -111,14 +119,145 @@ func (bc *BaseCluster) Machines() []Machine {
 
 func (bc *BaseCluster) AddMach(m Machine) {
 	bc.machlock.Lock()
-	defer bc.machlock.Unlock()
 	bc.machmap[m.ID()] = m
+	listeners := bc.machineListeners()
+	bc.machlock.Unlock()
+
+	for _, l := range listeners {
+		l(m, true)
+	}
 }
 
 func (bc *BaseCluster) DelMach(m Machine) {
+	bc.agent.DropClient(m.IP())
+
 	bc.machlock.Lock()
-	defer bc.machlock.Unlock()
+	_, ok := bc.machmap[m.ID()]
 	delete(bc.machmap, m.ID())
+	listeners := bc.machineListeners()
+	bc.machlock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// The address may be handed to a new machine.
+	bc.agent.HostKeys.Forget(m.IP())
+	bc.writeKnownHosts()
+
+	for _, l := range listeners {
+		l(m, false)
+	}
+}
+
+// writeKnownHosts saves the host keys learned so far to known_hosts in
+// the output directory, for use with ssh's UserKnownHostsFile option.
+func (bc *BaseCluster) writeKnownHosts() {
+	dir := bc.OutputDir()
+	if dir == "" {
+		return
+	}
+
+	bc.knownHostsLock.Lock()
+	defer bc.knownHostsLock.Unlock()
+
+	var buf bytes.Buffer
+	if err := bc.agent.HostKeys.WriteKnownHosts(&buf); err != nil {
+		plog.Warningf("Failed to write known_hosts: %v", err)
+		return
+	}
+	path := filepath.Join(dir, "known_hosts")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		plog.Warningf("Failed to write known_hosts: %v", err)
+	}
+}
+
+// AddMachineListener registers a function to be called whenever a
+// machine is added to or removed from the cluster. Calling the returned
+// function removes the listener.
+func (bc *BaseCluster) AddMachineListener(l MachineListener) (remove func()) {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	if bc.listeners == nil {
+		bc.listeners = make(map[int]MachineListener)
+	}
+	id := bc.nextListener
+	bc.nextListener++
+	bc.listeners[id] = l
+	return func() {
+		bc.machlock.Lock()
+		defer bc.machlock.Unlock()
+		delete(bc.listeners, id)
+	}
+}
+
+// AddJournalListener registers a function to be called with the journal
+// of each new machine before it starts recording. Calling the returned
+// function removes the listener.
+func (bc *BaseCluster) AddJournalListener(l JournalListener) (remove func()) {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	if bc.jlisteners == nil {
+		bc.jlisteners = make(map[int]JournalListener)
+	}
+	id := bc.nextListener
+	bc.nextListener++
+	bc.jlisteners[id] = l
+	return func() {
+		bc.machlock.Lock()
+		defer bc.machlock.Unlock()
+		delete(bc.jlisteners, id)
+	}
+}
+
+// NewJournal creates the journal recorder for a new machine, see the
+// package level NewJournal, and passes it to the journal listeners.
+// Platforms must use it instead of NewJournal for JournalListener to
+// work.
+func (bc *BaseCluster) NewJournal(dir, machineID string) (*Journal, error) {
+	j, err := NewJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bc.machlock.Lock()
+	listeners := make([]JournalListener, 0, len(bc.jlisteners))
+	for _, l := range bc.jlisteners {
+		listeners = append(listeners, l)
+	}
+	bc.machlock.Unlock()
+
+	for _, l := range listeners {
+		l(machineID, j)
+	}
+	return j, nil
+}
+
+// machineListeners returns the current listeners in the order added.
+// Must be called with machlock held.
+func (bc *BaseCluster) machineListeners() []MachineListener {
+	ids := make([]int, 0, len(bc.listeners))
+	for id := range bc.listeners {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	listeners := make([]MachineListener, len(ids))
+	for i, id := range ids {
+		listeners[i] = bc.listeners[id]
+	}
+	return listeners
+}
+
+// DropSSHClient closes the shared connection used by SSH for the given
+// address. Machines must call it after starting a reboot so that checks
+// cannot reach the system before it went down.
+func (bc *BaseCluster) DropSSHClient(ip string) {
+	bc.agent.DropClient(ip)
+}
+
+// SSHUser returns the user SSH connections are made as.
+func (bc *BaseCluster) SSHUser() string {
+	return bc.agent.User
 }
 
 func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
@@ -163,5 +302,31 @@ func (bc *BaseCluster) Name() string {
 }
 
 func (bc *BaseCluster) OutputDir() string {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
 	return bc.dir
 }
+
+// SetOutputDir moves the cluster's output, including the journals of
+// existing machines, to dir.
+func (bc *BaseCluster) SetOutputDir(dir string) error {
+	bc.machlock.Lock()
+	bc.dir = dir
+	bc.machlock.Unlock()
+	bc.writeKnownHosts()
+
+	for _, m := range bc.Machines() {
+		j := m.Journal()
+		if j == nil {
+			continue
+		}
+		mdir := filepath.Join(dir, m.ID())
+		if err := os.MkdirAll(mdir, 0777); err != nil {
+			return err
+		}
+		if err := j.SetOutputDir(mdir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
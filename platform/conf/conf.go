@@ -26,6 +26,12 @@ import (
 	"golang.org/x/crypto/ssh/agent"
 )
 
+// defaultUser already exists on CoreOS machines.
+const defaultUser = "core"
+
+// extraUserGroups are given to users created to receive SSH keys.
+var extraUserGroups = []string{"sudo", "docker"}
+
 // Conf is a configuration for a CoreOS machine. It may be either a
 // coreos-cloudconfig or an ignition configuration.
 type Conf struct {
@@ -96,33 +102,55 @@ func (c *Conf) Bytes() []byte {
 	return []byte(c.String())
 }
 
-func (c *Conf) copyKeysIgnitionV1(keys []*agent.Key) {
-	c.ignitionV1.Passwd.Users = append(c.ignitionV1.Passwd.Users, v1types.User{
-		Name:              "core",
+func (c *Conf) copyKeysIgnitionV1(user string, keys []*agent.Key) {
+	u := v1types.User{
+		Name:              user,
 		SSHAuthorizedKeys: keysToStrings(keys),
-	})
+	}
+	if user != defaultUser {
+		u.Create = &v1types.UserCreate{Groups: extraUserGroups}
+	}
+	c.ignitionV1.Passwd.Users = append(c.ignitionV1.Passwd.Users, u)
 }
 
-func (c *Conf) copyKeysIgnitionV2(keys []*agent.Key) {
-	c.ignitionV2.Passwd.Users = append(c.ignitionV2.Passwd.Users, v2types.User{
-		Name:              "core",
+func (c *Conf) copyKeysIgnitionV2(user string, keys []*agent.Key) {
+	u := v2types.User{
+		Name:              user,
 		SSHAuthorizedKeys: keysToStrings(keys),
-	})
+	}
+	if user != defaultUser {
+		u.Create = &v2types.UserCreate{Groups: extraUserGroups}
+	}
+	c.ignitionV2.Passwd.Users = append(c.ignitionV2.Passwd.Users, u)
 }
 
-func (c *Conf) copyKeysCloudConfig(keys []*agent.Key) {
-	c.cloudconfig.SSHAuthorizedKeys = append(c.cloudconfig.SSHAuthorizedKeys, keysToStrings(keys)...)
+func (c *Conf) copyKeysCloudConfig(user string, keys []*agent.Key) {
+	if user == defaultUser {
+		c.cloudconfig.SSHAuthorizedKeys = append(c.cloudconfig.SSHAuthorizedKeys, keysToStrings(keys)...)
+		return
+	}
+	c.cloudconfig.Users = append(c.cloudconfig.Users, cci.User{
+		Name:              user,
+		SSHAuthorizedKeys: keysToStrings(keys),
+		Groups:            extraUserGroups,
+	})
 }
 
 // CopyKeys copies public keys from agent ag into the configuration to the
 // appropriate configuration section for the core user.
 func (c *Conf) CopyKeys(keys []*agent.Key) {
+	c.CopyUserKeys(defaultUser, keys)
+}
+
+// CopyUserKeys authorizes the public keys for the given user. Users other
+// than core are created and may use sudo.
+func (c *Conf) CopyUserKeys(user string, keys []*agent.Key) {
 	if c.ignitionV1 != nil {
-		c.copyKeysIgnitionV1(keys)
+		c.copyKeysIgnitionV1(user, keys)
 	} else if c.ignitionV2 != nil {
-		c.copyKeysIgnitionV2(keys)
+		c.copyKeysIgnitionV2(user, keys)
 	} else if c.cloudconfig != nil {
-		c.copyKeysCloudConfig(keys)
+		c.copyKeysCloudConfig(user, keys)
 	}
 }
 
@@ -58,3 +58,44 @@ func TestConfCopyKey(t *testing.T) {
 		}
 	}
 }
+
+func TestConfCopyUserKeys(t *testing.T) {
+	agent, err := network.NewSSHAgent(&net.Dialer{})
+	if err != nil {
+		t.Fatalf("NewSSHAgent failed: %v", err)
+	}
+	defer agent.Close()
+
+	keys, err := agent.List()
+	if err != nil {
+		t.Fatalf("agent.List failed: %v", err)
+	}
+
+	tests := []struct {
+		conf   string
+		create string
+	}{
+		{`{ "ignition": { "version": "2.0.0" } }`, `"create":{"groups":["sudo","docker"]}`},
+		{`{ "ignitionVersion": 1 }`, `"create":{"groups":["sudo","docker"]}`},
+		{"#cloud-config", "- sudo\n  - docker"},
+	}
+
+	for i, tt := range tests {
+		conf, err := New(tt.conf)
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		conf.CopyUserKeys("admin", keys)
+
+		str := conf.String()
+
+		if !strings.Contains(str, "admin") || !strings.Contains(str, " core@default") {
+			t.Errorf("user or key not found in config %d: %s", i, str)
+		}
+		if !strings.Contains(str, tt.create) {
+			t.Errorf("user not created in config %d: %s", i, str)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/coreos/mantle/network/journal"
 	"github.com/coreos/mantle/util"
@@ -26,27 +27,92 @@ import (
 
 // Journal manages recording the journal of a Machine.
 type Journal struct {
-	journal  *os.File
+	journal  *fileSwitch
+	raw      *fileSwitch
 	recorder *journal.Recorder
 	cancel   context.CancelFunc
 }
 
+// fileSwitch writes to a file that can be replaced while recording.
+type fileSwitch struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (s *fileSwitch) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Write(p)
+}
+
+// swap replaces the file written to and closes the old one.
+func (s *fileSwitch) swap(f *os.File) error {
+	s.mu.Lock()
+	old := s.f
+	s.f = f
+	s.mu.Unlock()
+	return old.Close()
+}
+
+func (s *fileSwitch) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// openJournalFiles opens journal.txt and journal-raw.txt in dir.
+func openJournalFiles(dir string) (j, r *os.File, err error) {
+	p := filepath.Join(dir, "journal.txt")
+	j, err = os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p = filepath.Join(dir, "journal-raw.txt")
+	r, err = os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		j.Close()
+		return nil, nil, err
+	}
+	return j, r, nil
+}
+
 // NewJournal creates a Journal recorder that will log to "journal.txt"
-// inside the given output directory.
+// inside the given output directory. The complete entries are also saved
+// in the journal export format to "journal-raw.txt".
 func NewJournal(dir string) (*Journal, error) {
-	p := filepath.Join(dir, "journal.txt")
-	j, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	j, r, err := openJournalFiles(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	js := &fileSwitch{f: j}
+	rs := &fileSwitch{f: r}
 	return &Journal{
-		journal:  j,
-		recorder: journal.NewRecorder(journal.ShortWriter(j)),
+		journal: js,
+		raw:     rs,
+		recorder: journal.NewRecorder(journal.MultiFormatter(
+			journal.ShortWriter(js), journal.ExportWriter(rs))),
 	}, nil
 }
 
+// SetOutputDir continues recording to journal.txt and journal-raw.txt in
+// a new directory, such as when a machine is used by another test.
+func (j *Journal) SetOutputDir(dir string) error {
+	jf, rf, err := openJournalFiles(dir)
+	if err != nil {
+		return err
+	}
+	err = j.journal.swap(jf)
+	if err2 := j.raw.swap(rf); err == nil {
+		err = err2
+	}
+	return err
+}
+
 // Start begins/resumes streaming the system journal to journal.txt.
+// If the connection is lost it is automatically re-established until
+// the journal is restarted or destroyed.
 func (j *Journal) Start(ctx context.Context, m Machine) error {
 	if j.cancel != nil {
 		j.cancel()
@@ -56,12 +122,7 @@ func (j *Journal) Start(ctx context.Context, m Machine) error {
 	ctx, cancel := context.WithCancel(ctx)
 
 	start := func() error {
-		client, err := m.SSHClient()
-		if err != nil {
-			return err
-		}
-
-		return j.recorder.StartSSH(ctx, client)
+		return j.recorder.FollowSSH(ctx, m.SSHClient)
 	}
 
 	// Retry for a while because this should be run before CheckMachine
@@ -74,6 +135,12 @@ func (j *Journal) Start(ctx context.Context, m Machine) error {
 	return nil
 }
 
+// Watch subscribes to entries matching the filter as they are recorded.
+// The caller should call Stop on the returned Watch when finished.
+func (j *Journal) Watch(f journal.Filter) *journal.Watch {
+	return j.recorder.Watch(f)
+}
+
 func (j *Journal) Destroy() error {
 	var err error
 	if j.cancel != nil {
@@ -83,5 +150,8 @@ func (j *Journal) Destroy() error {
 	if err2 := j.journal.Close(); err == nil && err2 != nil {
 		err = err2
 	}
+	if err2 := j.raw.Close(); err == nil && err2 != nil {
+		err = err2
+	}
 	return err
 }
@@ -43,7 +43,7 @@ func NewCluster(opts *aws.Options, outputDir string) (platform.Cluster, error) {
 		return nil, err
 	}
 
-	bc, err := platform.NewBaseCluster(opts.BaseName, outputDir)
+	bc, err := platform.NewBaseCluster(opts.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +82,7 @@ func (ac *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
+	conf.CopyUserKeys(ac.SSHUser(), keys)
 
 	instances, err := ac.api.CreateInstances(ac.Name(), conf.String(), 1, true)
 
@@ -103,7 +103,7 @@ func (ac *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	if mach.journal, err = platform.NewJournal(dir); err != nil {
+	if mach.journal, err = ac.NewJournal(dir, mach.ID()); err != nil {
 		mach.Destroy()
 		return nil, err
 	}
@@ -53,10 +53,15 @@ func (am *machine) SSH(cmd string) ([]byte, error) {
 	return am.cluster.SSH(am, cmd)
 }
 
+func (am *machine) Journal() *platform.Journal {
+	return am.journal
+}
+
 func (m *machine) Reboot() error {
 	if err := platform.StartReboot(m); err != nil {
 		return err
 	}
+	m.cluster.DropSSHClient(m.IP())
 	if err := m.journal.Start(context.TODO(), m); err != nil {
 		return err
 	}
@@ -0,0 +1,219 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements a platform.Cluster whose machines are
+// simulated by mockssh hosts rather than real instances. It is intended
+// for unit testing kola tests and kola itself, register it with
+// kola.RegisterTestPlatform to run tests against it with kola.RunTest.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// Options contains fake-specific options for the cluster.
+type Options struct {
+	// Version is reported as VERSION_ID in each machine's
+	// /etc/os-release. Defaults to DefaultVersion.
+	Version string
+
+	// Setup is called for every new machine before it is added to the
+	// cluster, typically to script commands on the machine's Host.
+	Setup func(m *Machine) error
+
+	// Latency simulates a slow network for all SSH connections.
+	Latency time.Duration
+
+	*platform.Options
+}
+
+// DefaultVersion is reported by machines if Options.Version is empty.
+const DefaultVersion = "1590.0.0"
+
+// Cluster is a cluster of fake machines.
+//
+// XXX: must be exported so that tests can access struct members through
+// type assertions.
+type Cluster struct {
+	*platform.BaseCluster
+	conf *Options
+
+	mu    sync.Mutex
+	hosts map[string]*Machine // by IP
+	next  int
+}
+
+// NewCluster creates a Cluster instance. Nothing outside of the output
+// directory is created.
+func NewCluster(opts *Options, outputDir string) (platform.Cluster, error) {
+	fc := &Cluster{
+		conf:  opts,
+		hosts: make(map[string]*Machine),
+	}
+
+	bc, err := platform.NewBaseClusterWithDialer(opts.Options, outputDir, fc)
+	if err != nil {
+		return nil, err
+	}
+	fc.BaseCluster = bc
+
+	return fc, nil
+}
+
+// NewMachine creates a new fake machine and runs Options.Setup on it.
+func (fc *Cluster) NewMachine(userdata string) (platform.Machine, error) {
+	fc.mu.Lock()
+	fc.next++
+	ip := fmt.Sprintf("10.0.%d.%d", fc.next/254, fc.next%254+1)
+	fc.mu.Unlock()
+
+	userdata = strings.Replace(userdata, "$public_ipv4", ip, -1)
+	userdata = strings.Replace(userdata, "$private_ipv4", ip, -1)
+
+	conf, err := conf.New(userdata)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := fc.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	conf.CopyUserKeys(fc.SSHUser(), keys)
+
+	m := &Machine{
+		Host:     mockssh.NewHost(),
+		UserData: conf.String(),
+		cluster:  fc,
+		id:       uuid.NewV4().String(),
+		ip:       ip,
+		logged:   make(chan struct{}),
+	}
+	m.newBoot()
+
+	version := fc.conf.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	m.Host.WriteFile("/etc/os-release", []byte(fmt.Sprintf(
+		"NAME=\"Container Linux by CoreOS\"\nID=coreos\nVERSION=%s\nVERSION_ID=%s\n",
+		version, version)), 0644)
+
+	dir := filepath.Join(fc.OutputDir(), m.ID())
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	if fc.conf.Setup != nil {
+		if err := fc.conf.Setup(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.journal, err = fc.NewJournal(dir, m.ID()); err != nil {
+		return nil, err
+	}
+
+	fc.mu.Lock()
+	fc.hosts[ip] = m
+	fc.mu.Unlock()
+
+	if err := m.journal.Start(context.TODO(), m); err != nil {
+		m.Destroy()
+		return nil, err
+	}
+
+	fc.AddMach(m)
+	return m, nil
+}
+
+// GetDiscoveryURL returns a made up URL without contacting the real
+// discovery service.
+func (fc *Cluster) GetDiscoveryURL(size int) (string, error) {
+	return fmt.Sprintf("https://discovery.etcd.io/fake-%s", uuid.NewV4()), nil
+}
+
+// Dial connects to the SSH server of the machine with the given address.
+// It is used by the cluster's SSH agent in place of a network dialer.
+func (fc *Cluster) Dial(network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	fc.mu.Lock()
+	m, ok := fc.hosts[host]
+	fc.mu.Unlock()
+	if !ok {
+		return nil, &net.OpError{
+			Op:  "dial",
+			Net: network,
+			Err: fmt.Errorf("fake: no machine at %s", address),
+		}
+	}
+
+	return mockssh.NewServerConn(mockssh.ServerConfig{
+		Handler:           m.serveSession,
+		PasswordCallback:  m.checkPassword,
+		PublicKeyCallback: fc.checkKey,
+		Latency:           fc.conf.Latency,
+	}), nil
+}
+
+// checkKey accepts the keys held by the cluster's SSH agent, the same
+// keys added to every machine's config for the SSH user.
+func (fc *Cluster) checkKey(user string, key ssh.PublicKey) bool {
+	if user != fc.SSHUser() {
+		return false
+	}
+	keys, err := fc.Keys()
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fc *Cluster) delMachine(m *Machine) {
+	fc.mu.Lock()
+	delete(fc.hosts, m.ip)
+	fc.mu.Unlock()
+
+	fc.DelMach(m)
+}
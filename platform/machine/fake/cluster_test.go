@@ -0,0 +1,381 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+)
+
+func newTestCluster(t *testing.T, opts *Options) (*Cluster, func()) {
+	dir, err := ioutil.TempDir("", "fake-cluster-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Options == nil {
+		opts.Options = &platform.Options{BaseName: "test"}
+	}
+	c, err := NewCluster(opts, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c.(*Cluster), func() {
+		if err := c.Destroy(); err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMachineSSH(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{
+		Setup: func(m *Machine) error {
+			m.Host.AddCommand("systemctl is-active etcd2", mockssh.Response{Stdout: "active\n"})
+			return nil
+		},
+	})
+	defer cleanup()
+
+	m, err := c.NewMachine("#cloud-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.(*Machine).UserData, "ssh_authorized_keys") {
+		t.Errorf("keys missing from user data:\n%s", m.(*Machine).UserData)
+	}
+
+	out, err := m.SSH("systemctl is-active etcd2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "active" {
+		t.Errorf("got %q wanted %q", out, "active")
+	}
+
+	out, err = m.SSH("grep ^VERSION_ID= /etc/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "VERSION_ID="+DefaultVersion {
+		t.Errorf("unexpected version %q", out)
+	}
+
+	if _, err := m.SSH("false"); err == nil {
+		t.Errorf("false succeeded")
+	}
+}
+
+func TestMachineListeners(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{})
+	defer cleanup()
+
+	var events []bool
+	remove := c.AddMachineListener(func(m platform.Machine, added bool) {
+		events = append(events, added)
+	})
+
+	m, err := c.NewMachine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if _, err := c.NewMachine(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(events, []bool{true, false}) {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestJournalListeners(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{})
+	defer cleanup()
+
+	var ids []string
+	remove := c.AddJournalListener(func(id string, j *platform.Journal) {
+		ids = append(ids, id)
+	})
+	j, err := c.NewJournal(c.OutputDir(), "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Destroy()
+	remove()
+
+	if !reflect.DeepEqual(ids, []string{"m1"}) {
+		t.Errorf("unexpected journals %v", ids)
+	}
+}
+
+func TestMachineJournal(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{})
+	defer cleanup()
+
+	pm, err := c.NewMachine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := pm.(*Machine)
+
+	log := func(message string) {
+		err := m.Log(map[string]string{
+			journal.FIELD_SYSLOG_IDENTIFIER: "test",
+			journal.FIELD_MESSAGE:           message,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	log("first boot")
+	if err := m.Reboot(); err != nil {
+		t.Fatal(err)
+	}
+	log("second boot")
+
+	out, err := m.SSH("journalctl --no-pager --output=short-precise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "test: first boot") || !strings.Contains(string(out), "test: second boot") {
+		t.Errorf("unexpected journalctl output:\n%s", out)
+	}
+
+	// the recording continued across the reboot
+	data, err := ioutil.ReadFile(filepath.Join(c.OutputDir(), m.ID(), "journal.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "first boot") || !strings.Contains(string(data), "-- Reboot --") ||
+		!strings.Contains(string(data), "second boot") {
+		t.Errorf("unexpected recording:\n%s", data)
+	}
+}
+
+func TestMachineFiles(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{})
+	defer cleanup()
+
+	machines, err := platform.NewMachines(c, []string{"", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2 := machines[0], machines[1]
+
+	if err := platform.InstallFile(strings.NewReader("data"), m1, "/opt/bin/test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := platform.TransferFile(m1, "/opt/bin/test", m2, "/opt/test"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, ok := m2.(*Machine).Host.ReadFile("/opt/test")
+	if !ok || string(f.Data) != "data" {
+		t.Errorf("transfer failed, got %q", f.Data)
+	}
+}
+
+func TestMachineAuth(t *testing.T) {
+	c, cleanup := newTestCluster(t, &Options{
+		Setup: func(m *Machine) error {
+			m.PasswordCallback = func(user, password string) bool {
+				return user == "core" && password == "pass"
+			}
+			return nil
+		},
+	})
+	defer cleanup()
+
+	m, err := c.NewMachine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.PasswordSSHClient("core", "wrong"); err == nil {
+		t.Errorf("wrong password accepted")
+	}
+	client, err := m.PasswordSSHClient("core", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SSH("true"); err == nil {
+		t.Errorf("connected to destroyed machine")
+	}
+	if len(c.Machines()) != 0 {
+		t.Errorf("destroyed machine still in cluster")
+	}
+}
+
+func TestMachineTransfer(t *testing.T) {
+	// only the first machine supports SFTP, limited to the home directory
+	var n int
+	c, cleanup := newTestCluster(t, &Options{
+		Setup: func(m *Machine) error {
+			if n++; n == 1 {
+				m.Host.EnableSFTP(".")
+			}
+			return nil
+		},
+	})
+	defer cleanup()
+
+	// create the machines in order so Setup counts them reliably
+	var machines []*Machine
+	for i := 0; i < 2; i++ {
+		m, err := c.NewMachine("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		machines = append(machines, m.(*Machine))
+	}
+	m1, m2 := machines[0], machines[1]
+
+	dir, err := ioutil.TempDir("", "fake-transfer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "b"), []byte("b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// copies are always owned by the SSH user, on either path
+	checkFile := func(m *Machine, name, data string, mode os.FileMode) {
+		f, ok := m.Host.ReadFile(name)
+		if !ok || string(f.Data) != data || f.Mode != mode {
+			t.Errorf("%s: got %q %v wanted %q %v", name, f.Data, f.Mode, data, mode)
+		}
+		if f.UID != mockssh.UserID || f.GID != mockssh.UserID {
+			t.Errorf("%s: owned by %d:%d wanted %d", name, f.UID, f.GID, mockssh.UserID)
+		}
+	}
+	usedTar := func(m *Machine) bool {
+		for _, cmd := range m.Host.History() {
+			if strings.HasPrefix(cmd, "sudo tar") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the home directory is written with SFTP
+	progress := make(map[string]int64)
+	err = platform.CopyTo(m1, src, "tree", func(path string, copied, total int64) {
+		if copied > total {
+			t.Errorf("%s: copied %d of %d", path, copied, total)
+		}
+		progress[path] = copied
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m1, "tree/a", "a", 0600)
+	checkFile(m1, "tree/sub/b", "b", 0755)
+	if usedTar(m1) {
+		t.Errorf("fell back to tar: %q", m1.Host.History())
+	}
+	if !reflect.DeepEqual(progress, map[string]int64{"tree/a": 1, "tree/sub/b": 1}) {
+		t.Errorf("unexpected progress %v", progress)
+	}
+
+	// everything else falls back to sudo
+	if err := platform.CopyTo(m1, src, "/opt/tree", nil); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m1, "/opt/tree/a", "a", 0600)
+	checkFile(m1, "/opt/tree/sub/b", "b", 0755)
+	if !usedTar(m1) {
+		t.Errorf("did not fall back to tar: %q", m1.Host.History())
+	}
+
+	if err := platform.TransferFile(m1, "/opt/tree", m2, "/srv/tree"); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m2, "/srv/tree/a", "a", 0600)
+	checkFile(m2, "/srv/tree/sub/b", "b", 0755)
+
+	// files owned by root are read with tar and written with SFTP or tar
+	m2.Host.WriteFile("/etc/config", []byte("config"), 0644)
+	if err := platform.TransferFile(m2, "/etc/config", m1, "config"); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m1, "config", "config", 0644)
+	if err := platform.TransferFile(m2, "/etc/config", m1, "/etc/config"); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m1, "/etc/config", "config", 0644)
+
+	dst := filepath.Join(dir, "dst")
+	if err := platform.CopyFrom(m2, "/srv/tree", dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{"a": 0600, "sub/b": 0755} {
+		fi, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Error(err)
+		} else if fi.Mode() != mode {
+			t.Errorf("%s: got mode %v wanted %v", name, fi.Mode(), mode)
+		}
+	}
+
+	if err := platform.WriteFile(m1, "notes", strings.NewReader("notes"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(m1, "notes", "notes", 0640)
+	for _, name := range []string{"notes", "/opt/tree/a"} {
+		r, err := platform.ReadFile(m1, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err2 := r.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if f, _ := m1.Host.ReadFile(name); string(data) != string(f.Data) {
+			t.Errorf("%s: read %q", name, data)
+		}
+	}
+
+	if err := platform.CopyFrom(m2, "/missing", dst, nil); err == nil {
+		t.Errorf("copying a missing file succeeded")
+	}
+}
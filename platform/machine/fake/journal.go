@@ -0,0 +1,199 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/satori/go.uuid"
+
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/network/mockssh"
+)
+
+// logTimeout limits how long Log waits for an entry to be recorded.
+const logTimeout = 10 * time.Second
+
+// Log adds an entry with the given fields, such as MESSAGE and
+// SYSLOG_IDENTIFIER, to the machine's journal. It returns once the entry
+// has been recorded so watches on the journal, including kola's crash
+// checks, have seen it.
+func (m *Machine) Log(fields map[string]string) error {
+	w := m.journal.Watch(journal.Filter{})
+	defer w.Stop()
+
+	cursor := m.addEntry(fields)
+	for {
+		entry, err := w.Wait(logTimeout)
+		if err != nil {
+			return fmt.Errorf("fake: journal entry not recorded: %v", err)
+		}
+		if string(entry[journal.FIELD_CURSOR]) == cursor {
+			return nil
+		}
+	}
+}
+
+// addEntry appends to the journal and wakes up any journalctl --follow
+// sessions, returning the new entry's cursor.
+func (m *Machine) addEntry(fields map[string]string) string {
+	m.jmu.Lock()
+	defer m.jmu.Unlock()
+
+	entry := make(journal.Entry, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = []byte(v)
+	}
+	cursor := fmt.Sprintf("s=fake;i=%x;b=%s", len(m.entries), m.bootID)
+	entry[journal.FIELD_CURSOR] = []byte(cursor)
+	entry[journal.FIELD_BOOT_ID] = []byte(m.bootID)
+	if _, ok := entry[journal.FIELD_REALTIME_TIMESTAMP]; !ok {
+		usec := time.Now().UnixNano() / int64(time.Microsecond)
+		entry[journal.FIELD_REALTIME_TIMESTAMP] = []byte(strconv.FormatInt(usec, 10))
+	}
+	m.entries = append(m.entries, entry)
+
+	close(m.logged)
+	m.logged = make(chan struct{})
+	return cursor
+}
+
+// newBoot starts a new boot id, older entries stay in the journal.
+func (m *Machine) newBoot() {
+	m.jmu.Lock()
+	defer m.jmu.Unlock()
+	m.bootID = strings.Replace(uuid.NewV4().String(), "-", "", -1)
+	m.boots = append(m.boots, m.bootID)
+}
+
+// serveSession handles journalctl itself and passes everything else on
+// to the machine's Host.
+func (m *Machine) serveSession(s *mockssh.Session) {
+	if s.Exec != "" {
+		args, err := shellquote.Split(s.Exec)
+		if err == nil && len(args) > 0 && args[0] == "journalctl" {
+			m.journalctl(s, args[1:])
+			return
+		}
+	}
+	m.Host.ServeSession(s)
+}
+
+// journalctl supports the commands run by platform.Journal and kola's
+// artifact collection, writing entries in the export or short formats.
+func (m *Machine) journalctl(s *mockssh.Session, args []string) {
+	m.jmu.Lock()
+	var (
+		boot   string // only show entries from this boot if set
+		next   int    // index of the next entry to show
+		follow bool
+		w      = journal.ShortWriter(s.Stdout)
+	)
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--lines=all", arg == "--quiet", arg == "--no-pager":
+		case arg == "--output=export":
+			w = journal.ExportWriter(s.Stdout)
+		case arg == "--output=short", arg == "--output=short-precise":
+		case arg == "--follow":
+			follow = true
+		case arg == "--lines=0":
+			next = len(m.entries)
+		case arg == "--boot":
+			boot = m.bootID
+		case strings.HasPrefix(arg, "--boot="):
+			boot = strings.TrimPrefix(arg, "--boot=")
+		case arg == "--after-cursor" && i+1 < len(args):
+			i++
+			n, ok := cursorIndex(args[i])
+			if !ok {
+				m.jmu.Unlock()
+				fmt.Fprintf(s.Stderr, "Failed to seek to cursor: Invalid argument\n")
+				s.Exit(1)
+				return
+			}
+			next = n + 1
+		default:
+			m.jmu.Unlock()
+			fmt.Fprintf(s.Stderr, "fake: unsupported journalctl argument %q\n", arg)
+			s.Exit(1)
+			return
+		}
+	}
+	if boot != "" && !m.hasBoot(boot) {
+		m.jmu.Unlock()
+		fmt.Fprintf(s.Stderr, "Data from the specified boot (%s) is not available\n", boot)
+		s.Exit(1)
+		return
+	}
+	m.jmu.Unlock()
+
+	for {
+		m.jmu.Lock()
+		var entries []journal.Entry
+		if next < len(m.entries) {
+			entries = m.entries[next:]
+		}
+		next += len(entries)
+		logged := m.logged
+		m.jmu.Unlock()
+
+		for _, entry := range entries {
+			if boot != "" && string(entry[journal.FIELD_BOOT_ID]) != boot {
+				continue
+			}
+			if err := w.WriteEntry(entry); err != nil {
+				s.Close()
+				return
+			}
+		}
+
+		if !follow {
+			s.Exit(0)
+			return
+		}
+		select {
+		case <-logged:
+		case <-s.Done():
+			s.Close()
+			return
+		}
+	}
+}
+
+// hasBoot must be called with jmu held.
+func (m *Machine) hasBoot(bootID string) bool {
+	for _, b := range m.boots {
+		if b == bootID {
+			return true
+		}
+	}
+	return false
+}
+
+// cursorIndex reads the entry index from a cursor made by addEntry.
+func cursorIndex(cursor string) (int, bool) {
+	for _, field := range strings.Split(cursor, ";") {
+		if strings.HasPrefix(field, "i=") {
+			n, err := strconv.ParseInt(field[2:], 16, 0)
+			return int(n), err == nil
+		}
+	}
+	return 0, false
+}
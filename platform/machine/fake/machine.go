@@ -0,0 +1,114 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/journal"
+	"github.com/coreos/mantle/network/mockssh"
+	"github.com/coreos/mantle/platform"
+)
+
+// Machine is a fake machine. All SSH sessions are served by Host.
+type Machine struct {
+	// Host simulates the machine's commands and filesystem.
+	Host *mockssh.Host
+
+	// UserData is the config the machine was created with, including
+	// the cluster's SSH keys.
+	UserData string
+
+	// PasswordCallback authenticates password logins, by default
+	// they are all rejected.
+	PasswordCallback func(user, password string) bool
+
+	cluster *Cluster
+	id      string
+	ip      string
+
+	mu      sync.Mutex
+	reboots int
+
+	// journal records the entries added by Log, served to it by a
+	// simulated journalctl.
+	journal *platform.Journal
+	jmu     sync.Mutex
+	entries []journal.Entry
+	bootID  string
+	boots   []string
+	logged  chan struct{} // closed when an entry is added
+}
+
+func (m *Machine) ID() string {
+	return m.id
+}
+
+func (m *Machine) IP() string {
+	return m.ip
+}
+
+func (m *Machine) PrivateIP() string {
+	return m.ip
+}
+
+func (m *Machine) SSHClient() (*ssh.Client, error) {
+	return m.cluster.SSHClient(m.IP())
+}
+
+func (m *Machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return m.cluster.PasswordSSHClient(m.IP(), user, password)
+}
+
+func (m *Machine) SSH(cmd string) ([]byte, error) {
+	return m.cluster.SSH(m, cmd)
+}
+
+// Journal returns the recording of the entries added with Log.
+func (m *Machine) Journal() *platform.Journal {
+	return m.journal
+}
+
+// Reboot counts reboots and starts a new boot in the journal.
+func (m *Machine) Reboot() error {
+	m.cluster.DropSSHClient(m.IP())
+
+	m.mu.Lock()
+	m.reboots++
+	m.mu.Unlock()
+
+	m.newBoot()
+	return m.journal.Start(context.TODO(), m)
+}
+
+// Reboots returns the number of times Reboot was called.
+func (m *Machine) Reboots() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reboots
+}
+
+func (m *Machine) Destroy() error {
+	err := m.journal.Destroy()
+	m.cluster.delMachine(m)
+	return err
+}
+
+func (m *Machine) checkPassword(user, password string) bool {
+	return m.PasswordCallback != nil && m.PasswordCallback(user, password)
+}
@@ -37,7 +37,7 @@ func NewCluster(opts *gcloud.Options, outputDir string) (platform.Cluster, error
 		return nil, err
 	}
 
-	bc, err := platform.NewBaseCluster(opts.BaseName, outputDir)
+	bc, err := platform.NewBaseCluster(opts.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +68,7 @@ func (gc *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
+	conf.CopyUserKeys(gc.SSHUser(), keys)
 
 	instance, err := gc.api.CreateInstance(conf.String(), keys)
 	if err != nil {
@@ -96,7 +96,7 @@ func (gc *cluster) NewMachine(userdata string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	if gm.journal, err = platform.NewJournal(dir); err != nil {
+	if gm.journal, err = gc.NewJournal(dir, gm.ID()); err != nil {
 		gm.Destroy()
 		return nil, err
 	}
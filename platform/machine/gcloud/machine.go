@@ -40,10 +40,15 @@ func (gm *machine) SSH(cmd string) ([]byte, error) {
 	return gm.gc.SSH(gm, cmd)
 }
 
+func (gm *machine) Journal() *platform.Journal {
+	return gm.journal
+}
+
 func (m *machine) Reboot() error {
 	if err := platform.StartReboot(m); err != nil {
 		return err
 	}
+	m.gc.DropSSHClient(m.IP())
 	if err := m.journal.Start(context.TODO(), m); err != nil {
 		return err
 	}
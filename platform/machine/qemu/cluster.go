@@ -64,7 +64,7 @@ var (
 // NewCluster creates a Cluster instance, suitable for running virtual
 // machines in QEMU.
 func NewCluster(conf *Options, outputDir string) (platform.Cluster, error) {
-	lc, err := local.NewLocalCluster(conf.BaseName, outputDir)
+	lc, err := local.NewLocalCluster(conf.Options, outputDir)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +106,7 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 		return nil, err
 	}
 
-	conf.CopyKeys(keys)
+	conf.CopyUserKeys(qc.SSHUser(), keys)
 
 	qc.mu.Unlock()
 
@@ -123,7 +123,7 @@ func (qc *Cluster) NewMachine(cfg string) (platform.Machine, error) {
 		}
 	}
 
-	journal, err := platform.NewJournal(dir)
+	journal, err := qc.NewJournal(dir, id.String())
 	if err != nil {
 		return nil, err
 	}
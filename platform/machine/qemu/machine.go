@@ -56,10 +56,15 @@ func (m *machine) SSH(cmd string) ([]byte, error) {
 	return m.qc.SSH(m, cmd)
 }
 
+func (m *machine) Journal() *platform.Journal {
+	return m.journal
+}
+
 func (m *machine) Reboot() error {
 	if err := platform.StartReboot(m); err != nil {
 		return err
 	}
+	m.qc.DropSSHClient(m.IP())
 	if err := m.journal.Start(context.TODO(), m); err != nil {
 		return err
 	}
@@ -17,13 +17,12 @@ package platform
 import (
 	"bytes"
 	"fmt"
-	"io"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/coreos/mantle/network"
 	"github.com/coreos/mantle/util"
 )
 
@@ -52,6 +51,10 @@ type Machine interface {
 	// SSH runs a single command over a new SSH connection.
 	SSH(cmd string) ([]byte, error)
 
+	// Journal returns the recorder of the machine's system journal,
+	// or nil if the platform does not record journals.
+	Journal() *Journal
+
 	// Reboot restarts the machine and waits for it to come back.
 	Reboot() error
 
@@ -75,112 +78,44 @@ type Cluster interface {
 	Destroy() error
 }
 
-// Options contains the base options for all clusters.
-type Options struct {
-	BaseName string
-}
+// MachineListener is called with added set to true when a machine joins
+// a cluster and false when it is destroyed.
+type MachineListener func(m Machine, added bool)
 
-// Wrap a StdoutPipe as a io.ReadCloser
-type sshPipe struct {
-	s   *ssh.Session
-	c   *ssh.Client
-	err *bytes.Buffer
-	io.Reader
+// MachineNotifier is implemented by clusters that can report machines
+// being added and removed, such as those embedding BaseCluster.
+type MachineNotifier interface {
+	// AddMachineListener registers l and returns a function that
+	// removes it again.
+	AddMachineListener(l MachineListener) (remove func())
 }
 
-func (p *sshPipe) Close() error {
-	if err := p.s.Wait(); err != nil {
-		return fmt.Errorf("%s: %s", err, p.err)
-	}
-	if err := p.s.Close(); err != nil {
-		return err
-	}
-	return p.c.Close()
-}
+// JournalListener is called with the journal of a new machine before it
+// starts recording, so watches on it see every entry logged since boot.
+type JournalListener func(machineID string, j *Journal)
 
-// Copy a file between two machines in a cluster.
-func TransferFile(src Machine, srcPath string, dst Machine, dstPath string) error {
-	srcPipe, err := ReadFile(src, srcPath)
-	if err != nil {
-		return err
-	}
-	defer srcPipe.Close()
-
-	if err := InstallFile(srcPipe, dst, dstPath); err != nil {
-		return err
-	}
-	return nil
+// JournalNotifier is implemented by clusters that can report new machine
+// journals, such as those embedding BaseCluster.
+type JournalNotifier interface {
+	// AddJournalListener registers l and returns a function that
+	// removes it again.
+	AddJournalListener(l JournalListener) (remove func())
 }
 
-// ReadFile returns a io.ReadCloser that streams the requested file. The
-// caller should close the reader when finished.
-func ReadFile(m Machine, path string) (io.ReadCloser, error) {
-	client, err := m.SSHClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed creating SSH client: %v", err)
-	}
-
-	session, err := client.NewSession()
-	if err != nil {
-		client.Close()
-		return nil, fmt.Errorf("failed creating SSH session: %v", err)
-	}
-
-	// connect session stdout
-	stdoutPipe, err := session.StdoutPipe()
-	if err != nil {
-		session.Close()
-		client.Close()
-		return nil, err
-	}
-
-	// collect stderr
-	errBuf := bytes.NewBuffer(nil)
-	session.Stderr = errBuf
-
-	// stream file to stdout
-	err = session.Start(fmt.Sprintf("sudo cat %s", path))
-	if err != nil {
-		session.Close()
-		client.Close()
-		return nil, err
-	}
-
-	// pass stdoutPipe as a io.ReadCloser that cleans up the ssh session
-	// on when closed.
-	return &sshPipe{session, client, errBuf, stdoutPipe}, nil
+// OutputDirSetter is implemented by clusters whose logs can be moved to
+// a new output directory, such as those embedding BaseCluster. Machine
+// journals are recorded to per machine directories in the new location
+// from then on, files already written are left in place.
+type OutputDirSetter interface {
+	SetOutputDir(dir string) error
 }
 
-// InstallFile copies data from in to the path to on m.
-func InstallFile(in io.Reader, m Machine, to string) error {
-	dir := filepath.Dir(to)
-	out, err := m.SSH(fmt.Sprintf("sudo mkdir -p %s", dir))
-	if err != nil {
-		return fmt.Errorf("failed creating directory %s: %s", dir, out)
-	}
-
-	client, err := m.SSHClient()
-	if err != nil {
-		return fmt.Errorf("failed creating SSH client: %v", err)
-	}
-
-	defer client.Close()
-
-	session, err := client.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed creating SSH session: %v", err)
-	}
-
-	defer session.Close()
-
-	// write file to fs from stdin
-	session.Stdin = in
-	out, err = session.CombinedOutput(fmt.Sprintf("sudo install -m 0755 /dev/stdin %s", to))
-	if err != nil {
-		return fmt.Errorf("failed executing install: %q: %v", out, err)
-	}
+// Options contains the base options for all clusters.
+type Options struct {
+	BaseName string
 
-	return nil
+	// SSH selects the keys and user for connecting to machines.
+	SSH network.SSHOptions
 }
 
 // NewMachines spawns len(userdatas) instances in cluster c, with
@@ -0,0 +1,796 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/network/sftp"
+)
+
+// Files are copied with SFTP as the SSH user where possible. Paths the
+// user cannot access fall back to running tar or cat with sudo. Either
+// way the files and directories written are owned by the SSH user, the
+// owner of the source is not kept. Missing parent directories created by
+// the fallback are owned by root. Only regular files and directories are
+// copied, other file types are skipped.
+
+// ProgressFunc is called as the data of each file is copied, with the
+// file's destination path, the bytes copied so far and the total, which
+// is -1 if unknown.
+type ProgressFunc func(path string, copied, total int64)
+
+// CopyTo copies the local file or directory tree at localPath to
+// remotePath on m, preserving permissions.
+func CopyTo(m Machine, localPath, remotePath string, progress ProgressFunc) error {
+	src, err := newWalkSource(localFS{}, localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := newRemoteSink(m, remotePath)
+	if err != nil {
+		return err
+	}
+	return copyTree(src, dst, remotePath, progress)
+}
+
+// CopyFrom copies the file or directory tree at remotePath on m to
+// localPath, preserving permissions.
+func CopyFrom(m Machine, remotePath, localPath string, progress ProgressFunc) error {
+	src, err := newRemoteSource(m, remotePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return copyTree(src, &localSink{root: localPath}, localPath, progress)
+}
+
+// Transfer copies the file or directory tree at srcPath on machine src
+// to dstPath on machine dst, preserving permissions.
+func Transfer(src Machine, srcPath string, dst Machine, dstPath string, progress ProgressFunc) error {
+	source, err := newRemoteSource(src, srcPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	sink, err := newRemoteSink(dst, dstPath)
+	if err != nil {
+		return err
+	}
+	return copyTree(source, sink, dstPath, progress)
+}
+
+// Copy a file or directory between two machines in a cluster.
+func TransferFile(src Machine, srcPath string, dst Machine, dstPath string) error {
+	return Transfer(src, srcPath, dst, dstPath, nil)
+}
+
+// WriteFile copies data from in to path on m, creating parent directories
+// as needed, and sets the file's permissions to perm.
+func WriteFile(m Machine, path string, in io.Reader, perm os.FileMode) error {
+	dst, err := newRemoteSink(m, path)
+	if err != nil {
+		return err
+	}
+	return copyTree(&readerSource{r: in, perm: perm}, dst, path, nil)
+}
+
+// InstallFile copies data from in to the path to on m. The file is always
+// executable, use WriteFile to choose its permissions.
+func InstallFile(in io.Reader, m Machine, to string) error {
+	return WriteFile(m, to, in, 0755)
+}
+
+// ReadFile returns a io.ReadCloser that streams the requested file. The
+// caller should close the reader when finished.
+func ReadFile(m Machine, path string) (io.ReadCloser, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+
+	if sc, err := sftp.NewClient(client); err == nil {
+		f, err := sc.Open(path)
+		if err == nil {
+			return &sftpReader{f, sc, client}, nil
+		}
+		sc.Close()
+		if !os.IsPermission(err) {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+
+	// connect session stdout
+	stdoutPipe, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		client.Close()
+		return nil, err
+	}
+
+	// collect stderr
+	errBuf := bytes.NewBuffer(nil)
+	session.Stderr = errBuf
+
+	// stream file to stdout
+	err = session.Start("sudo cat " + shellquote.Join(path))
+	if err != nil {
+		session.Close()
+		client.Close()
+		return nil, err
+	}
+
+	// pass stdoutPipe as a io.ReadCloser that cleans up the ssh session
+	// on when closed.
+	return &sshPipe{session, client, errBuf, stdoutPipe}, nil
+}
+
+// Wrap a StdoutPipe as a io.ReadCloser
+type sshPipe struct {
+	s   *ssh.Session
+	c   *ssh.Client
+	err *bytes.Buffer
+	io.Reader
+}
+
+// Close reports if the remote command failed. Errors closing the
+// connection afterwards are ignored, all data has been received by then.
+func (p *sshPipe) Close() error {
+	defer p.c.Close()
+	if err := p.s.Wait(); err != nil {
+		return fmt.Errorf("%s: %s", err, p.err)
+	}
+	return nil
+}
+
+// sftpReader closes the SFTP and SSH clients along with the file.
+type sftpReader struct {
+	*sftp.File
+	sc *sftp.Client
+	c  *ssh.Client
+}
+
+func (r *sftpReader) Close() error {
+	err := r.File.Close()
+	r.sc.Close()
+	r.c.Close()
+	return err
+}
+
+// entry is a file or directory in a tree being copied. The name is slash
+// separated and relative to the root of the tree, which is named "".
+type entry struct {
+	name string
+	mode os.FileMode
+	size int64                         // -1 if unknown
+	open func() (io.ReadCloser, error) // nil for directories
+}
+
+// source produces the entries of a tree, parents before children.
+type source interface {
+	// Next returns io.EOF after the last entry.
+	Next() (*entry, error)
+	Close() error
+}
+
+// sink writes entries to their destination.
+type sink interface {
+	Mkdir(e *entry) error
+	WriteFile(e *entry, r io.Reader) error
+	// Close finishes writing, reporting any delayed errors.
+	Close() error
+}
+
+// copyTree writes all entries of src to dst, closing dst. Progress is
+// reported relative to root, the destination path.
+func copyTree(src source, dst sink, root string, progress ProgressFunc) error {
+	err := copyEntries(src, dst, root, progress)
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func copyEntries(src source, dst sink, root string, progress ProgressFunc) error {
+	for {
+		e, err := src.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if e.mode.IsDir() {
+			if err := dst.Mkdir(e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := e.open()
+		if err != nil {
+			return err
+		}
+		var in io.Reader = r
+		if progress != nil {
+			in = &progressReader{
+				r:     r,
+				name:  path.Join(root, e.name),
+				total: e.size,
+				fn:    progress,
+			}
+		}
+		err = dst.WriteFile(e, in)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type progressReader struct {
+	r      io.Reader
+	name   string
+	copied int64
+	total  int64
+	fn     ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.copied += int64(n)
+	if n > 0 || err == io.EOF {
+		p.fn(p.name, p.copied, p.total)
+	}
+	return n, err
+}
+
+// readerSource is a single file with unknown size.
+type readerSource struct {
+	r    io.Reader
+	perm os.FileMode
+	done bool
+}
+
+func (s *readerSource) Next() (*entry, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return &entry{
+		mode: s.perm,
+		size: -1,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(s.r), nil
+		},
+	}, nil
+}
+
+func (s *readerSource) Close() error {
+	return nil
+}
+
+// walkFS is the read only part of a filesystem needed by walkSource.
+type walkFS interface {
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Join(elem ...string) string
+	Close() error
+}
+
+// walkSource lists a whole tree up front, checking that each file can be
+// opened, so permission problems are found before anything is copied.
+type walkSource struct {
+	fs      walkFS
+	entries []*entry
+}
+
+func newWalkSource(fs walkFS, root string) (*walkSource, error) {
+	s := &walkSource{fs: fs}
+	fi, err := fs.Lstat(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.walk(root, "", fi); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *walkSource) walk(full, name string, fi os.FileInfo) error {
+	e := &entry{
+		name: name,
+		mode: fi.Mode(),
+		size: fi.Size(),
+	}
+
+	switch {
+	case fi.Mode().IsRegular():
+		f, err := s.fs.Open(full)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		e.open = func() (io.ReadCloser, error) {
+			return s.fs.Open(full)
+		}
+		s.entries = append(s.entries, e)
+	case fi.IsDir():
+		s.entries = append(s.entries, e)
+		children, err := s.fs.ReadDir(full)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := s.walk(s.fs.Join(full, child.Name()), path.Join(name, child.Name()), child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *walkSource) Next() (*entry, error) {
+	if len(s.entries) == 0 {
+		return nil, io.EOF
+	}
+	e := s.entries[0]
+	s.entries = s.entries[1:]
+	return e, nil
+}
+
+func (s *walkSource) Close() error {
+	return s.fs.Close()
+}
+
+type localFS struct{}
+
+func (localFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) { return ioutil.ReadDir(name) }
+func (localFS) Open(name string) (io.ReadCloser, error)    { return os.Open(name) }
+func (localFS) Join(elem ...string) string                 { return filepath.Join(elem...) }
+func (localFS) Close() error                               { return nil }
+
+// sftpFS reads from a machine as the SSH user.
+type sftpFS struct {
+	sc     *sftp.Client
+	client *ssh.Client
+}
+
+func (fs *sftpFS) Lstat(name string) (os.FileInfo, error)     { return fs.sc.Lstat(name) }
+func (fs *sftpFS) ReadDir(name string) ([]os.FileInfo, error) { return fs.sc.ReadDir(name) }
+func (fs *sftpFS) Open(name string) (io.ReadCloser, error)    { return fs.sc.Open(name) }
+func (fs *sftpFS) Join(elem ...string) string                 { return path.Join(elem...) }
+
+func (fs *sftpFS) Close() error {
+	fs.sc.Close()
+	return fs.client.Close()
+}
+
+// newRemoteSource reads a tree from m over SFTP, falling back to tar with
+// sudo if SFTP is unavailable or access is denied.
+func newRemoteSource(m Machine, root string) (source, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+
+	if sc, err := sftp.NewClient(client); err == nil {
+		fs := &sftpFS{sc, client}
+		src, err := newWalkSource(fs, root)
+		if err == nil {
+			return src, nil
+		}
+		sc.Close()
+		if !os.IsPermission(err) {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	src, err := newTarSource(client, root)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+// tarSource reads the output of tar run with sudo. Entries are named with
+// the base name of the root first, which is removed.
+type tarSource struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stderr  bytes.Buffer
+	tr      *tar.Reader
+	base    string
+}
+
+func newTarSource(client *ssh.Client, root string) (*tarSource, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	root = path.Clean(root)
+	s := &tarSource{
+		client:  client,
+		session: session,
+		tr:      tar.NewReader(stdout),
+		base:    path.Base(root),
+	}
+	session.Stderr = &s.stderr
+
+	cmd := "sudo tar -C " + shellquote.Join(path.Dir(root)) + " -cf - " + shellquote.Join(s.base)
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *tarSource) Next() (*entry, error) {
+	for {
+		hdr, err := s.tr.Next()
+		if err == io.EOF {
+			if err := s.session.Wait(); err != nil {
+				return nil, fmt.Errorf("tar failed: %v: %s", err, s.stderr.Bytes())
+			}
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, fmt.Errorf("reading tar output: %v: %s", err, s.stderr.Bytes())
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == s.base {
+			name = ""
+		} else if strings.HasPrefix(name, s.base+"/") {
+			name = name[len(s.base)+1:]
+		} else {
+			return nil, fmt.Errorf("unexpected tar entry %q", hdr.Name)
+		}
+
+		e := &entry{
+			name: name,
+			mode: hdr.FileInfo().Mode(),
+			size: hdr.Size,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return e, nil
+		case tar.TypeReg, tar.TypeRegA:
+			e.open = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(s.tr), nil
+			}
+			return e, nil
+		}
+	}
+}
+
+func (s *tarSource) Close() error {
+	s.session.Close()
+	return s.client.Close()
+}
+
+// localSink writes to the local filesystem.
+type localSink struct {
+	root string
+}
+
+func (s *localSink) path(e *entry) string {
+	return filepath.Join(s.root, filepath.FromSlash(e.name))
+}
+
+func (s *localSink) Mkdir(e *entry) error {
+	p := s.path(e)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return err
+	}
+	return os.Chmod(p, e.mode.Perm())
+}
+
+func (s *localSink) WriteFile(e *entry, r io.Reader) error {
+	p := s.path(e)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(p, e.mode.Perm())
+}
+
+func (s *localSink) Close() error {
+	return nil
+}
+
+// remoteSink writes to a machine over SFTP until access is denied, then
+// switches to extracting the remaining entries with tar run by sudo.
+type remoteSink struct {
+	client *ssh.Client
+	sc     *sftp.Client // nil if unavailable
+	root   string
+	tar    *tarSink // set once SFTP has failed
+}
+
+func newRemoteSink(m Machine, root string) (*remoteSink, error) {
+	client, err := m.SSHClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH client: %v", err)
+	}
+
+	s := &remoteSink{client: client, root: root}
+	if sc, err := sftp.NewClient(client); err == nil {
+		s.sc = sc
+		if err := sc.MkdirAll(path.Dir(root), 0755); err != nil {
+			if !os.IsPermission(err) {
+				s.Close()
+				return nil, err
+			}
+			s.sc.Close()
+			s.sc = nil
+		}
+	}
+	return s, nil
+}
+
+func (s *remoteSink) path(e *entry) string {
+	return path.Join(s.root, e.name)
+}
+
+// fallback switches to tar if err is a permission error, returning true
+// if the operation should be retried.
+func (s *remoteSink) fallback(err error) (bool, error) {
+	if !os.IsPermission(err) {
+		return false, err
+	}
+	s.sc.Close()
+	s.sc = nil
+	return true, nil
+}
+
+func (s *remoteSink) startTar() error {
+	if s.tar != nil {
+		return nil
+	}
+	t, err := newTarSink(s.client, s.root)
+	if err != nil {
+		return err
+	}
+	s.tar = t
+	return nil
+}
+
+func (s *remoteSink) Mkdir(e *entry) error {
+	if s.sc != nil {
+		p := s.path(e)
+		err := s.sc.MkdirAll(p, 0755)
+		if err == nil {
+			err = s.sc.Chmod(p, e.mode)
+		}
+		if retry, err := s.fallback(err); !retry {
+			return err
+		}
+	}
+	if err := s.startTar(); err != nil {
+		return err
+	}
+	return s.tar.Mkdir(e)
+}
+
+func (s *remoteSink) WriteFile(e *entry, r io.Reader) error {
+	if s.sc != nil {
+		p := s.path(e)
+		f, err := s.sc.Create(p, e.mode)
+		if err == nil {
+			_, err = io.Copy(f, r)
+			if err2 := f.Close(); err == nil {
+				err = err2
+			}
+			if err == nil {
+				err = s.sc.Chmod(p, e.mode)
+			}
+			return err
+		}
+		if retry, err := s.fallback(err); !retry {
+			return err
+		}
+	}
+	if err := s.startTar(); err != nil {
+		return err
+	}
+	return s.tar.WriteFile(e, r)
+}
+
+func (s *remoteSink) Close() error {
+	var err error
+	if s.tar != nil {
+		err = s.tar.Close()
+	}
+	if s.sc != nil {
+		s.sc.Close()
+	}
+	s.client.Close()
+	return err
+}
+
+// tarSink extracts entries with tar run by sudo, owned by the SSH user.
+type tarSink struct {
+	session  *ssh.Session
+	stdin    io.WriteCloser
+	stderr   bytes.Buffer
+	tw       *tar.Writer
+	base     string
+	uid, gid int
+}
+
+func newTarSink(client *ssh.Client, root string) (*tarSink, error) {
+	root = path.Clean(root)
+	dir := shellquote.Join(path.Dir(root))
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	out, err := session.CombinedOutput("sudo mkdir -p " + dir)
+	session.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating directory %s: %s", path.Dir(root), out)
+	}
+
+	uid, err := userID(client, "-u")
+	if err != nil {
+		return nil, err
+	}
+	gid, err := userID(client, "-g")
+	if err != nil {
+		return nil, err
+	}
+
+	session, err = client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	t := &tarSink{
+		session: session,
+		stdin:   stdin,
+		tw:      tar.NewWriter(stdin),
+		base:    path.Base(root),
+		uid:     uid,
+		gid:     gid,
+	}
+	session.Stderr = &t.stderr
+	if err := session.Start("sudo tar -C " + dir + " --numeric-owner -xpf -"); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// userID runs id with the given flag to get the SSH user's uid or gid.
+func userID(client *ssh.Client, flag string) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed creating SSH session: %v", err)
+	}
+	defer session.Close()
+
+	out, err := session.Output("id " + flag)
+	if err != nil {
+		return 0, fmt.Errorf("failed looking up SSH user: %v", err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+func (t *tarSink) header(e *entry) *tar.Header {
+	hdr := &tar.Header{
+		Name: path.Join(t.base, e.name),
+		Mode: int64(e.mode.Perm()),
+		Uid:  t.uid,
+		Gid:  t.gid,
+	}
+	if e.mode&os.ModeSetuid != 0 {
+		hdr.Mode |= 04000
+	}
+	if e.mode&os.ModeSetgid != 0 {
+		hdr.Mode |= 02000
+	}
+	if e.mode&os.ModeSticky != 0 {
+		hdr.Mode |= 01000
+	}
+	return hdr
+}
+
+func (t *tarSink) Mkdir(e *entry) error {
+	hdr := t.header(e)
+	hdr.Name += "/"
+	hdr.Typeflag = tar.TypeDir
+	return t.tw.WriteHeader(hdr)
+}
+
+func (t *tarSink) WriteFile(e *entry, r io.Reader) error {
+	hdr := t.header(e)
+	hdr.Typeflag = tar.TypeReg
+	hdr.Size = e.size
+	if hdr.Size < 0 {
+		// tar needs the size up front
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		hdr.Size = int64(len(data))
+		r = bytes.NewReader(data)
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarSink) Close() error {
+	err := t.tw.Close()
+	if err2 := t.stdin.Close(); err == nil {
+		err = err2
+	}
+	if err2 := t.session.Wait(); err2 != nil && err == nil {
+		err = fmt.Errorf("tar failed: %v: %s", err2, t.stderr.Bytes())
+	}
+	t.session.Close()
+	return err
+}
@@ -30,6 +30,8 @@ import (
 const (
 	privateKey = "/usr/share/update_engine/update-payload-key.key.pem"
 	publicKey  = "/usr/share/update_engine/update-payload-key.pub.pem"
+
+	updatePrefix = "coreos_production_update"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "sdk/omaha")
@@ -82,9 +84,15 @@ func checkUpdate(dir, update_xml string) error {
 	return u.Packages[0].Verify(pkgdir)
 }
 
+// UpdateManifestPath returns the path of the update manifest written by
+// GenerateFullUpdate for the image in dir.
+func UpdateManifestPath(dir string) string {
+	return filepath.Join(dir, updatePrefix+".xml")
+}
+
 func GenerateFullUpdate(dir string) error {
 	var (
-		update_prefix = filepath.Join(dir, "coreos_production_update")
+		update_prefix = filepath.Join(dir, updatePrefix)
 		update_bin    = update_prefix + ".bin"
 		update_gz     = update_prefix + ".gz"
 		update_xml    = update_prefix + ".xml"